@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -18,6 +19,8 @@ import (
 	"github.com/raoxb/smart_redirect/internal/middleware"
 	"github.com/raoxb/smart_redirect/internal/services"
 	"github.com/raoxb/smart_redirect/pkg/auth"
+	"github.com/raoxb/smart_redirect/pkg/clientip"
+	"github.com/raoxb/smart_redirect/pkg/geoip"
 )
 
 func main() {
@@ -41,20 +44,53 @@ func main() {
 	}
 	defer redisClient.Close()
 	
+	clientIPs, err := clientip.New(cfg.ClientIP.TrustedProxies, cfg.ClientIP.Headers)
+	if err != nil {
+		log.Fatalf("Invalid client_ip config: %v", err)
+	}
+	
 	gin.SetMode(cfg.Server.Mode)
 	router := gin.New()
+	// Keep the request log in line with the client IP resolver
+	if err := router.SetTrustedProxies(cfg.ClientIP.TrustedProxies); err != nil {
+		log.Fatalf("Invalid client_ip config: %v", err)
+	}
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 	
-	redirectHandler := api.NewRedirectHandler(db, redisClient)
+	botFilter, err := services.NewBotFilter(cfg.BotFilter)
+	if err != nil {
+		log.Fatalf("Failed to create bot filter: %v", err)
+	}
+	
+	ipRanges := services.NewIPRangeService(db, redisClient)
+	if err := ipRanges.Reload(context.Background()); err != nil {
+		log.Fatalf("Failed to load IP ranges: %v", err)
+	}
+	
+	geoIP, err := geoip.NewProvider(&cfg.GeoIP)
+	if err != nil {
+		log.Fatalf("Failed to create GeoIP provider: %v", err)
+	}
+	defer geoIP.Close()
+	
+	redirectHandler := api.NewRedirectHandler(db, redisClient, cfg.RateLimit, botFilter, ipRanges, clientIPs, geoIP)
 	jwtManager := auth.NewJWTManager(cfg.Security.JWTSecret, cfg.Security.JWTExpireHours)
 	authHandler := api.NewAuthHandler(db, jwtManager)
-	linkHandler := api.NewLinkHandler(db, redisClient)
+	linkHandler := api.NewLinkHandler(db, redisClient, cfg.LinkIDs)
 	userHandler := api.NewUserHandler(db)
-	statsHandler := api.NewStatsHandler(db, redisClient)
-	batchHandler := api.NewBatchHandler(db, redisClient)
-	templateHandler := api.NewTemplateHandler(db)
+	statsHandler := api.NewStatsHandler(db, redisClient, ipRanges)
+	batchHandler := api.NewBatchHandler(db, redisClient, cfg.LinkIDs)
+	templateHandler := api.NewTemplateHandler(db, cfg.LinkIDs)
 	monitorHandler := api.NewMonitorHandler(db, redisClient)
+	countryGroupHandler := api.NewCountryGroupHandler(db, redisClient)
+	postbackAuth, err := services.NewPostbackAuth(cfg.Postback)
+	if err != nil {
+		log.Fatalf("Invalid postback config: %v", err)
+	}
+	postbackHandler := api.NewPostbackHandler(db, redisClient, postbackAuth, clientIPs)
+	qrHandler := api.NewQRHandler(db, cfg.Server.PublicURL, clientIPs)
+	ipRangeHandler := api.NewIPRangeHandler(ipRanges)
 	
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -64,6 +100,8 @@ func main() {
 	})
 	
 	router.GET("/v1/:bu/:link_id", redirectHandler.HandleRedirect)
+	router.GET("/postback", postbackHandler.HandlePostback)
+	router.POST("/postback", postbackHandler.HandlePostback)
 	
 	apiV1 := router.Group("/api/v1")
 	{
@@ -83,11 +121,15 @@ func main() {
 			
 			authGroup.POST("/links/:link_id/targets", linkHandler.CreateTarget)
 			authGroup.GET("/links/:link_id/targets", linkHandler.GetTargets)
+			authGroup.GET("/links/:link_id/qr", qrHandler.GetLinkQR)
 			authGroup.PUT("/targets/:target_id", linkHandler.UpdateTarget)
 			authGroup.DELETE("/targets/:target_id", linkHandler.DeleteTarget)
+			authGroup.POST("/targets/:target_id/conversions", linkHandler.RecordConversions)
 			
 			authGroup.GET("/stats/links/:link_id", statsHandler.GetLinkStats)
 			authGroup.GET("/stats/links/:link_id/hourly", statsHandler.GetHourlyStats)
+			authGroup.GET("/stats/links/:link_id/bandit", statsHandler.GetBanditStats)
+			authGroup.GET("/stats/links/:link_id/caps", statsHandler.GetCapStats)
 			authGroup.GET("/stats/system", statsHandler.GetSystemStats)
 			authGroup.GET("/stats/realtime", statsHandler.GetRealtimeStats)
 			authGroup.GET("/stats/access-logs", statsHandler.GetAccessLogs)
@@ -97,6 +139,7 @@ func main() {
 			authGroup.DELETE("/batch/links", batchHandler.BatchDeleteLinks)
 			authGroup.POST("/batch/import", batchHandler.ImportLinksFromCSV)
 			authGroup.GET("/batch/export", batchHandler.ExportLinksToCSV)
+			authGroup.POST("/batch/export/qr", qrHandler.ExportQRCodes)
 			
 			authGroup.POST("/templates", templateHandler.CreateTemplate)
 			authGroup.GET("/templates", templateHandler.ListTemplates)
@@ -105,6 +148,9 @@ func main() {
 			authGroup.DELETE("/templates/:id", templateHandler.DeleteTemplate)
 			authGroup.POST("/templates/create-links", templateHandler.CreateLinksFromTemplate)
 			
+			authGroup.GET("/country-groups", countryGroupHandler.ListCountryGroups)
+			authGroup.GET("/country-groups/:name", countryGroupHandler.GetCountryGroup)
+			
 			adminGroup := authGroup.Group("/")
 			adminGroup.Use(middleware.AdminOnly())
 			{
@@ -116,10 +162,20 @@ func main() {
 				adminGroup.POST("/users/:id/links", userHandler.AssignLink)
 				adminGroup.GET("/users/:id/links", userHandler.GetUserLinks)
 				
+				adminGroup.POST("/country-groups", countryGroupHandler.CreateCountryGroup)
+				adminGroup.PUT("/country-groups/:name", countryGroupHandler.UpdateCountryGroup)
+				adminGroup.DELETE("/country-groups/:name", countryGroupHandler.DeleteCountryGroup)
+				
 				adminGroup.GET("/stats/ip/:ip", statsHandler.GetIPInfo)
 				adminGroup.POST("/stats/ip/:ip/block", statsHandler.BlockIP)
 				adminGroup.DELETE("/stats/ip/:ip/block", statsHandler.UnblockIP)
 				
+				adminGroup.GET("/ip-ranges", ipRangeHandler.ListIPRanges)
+				adminGroup.POST("/ip-ranges", ipRangeHandler.CreateIPRanges)
+				adminGroup.POST("/ip-ranges/import", ipRangeHandler.ImportIPRanges)
+				adminGroup.DELETE("/ip-ranges/:id", ipRangeHandler.DeleteIPRange)
+				adminGroup.GET("/ip-ranges/check/:ip", ipRangeHandler.CheckIP)
+				
 				adminGroup.GET("/monitor/alerts", monitorHandler.GetActiveAlerts)
 				adminGroup.POST("/monitor/alerts/:id/acknowledge", monitorHandler.AcknowledgeAlert)
 				adminGroup.POST("/monitor/alerts/:id/resolve", monitorHandler.ResolveAlert)
@@ -136,14 +192,33 @@ func main() {
 	go monitorService.StartMonitoring(monitorCtx)
 	log.Println("Monitoring service started")
 	
+	// Start link scheduler
+	linkScheduler := services.NewLinkScheduler(db, redisClient)
+	go linkScheduler.Start(monitorCtx)
+	
+	// Archive finished cap periods before their counters expire
+	capArchiver := services.NewCapArchiver(db, redisClient)
+	go capArchiver.Start(monitorCtx)
+	
+	// Keep the IP range lists in line with the other instances
+	go ipRanges.Start(monitorCtx)
+	
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler: router,
 	}
 	
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on port %d: %v", cfg.Server.Port, err)
+	}
+	if cfg.ClientIP.ProxyProtocol {
+		listener = clientIPs.ProxyListener(listener)
+	}
+	
 	go func() {
 		log.Printf("Server starting on port %d", cfg.Server.Port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
@@ -7,11 +7,13 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 	
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 	
+	"github.com/raoxb/smart_redirect/internal/config"
 	"github.com/raoxb/smart_redirect/internal/models"
 	"github.com/raoxb/smart_redirect/internal/services"
 )
@@ -21,9 +23,12 @@ type BatchHandler struct {
 	db          *gorm.DB
 }
 
-func NewBatchHandler(db *gorm.DB, redis *redis.Client) *BatchHandler {
+func NewBatchHandler(db *gorm.DB, redis *redis.Client, linkIDs config.LinkIDConfig) *BatchHandler {
+	linkService := services.NewLinkService(db, redis)
+	linkService.SetLinkIDConfig(linkIDs)
+	
 	return &BatchHandler{
-		linkService: services.NewLinkService(db, redis),
+		linkService: linkService,
 		db:          db,
 	}
 }
@@ -33,11 +38,20 @@ type BatchCreateLinksRequest struct {
 }
 
 type BatchLinkItem struct {
-	BusinessUnit string              `json:"business_unit" binding:"required"`
-	Network      string              `json:"network" binding:"required"`
-	TotalCap     int                 `json:"total_cap"`
-	BackupURL    string              `json:"backup_url"`
-	Targets      []BatchTargetItem   `json:"targets" binding:"required"`
+	// LinkID is an optional custom ID.
+	LinkID            string `json:"link_id"`
+	BusinessUnit      string `json:"business_unit" binding:"required"`
+	Network           string `json:"network" binding:"required"`
+	TotalCap          int    `json:"total_cap"`
+	BackupURL         string `json:"backup_url"`
+	SelectionStrategy string `json:"selection_strategy"`
+	LinkLimits
+	LinkFlight
+	LinkPreview
+	// RateLimitTargetIndex is the index in Targets of the target used by the
+	// "target" rate limit action.
+	RateLimitTargetIndex int               `json:"rate_limit_target_index"`
+	Targets              []BatchTargetItem `json:"targets" binding:"required"`
 }
 
 type BatchTargetItem struct {
@@ -47,6 +61,7 @@ type BatchTargetItem struct {
 	Countries    []string          `json:"countries"`
 	ParamMapping map[string]string `json:"param_mapping"`
 	StaticParams map[string]string `json:"static_params"`
+	TargetRules
 }
 
 type BatchResponse struct {
@@ -78,12 +93,64 @@ func (h *BatchHandler) BatchCreateLinks(c *gin.Context) {
 	}
 	
 	for i, linkItem := range req.Links {
+		if !services.IsValidSelectionStrategy(linkItem.SelectionStrategy) {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Unknown selection strategy: %s", linkItem.SelectionStrategy),
+			})
+			continue
+		}
+		
+		err := linkItem.LinkLimits.Validate()
+		if err == nil {
+			err = linkItem.validateTargetIndex(linkItem.RateLimitTargetIndex, len(linkItem.Targets))
+		}
+		if err == nil {
+			err = linkItem.validateFallbackCountries(h.linkService.CountryGroups())
+		}
+		if err != nil {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Invalid limits: %v", err),
+			})
+			continue
+		}
+		
+		if err := linkItem.LinkFlight.Validate(); err != nil {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Invalid flight: %v", err),
+			})
+			continue
+		}
+		
+		if err := linkItem.LinkPreview.Validate(); err != nil {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Invalid preview: %v", err),
+			})
+			continue
+		}
+		
+		if err := h.validateBatchTargets(linkItem.Targets); err != nil {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Invalid target: %v", err),
+			})
+			continue
+		}
+		
 		link := &models.Link{
-			BusinessUnit: linkItem.BusinessUnit,
-			Network:      linkItem.Network,
-			TotalCap:     linkItem.TotalCap,
-			BackupURL:    linkItem.BackupURL,
+			LinkID:            linkItem.LinkID,
+			BusinessUnit:      linkItem.BusinessUnit,
+			Network:           linkItem.Network,
+			TotalCap:          linkItem.TotalCap,
+			BackupURL:         linkItem.BackupURL,
+			SelectionStrategy: linkItem.SelectionStrategy,
 		}
+		linkItem.LinkLimits.applyTo(link)
+		linkItem.LinkFlight.applyTo(link)
+		linkItem.LinkPreview.applyTo(link)
 		
 		if err := h.linkService.CreateLink(link); err != nil {
 			response.Errors = append(response.Errors, BatchError{
@@ -94,7 +161,7 @@ func (h *BatchHandler) BatchCreateLinks(c *gin.Context) {
 		}
 		
 		hasError := false
-		for _, targetItem := range linkItem.Targets {
+		for j, targetItem := range linkItem.Targets {
 			paramMapping, _ := json.Marshal(targetItem.ParamMapping)
 			staticParams, _ := json.Marshal(targetItem.StaticParams)
 			countries := ""
@@ -112,6 +179,7 @@ func (h *BatchHandler) BatchCreateLinks(c *gin.Context) {
 				ParamMapping: string(paramMapping),
 				StaticParams: string(staticParams),
 			}
+			_ = targetItem.applyTo(target) // checked by validateBatchTargets
 			
 			if err := h.db.Create(target).Error; err != nil {
 				response.Errors = append(response.Errors, BatchError{
@@ -121,6 +189,20 @@ func (h *BatchHandler) BatchCreateLinks(c *gin.Context) {
 				hasError = true
 				break
 			}
+			
+			if link.RateLimitAction == models.RateLimitTarget && j == linkItem.RateLimitTargetIndex {
+				link.RateLimitTargetID = target.ID
+			}
+		}
+		
+		if !hasError && link.RateLimitTargetID != 0 {
+			if err := h.db.Model(link).Update("rate_limit_target_id", link.RateLimitTargetID).Error; err != nil {
+				response.Errors = append(response.Errors, BatchError{
+					Index:   i,
+					Message: fmt.Sprintf("Failed to update link: %v", err),
+				})
+				hasError = true
+			}
 		}
 		
 		if !hasError {
@@ -138,15 +220,50 @@ func (h *BatchHandler) BatchCreateLinks(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// validateBatchTargets rejects a link up front so that no half-built link is created.
+func (h *BatchHandler) validateBatchTargets(targets []BatchTargetItem) error {
+	for j, targetItem := range targets {
+		if err := targetItem.Validate(); err != nil {
+			return fmt.Errorf("target %d: %w", j, err)
+		}
+		if err := validateCountries(h.linkService.CountryGroups(), targetItem.Countries, &targetItem.TargetRules); err != nil {
+			return fmt.Errorf("target %d: %w", j, err)
+		}
+		if err := validateMacros(targetItem.URL, targetItem.ParamMapping, targetItem.StaticParams); err != nil {
+			return fmt.Errorf("target %d: %w", j, err)
+		}
+	}
+	return nil
+}
+
 func (h *BatchHandler) BatchUpdateLinks(c *gin.Context) {
 	type BatchUpdateRequest struct {
 		Updates []struct {
-			LinkID       string `json:"link_id" binding:"required"`
-			BusinessUnit string `json:"business_unit"`
-			Network      string `json:"network"`
-			TotalCap     *int   `json:"total_cap"`
-			BackupURL    string `json:"backup_url"`
-			IsActive     *bool  `json:"is_active"`
+			LinkID             string             `json:"link_id" binding:"required"`
+			BusinessUnit       string             `json:"business_unit"`
+			Network            string             `json:"network"`
+			TotalCap           *int               `json:"total_cap"`
+			BackupURL          string             `json:"backup_url"`
+			SelectionStrategy  *string            `json:"selection_strategy"`
+			RateLimit          *int               `json:"rate_limit"`
+			RateLimitWindow    *int               `json:"rate_limit_window"`
+			RateLimitAction    *string            `json:"rate_limit_action"`
+			RateLimitAlgorithm *string            `json:"rate_limit_algorithm"`
+			RateLimitTargetID  *uint              `json:"rate_limit_target_id"`
+			CapPeriod          *string            `json:"cap_period"`
+			CapTimezone        *string            `json:"cap_timezone"`
+			CapPacing          *string            `json:"cap_pacing"`
+			CapPacingCurve     *[]float64         `json:"cap_pacing_curve"`
+			Fallbacks          *[]models.Fallback `json:"fallbacks"`
+			BotAction          *string            `json:"bot_action"`
+			StartsAt           *time.Time         `json:"starts_at"`
+			ExpiresAt          *time.Time         `json:"expires_at"`
+			ExpiryAction       *string            `json:"expiry_action"`
+			ExpiryURL          *string            `json:"expiry_url"`
+			PreviewTitle       *string            `json:"preview_title"`
+			PreviewDescription *string            `json:"preview_description"`
+			PreviewImage       *string            `json:"preview_image"`
+			IsActive           *bool              `json:"is_active"`
 		} `json:"updates" binding:"required"`
 	}
 	
@@ -183,6 +300,93 @@ func (h *BatchHandler) BatchUpdateLinks(c *gin.Context) {
 		if update.BackupURL != "" {
 			link.BackupURL = update.BackupURL
 		}
+		if update.SelectionStrategy != nil {
+			if !services.IsValidSelectionStrategy(*update.SelectionStrategy) {
+				response.Errors = append(response.Errors, BatchError{
+					Index:   i,
+					Message: fmt.Sprintf("Unknown selection strategy: %s", *update.SelectionStrategy),
+				})
+				continue
+			}
+			link.SelectionStrategy = *update.SelectionStrategy
+		}
+		if update.RateLimit != nil {
+			link.RateLimit = *update.RateLimit
+		}
+		if update.RateLimitWindow != nil {
+			link.RateLimitWindow = *update.RateLimitWindow
+		}
+		if update.RateLimitAction != nil {
+			link.RateLimitAction = *update.RateLimitAction
+		}
+		if update.RateLimitAlgorithm != nil {
+			link.RateLimitAlgorithm = *update.RateLimitAlgorithm
+		}
+		if update.RateLimitTargetID != nil {
+			link.RateLimitTargetID = *update.RateLimitTargetID
+		}
+		if update.CapPeriod != nil {
+			link.CapPeriod = *update.CapPeriod
+		}
+		if update.CapTimezone != nil {
+			link.CapTimezone = *update.CapTimezone
+		}
+		if update.CapPacing != nil {
+			link.CapPacing = *update.CapPacing
+		}
+		if update.CapPacingCurve != nil {
+			link.CapPacingCurve = marshalCurve(*update.CapPacingCurve)
+		}
+		if update.Fallbacks != nil {
+			link.Fallbacks = marshalFallbacks(*update.Fallbacks)
+		}
+		if update.BotAction != nil {
+			link.BotAction = *update.BotAction
+		}
+		if update.StartsAt != nil {
+			link.StartsAt = update.StartsAt
+		}
+		if update.ExpiresAt != nil {
+			link.ExpiresAt = update.ExpiresAt
+		}
+		if update.ExpiryAction != nil {
+			link.ExpiryAction = *update.ExpiryAction
+		}
+		if update.ExpiryURL != nil {
+			link.ExpiryURL = *update.ExpiryURL
+		}
+		if update.PreviewTitle != nil {
+			link.PreviewTitle = *update.PreviewTitle
+		}
+		if update.PreviewDescription != nil {
+			link.PreviewDescription = *update.PreviewDescription
+		}
+		if update.PreviewImage != nil {
+			link.PreviewImage = *update.PreviewImage
+		}
+		preview := previewOf(&link)
+		if err := preview.Validate(); err != nil {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Invalid preview: %v", err),
+			})
+			continue
+		}
+		flight := flightOf(&link)
+		if err := flight.Validate(); err != nil {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Invalid flight: %v", err),
+			})
+			continue
+		}
+		if err := h.validateLinkLimits(&link); err != nil {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Invalid limits: %v", err),
+			})
+			continue
+		}
 		if update.IsActive != nil {
 			link.IsActive = *update.IsActive
 		}
@@ -204,6 +408,34 @@ func (h *BatchHandler) BatchUpdateLinks(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// validateLinkLimits checks the rate limit settings of an updated link.
+func (h *BatchHandler) validateLinkLimits(link *models.Link) error {
+	limits := LinkLimits{
+		RateLimit:          link.RateLimit,
+		RateLimitWindow:    link.RateLimitWindow,
+		RateLimitAction:    link.RateLimitAction,
+		RateLimitAlgorithm: link.RateLimitAlgorithm,
+		CapPeriod:          link.CapPeriod,
+		CapTimezone:        link.CapTimezone,
+		CapPacing:          link.CapPacing,
+		CapPacingCurve:     models.ParsePacingCurve(link.CapPacingCurve),
+		Fallbacks:          link.GetFallbacks(),
+		BotAction:          link.BotAction,
+	}
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	if err := limits.validateFallbackCountries(h.linkService.CountryGroups()); err != nil {
+		return err
+	}
+	
+	var targets []models.Target
+	if err := h.db.Where("link_id = ?", link.ID).Find(&targets).Error; err != nil {
+		return fmt.Errorf("failed to fetch targets: %w", err)
+	}
+	return validateLimitTarget(link, targets)
+}
+
 func (h *BatchHandler) BatchDeleteLinks(c *gin.Context) {
 	type BatchDeleteRequest struct {
 		LinkIDs []string `json:"link_ids" binding:"required"`
@@ -293,6 +525,19 @@ func (h *BatchHandler) ImportLinksFromCSV(c *gin.Context) {
 		}
 	}
 	
+	// Optional targeting columns are located by name and may appear in any order
+	columnIndex := make(map[string]int)
+	for idx, header := range headers {
+		columnIndex[strings.TrimSpace(strings.ToLower(header))] = idx
+	}
+	optionalList := func(record []string, name string) []string {
+		idx, ok := columnIndex[name]
+		if !ok || idx >= len(record) {
+			return nil
+		}
+		return splitCSVList(record[idx])
+	}
+	
 	for i, record := range records[1:] {
 		if len(record) < len(expectedHeaders) {
 			response.Errors = append(response.Errors, BatchError{
@@ -302,6 +547,29 @@ func (h *BatchHandler) ImportLinksFromCSV(c *gin.Context) {
 			continue
 		}
 		
+		countryList := splitCSVList(record[7])
+		rules := TargetRules{
+			ExcludedCountries: optionalList(record, "excluded_countries"),
+			Regions:           optionalList(record, "regions"),
+			ExcludedRegions:   optionalList(record, "excluded_regions"),
+			Cities:            optionalList(record, "cities"),
+			ExcludedCities:    optionalList(record, "excluded_cities"),
+		}
+		err := rules.Validate()
+		if err == nil {
+			err = validateCountries(h.linkService.CountryGroups(), countryList, &rules)
+		}
+		if err == nil {
+			err = validateMacros(strings.TrimSpace(record[4]), nil, nil)
+		}
+		if err != nil {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Invalid target: %v", err),
+			})
+			continue
+		}
+		
 		totalCap, _ := strconv.Atoi(strings.TrimSpace(record[2]))
 		weight, _ := strconv.Atoi(strings.TrimSpace(record[5]))
 		cap, _ := strconv.Atoi(strings.TrimSpace(record[6]))
@@ -322,8 +590,7 @@ func (h *BatchHandler) ImportLinksFromCSV(c *gin.Context) {
 		}
 		
 		countries := ""
-		if strings.TrimSpace(record[7]) != "" {
-			countryList := strings.Split(strings.TrimSpace(record[7]), ";")
+		if len(countryList) > 0 {
 			countriesJSON, _ := json.Marshal(countryList)
 			countries = string(countriesJSON)
 		}
@@ -335,6 +602,7 @@ func (h *BatchHandler) ImportLinksFromCSV(c *gin.Context) {
 			Cap:       cap,
 			Countries: countries,
 		}
+		_ = rules.applyTo(target)
 		
 		if err := h.db.Create(target).Error; err != nil {
 			response.Errors = append(response.Errors, BatchError{
@@ -370,7 +638,8 @@ func (h *BatchHandler) ExportLinksToCSV(c *gin.Context) {
 	writer := csv.NewWriter(c.Writer)
 	defer writer.Flush()
 	
-	headers := []string{"link_id", "business_unit", "network", "total_cap", "backup_url", "target_url", "weight", "cap", "countries", "current_hits"}
+	headers := []string{"link_id", "business_unit", "network", "total_cap", "backup_url", "target_url", "weight", "cap", "countries", "current_hits",
+		"excluded_countries", "regions", "excluded_regions", "cities", "excluded_cities"}
 	writer.Write(headers)
 	
 	for _, link := range links {
@@ -394,8 +663,29 @@ func (h *BatchHandler) ExportLinksToCSV(c *gin.Context) {
 				strconv.Itoa(target.Cap),
 				countries,
 				strconv.Itoa(link.CurrentHits),
+				joinCSVList(target.ExcludedCountries),
+				joinCSVList(target.Regions),
+				joinCSVList(target.ExcludedRegions),
+				joinCSVList(target.Cities),
+				joinCSVList(target.ExcludedCities),
 			}
 			writer.Write(record)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// splitCSVList splits a semicolon separated CSV cell, as used for countries.
+func splitCSVList(cell string) []string {
+	var list []string
+	for _, item := range strings.Split(cell, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// joinCSVList renders a JSON array column as a semicolon separated CSV cell.
+func joinCSVList(raw string) string {
+	return strings.Join(models.ParseStringList(raw), ";")
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/internal/services"
+)
+
+type CountryGroupHandler struct {
+	countryGroups *services.CountryGroupService
+}
+
+func NewCountryGroupHandler(db *gorm.DB, redis *redis.Client) *CountryGroupHandler {
+	return &CountryGroupHandler{
+		countryGroups: services.NewCountryGroupService(db, redis),
+	}
+}
+
+type CountryGroupRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Countries   []string `json:"countries" binding:"required,min=1"`
+}
+
+type CountryGroupResponse struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Countries   []string `json:"countries"`
+}
+
+func toCountryGroupResponse(group *models.CountryGroup) CountryGroupResponse {
+	return CountryGroupResponse{
+		ID:          group.ID,
+		Name:        group.Name,
+		Description: group.Description,
+		Countries:   group.CountryList(),
+	}
+}
+
+func (h *CountryGroupHandler) ListCountryGroups(c *gin.Context) {
+	groups, err := h.countryGroups.ListGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch country groups"})
+		return
+	}
+
+	responses := make([]CountryGroupResponse, len(groups))
+	for i := range groups {
+		responses[i] = toCountryGroupResponse(&groups[i])
+	}
+
+	c.JSON(http.StatusOK, responses)
+}
+
+func (h *CountryGroupHandler) GetCountryGroup(c *gin.Context) {
+	group, err := h.countryGroups.GetGroup(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	if group == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "country group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toCountryGroupResponse(group))
+}
+
+func (h *CountryGroupHandler) CreateCountryGroup(c *gin.Context) {
+	var req CountryGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, _ := h.countryGroups.GetGroup(req.Name)
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "country group already exists"})
+		return
+	}
+
+	group := &models.CountryGroup{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+
+	if err := h.countryGroups.SaveGroup(group, req.Countries); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCountryGroupResponse(group))
+}
+
+func (h *CountryGroupHandler) UpdateCountryGroup(c *gin.Context) {
+	group, err := h.countryGroups.GetGroup(c.Param("name"))
+	if err != nil || group == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "country group not found"})
+		return
+	}
+
+	var req CountryGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(req.Name), group.Name) && h.respondIfReferenced(c, group.Name) {
+		return
+	}
+
+	group.Name = req.Name
+	group.Description = req.Description
+
+	if err := h.countryGroups.SaveGroup(group, req.Countries); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toCountryGroupResponse(group))
+}
+
+func (h *CountryGroupHandler) DeleteCountryGroup(c *gin.Context) {
+	if h.respondIfReferenced(c, c.Param("name")) {
+		return
+	}
+
+	deleted, err := h.countryGroups.DeleteGroup(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete country group"})
+		return
+	}
+
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "country group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "country group deleted successfully"})
+}
+
+// respondIfReferenced responds 409, and reports true, when targets,
+// fallbacks or templates still use the group: renaming or deleting it
+// would silently change who they match.
+func (h *CountryGroupHandler) respondIfReferenced(c *gin.Context, name string) bool {
+	refs, err := h.countryGroups.References(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check country group references"})
+		return true
+	}
+	if len(refs) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "country group is in use", "references": refs})
+		return true
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/internal/services"
+)
+
+// maxIPRangeUpload bounds the size of an uploaded list.
+const maxIPRangeUpload = 10 << 20
+
+type IPRangeHandler struct {
+	ipRanges *services.IPRangeService
+}
+
+func NewIPRangeHandler(ipRanges *services.IPRangeService) *IPRangeHandler {
+	return &IPRangeHandler{
+		ipRanges: ipRanges,
+	}
+}
+
+type IPRangeRequest struct {
+	// CIDRs are IPv4 or IPv6 prefixes or single addresses.
+	CIDRs     []string   `json:"cidrs" binding:"required,min=1"`
+	List      string     `json:"list" binding:"required"`
+	Source    string     `json:"source"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (h *IPRangeHandler) ListIPRanges(c *gin.Context) {
+	entries, err := h.ipRanges.List(c.Query("list"), c.Query("source"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch ip ranges"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+func (h *IPRangeHandler) CreateIPRanges(c *gin.Context) {
+	var req IPRangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	entries := make([]models.IPRange, len(req.CIDRs))
+	for i, cidr := range req.CIDRs {
+		entries[i] = models.IPRange{
+			CIDR:      cidr,
+			List:      req.List,
+			Source:    req.Source,
+			Reason:    req.Reason,
+			ExpiresAt: req.ExpiresAt,
+		}
+	}
+	if err := h.ipRanges.Save(c.Request.Context(), entries); err != nil {
+		if errors.Is(err, services.ErrInvalidIPRange) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save ip ranges"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"saved": len(entries)})
+}
+
+// ImportIPRanges adds the CIDRs of an uploaded file, one per line with '#'
+// comments, to a list. Form fields: list, source, reason, expires_in
+// (hours) and replace, which removes the entries of the source that are
+// not in the file.
+func (h *IPRangeHandler) ImportIPRanges(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+	if header.Size > maxIPRangeUpload {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("file must be at most %d bytes", maxIPRangeUpload)})
+		return
+	}
+
+	template := models.IPRange{
+		List:   c.PostForm("list"),
+		Source: c.PostForm("source"),
+		Reason: c.PostForm("reason"),
+	}
+	if template.Source == "" {
+		template.Source = header.Filename
+	}
+	if hours := c.PostForm("expires_in"); hours != "" {
+		n, err := strconv.Atoi(hours)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in must be a positive number of hours"})
+			return
+		}
+		expiresAt := time.Now().Add(time.Duration(n) * time.Hour)
+		template.ExpiresAt = &expiresAt
+	}
+	replace := c.PostForm("replace") == "true"
+
+	count, err := h.ipRanges.Import(c.Request.Context(), file, template, replace)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidIPRange) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to import ip ranges"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"imported": count,
+		"list":     template.List,
+		"source":   template.Source,
+		"replaced": replace,
+	})
+}
+
+func (h *IPRangeHandler) DeleteIPRange(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ip range ID"})
+		return
+	}
+
+	if err := h.ipRanges.Delete(c.Request.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ip range not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete ip range"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "ip range deleted successfully"})
+}
+
+// CheckIP returns the entry an IP matches, if any.
+func (h *IPRangeHandler) CheckIP(c *gin.Context) {
+	ip := c.Param("ip")
+	blocked, entry := h.ipRanges.IsBlocked(ip)
+	c.JSON(http.StatusOK, gin.H{
+		"ip":       ip,
+		"blocked":  blocked,
+		"ip_range": entry,
+	})
+}
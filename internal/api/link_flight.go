@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+// LinkFlight holds a link's flight dates and what its visitors get once it
+// has expired. Unset dates are open-ended.
+type LinkFlight struct {
+	StartsAt  *time.Time `json:"starts_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ExpiryAction is one of the models.Expiry* actions; empty responds 404.
+	ExpiryAction string `json:"expiry_action,omitempty"`
+	ExpiryURL    string `json:"expiry_url,omitempty"`
+}
+
+// Validate checks the flight without touching a link.
+func (f *LinkFlight) Validate() error {
+	if err := models.ValidateFlight(f.StartsAt, f.ExpiresAt); err != nil {
+		return err
+	}
+	return models.ValidateExpiry(f.ExpiryAction, f.ExpiryURL)
+}
+
+// applyTo stores the flight on the link.
+func (f *LinkFlight) applyTo(link *models.Link) {
+	link.StartsAt = f.StartsAt
+	link.ExpiresAt = f.ExpiresAt
+	link.ExpiryAction = f.ExpiryAction
+	link.ExpiryURL = f.ExpiryURL
+}
+
+// flightOverrides reads the flight from template overrides, where dates are
+// RFC 3339 strings.
+func flightOverrides(overrides map[string]interface{}) (LinkFlight, error) {
+	var flight LinkFlight
+	for key, date := range map[string]**time.Time{
+		"starts_at":  &flight.StartsAt,
+		"expires_at": &flight.ExpiresAt,
+	} {
+		value, ok := overrides[key].(string)
+		if !ok {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return flight, fmt.Errorf("%s must be an RFC 3339 time", key)
+		}
+		*date = &parsed
+	}
+	flight.ExpiryAction, _ = overrides["expiry_action"].(string)
+	flight.ExpiryURL, _ = overrides["expiry_url"].(string)
+	return flight, nil
+}
+
+// flightOf returns the flight stored on a link.
+func flightOf(link *models.Link) LinkFlight {
+	return LinkFlight{
+		StartsAt:     link.StartsAt,
+		ExpiresAt:    link.ExpiresAt,
+		ExpiryAction: link.ExpiryAction,
+		ExpiryURL:    link.ExpiryURL,
+	}
+}
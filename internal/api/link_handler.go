@@ -2,6 +2,8 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	
@@ -9,6 +11,7 @@ import (
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 	
+	"github.com/raoxb/smart_redirect/internal/config"
 	"github.com/raoxb/smart_redirect/internal/models"
 	"github.com/raoxb/smart_redirect/internal/services"
 )
@@ -18,18 +21,31 @@ type LinkHandler struct {
 	db          *gorm.DB
 }
 
-func NewLinkHandler(db *gorm.DB, redis *redis.Client) *LinkHandler {
+func NewLinkHandler(db *gorm.DB, redis *redis.Client, linkIDs config.LinkIDConfig) *LinkHandler {
+	linkService := services.NewLinkService(db, redis)
+	linkService.SetLinkIDConfig(linkIDs)
+	
 	return &LinkHandler{
-		linkService: services.NewLinkService(db, redis),
+		linkService: linkService,
 		db:          db,
 	}
 }
 
 type CreateLinkRequest struct {
+	// LinkID is an optional custom ID for new links; it cannot be changed
+	// by updates.
+	LinkID       string `json:"link_id"`
 	BusinessUnit string `json:"business_unit" binding:"required"`
 	Network      string `json:"network" binding:"required"`
 	TotalCap     int    `json:"total_cap"`
 	BackupURL    string `json:"backup_url"`
+	// SelectionStrategy is one of services.SelectionStrategies; empty uses the default.
+	SelectionStrategy string `json:"selection_strategy"`
+	LinkLimits
+	LinkFlight
+	LinkPreview
+	// RateLimitTargetID is the target used by the "target" rate limit action.
+	RateLimitTargetID uint `json:"rate_limit_target_id"`
 }
 
 type CreateTargetRequest struct {
@@ -39,6 +55,7 @@ type CreateTargetRequest struct {
 	Countries    []string          `json:"countries"`
 	ParamMapping map[string]string `json:"param_mapping"`
 	StaticParams map[string]string `json:"static_params"`
+	TargetRules
 }
 
 func (h *LinkHandler) CreateLink(c *gin.Context) {
@@ -48,14 +65,59 @@ func (h *LinkHandler) CreateLink(c *gin.Context) {
 		return
 	}
 	
+	if req.LinkID != "" {
+		if err := services.ValidateCustomLinkID(req.LinkID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	
+	if !services.IsValidSelectionStrategy(req.SelectionStrategy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown selection strategy %q", req.SelectionStrategy)})
+		return
+	}
+	
+	if err := req.LinkLimits.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validateFallbackCountries(h.linkService.CountryGroups()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.LinkFlight.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.LinkPreview.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
 	link := &models.Link{
-		BusinessUnit: req.BusinessUnit,
-		Network:      req.Network,
-		TotalCap:     req.TotalCap,
-		BackupURL:    req.BackupURL,
+		LinkID:            req.LinkID,
+		BusinessUnit:      req.BusinessUnit,
+		Network:           req.Network,
+		TotalCap:          req.TotalCap,
+		BackupURL:         req.BackupURL,
+		SelectionStrategy: req.SelectionStrategy,
+	}
+	req.LinkLimits.applyTo(link)
+	req.LinkFlight.applyTo(link)
+	req.LinkPreview.applyTo(link)
+	link.RateLimitTargetID = req.RateLimitTargetID
+	
+	// A new link has no targets to send visitors over the limit to
+	if err := validateLimitTarget(link, nil); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	
 	if err := h.linkService.CreateLink(link); err != nil {
+		if errors.Is(err, services.ErrLinkIDTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create link"})
 		return
 	}
@@ -77,6 +139,11 @@ func (h *LinkHandler) GetLink(c *gin.Context) {
 		return
 	}
 	
+	if err := h.linkService.Caps().FillPeriodHits(c.Request.Context(), link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch cap usage"})
+		return
+	}
+	
 	c.JSON(http.StatusOK, link)
 }
 
@@ -95,10 +162,47 @@ func (h *LinkHandler) UpdateLink(c *gin.Context) {
 		return
 	}
 	
+	if !services.IsValidSelectionStrategy(req.SelectionStrategy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown selection strategy %q", req.SelectionStrategy)})
+		return
+	}
+	
+	if err := req.LinkLimits.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validateFallbackCountries(h.linkService.CountryGroups()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.LinkFlight.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.LinkPreview.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
 	link.BusinessUnit = req.BusinessUnit
 	link.Network = req.Network
 	link.TotalCap = req.TotalCap
 	link.BackupURL = req.BackupURL
+	link.SelectionStrategy = req.SelectionStrategy
+	req.LinkLimits.applyTo(&link)
+	req.LinkFlight.applyTo(&link)
+	req.LinkPreview.applyTo(&link)
+	link.RateLimitTargetID = req.RateLimitTargetID
+	
+	var targets []models.Target
+	if err := h.db.Where("link_id = ?", link.ID).Find(&targets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch targets"})
+		return
+	}
+	if err := validateLimitTarget(&link, targets); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	
 	if err := h.db.Save(&link).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update link"})
@@ -149,6 +253,13 @@ func (h *LinkHandler) ListLinks(c *gin.Context) {
 		return
 	}
 	
+	for i := range links {
+		if err := h.linkService.Caps().FillPeriodHits(c.Request.Context(), &links[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch cap usage"})
+			return
+		}
+	}
+	
 	c.JSON(http.StatusOK, gin.H{
 		"total": total,
 		"page":  page,
@@ -190,6 +301,21 @@ func (h *LinkHandler) CreateTarget(c *gin.Context) {
 		StaticParams: string(staticParams),
 	}
 	
+	if err := validateCountries(h.linkService.CountryGroups(), req.Countries, &req.TargetRules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if err := validateMacros(req.URL, req.ParamMapping, req.StaticParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if err := req.applyTo(target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
 	if err := h.db.Create(target).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create target"})
 		return
@@ -215,9 +341,15 @@ func (h *LinkHandler) GetTargets(c *gin.Context) {
 		return
 	}
 	
+	link.Targets = targets
+	if err := h.linkService.Caps().FillPeriodHits(c.Request.Context(), &link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch cap usage"})
+		return
+	}
+	
 	// Convert targets to response format with parsed JSON fields
-	responses := make([]models.TargetResponse, len(targets))
-	for i, target := range targets {
+	responses := make([]models.TargetResponse, len(link.Targets))
+	for i, target := range link.Targets {
 		responses[i] = target.ToResponse()
 	}
 	
@@ -254,6 +386,21 @@ func (h *LinkHandler) UpdateTarget(c *gin.Context) {
 	target.ParamMapping = string(paramMapping)
 	target.StaticParams = string(staticParams)
 	
+	if err := validateCountries(h.linkService.CountryGroups(), req.Countries, &req.TargetRules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if err := validateMacros(req.URL, req.ParamMapping, req.StaticParams); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if err := req.applyTo(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
 	if err := h.db.Save(&target).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update target"})
 		return
@@ -277,4 +424,71 @@ func (h *LinkHandler) DeleteTarget(c *gin.Context) {
 	}
 	
 	c.JSON(http.StatusOK, gin.H{"message": "target deleted successfully"})
-}
\ No newline at end of file
+}
+
+// RecordConversions adds conversions for a target to the counts used by
+// the bandit selection strategies. Only admins and users allowed to edit
+// the target's link may record them.
+func (h *LinkHandler) RecordConversions(c *gin.Context) {
+	targetID := c.Param("target_id")
+	
+	var target models.Target
+	if err := h.db.First(&target, targetID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "target not found"})
+		return
+	}
+	
+	canEdit, err := h.canEditLink(c, target.LinkID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permissions"})
+		return
+	}
+	if !canEdit {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return
+	}
+	
+	var req struct {
+		Count int64 `json:"count"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "count must not be negative"})
+		return
+	}
+	
+	if err := h.linkService.Bandit().RecordConversion(c.Request.Context(), target.ID, req.Count); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record conversions"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{"message": "conversions recorded"})
+}
+
+// canEditLink reports whether the authenticated user is an admin or has
+// been given edit permission on the link.
+func (h *LinkHandler) canEditLink(c *gin.Context, linkID uint) (bool, error) {
+	if role, _ := c.Get("role"); role == "admin" {
+		return true, nil
+	}
+	
+	userID, exists := c.Get("user_id")
+	if !exists {
+		return false, nil
+	}
+	
+	var count int64
+	err := h.db.Model(&models.LinkPermission{}).
+		Where("user_id = ? AND link_id = ? AND can_edit = ?", userID, linkID, true).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/internal/services"
+)
+
+// LinkLimits holds the per-link rate limit overrides, cap settings and
+// fallback chain accepted by the link, batch and template endpoints. Zero
+// values use the configured defaults.
+// The target used by the "target" action is given by ID on existing links
+// and by its index in the request's targets where targets are created with
+// the link.
+type LinkLimits struct {
+	// RateLimit is the number of visits allowed per IP within RateLimitWindow.
+	RateLimit int `json:"rate_limit,omitempty"`
+	// RateLimitWindow is in seconds.
+	RateLimitWindow int    `json:"rate_limit_window,omitempty"`
+	RateLimitAction string `gorm:"size:20" json:"rate_limit_action,omitempty"`
+	// RateLimitAlgorithm is one of services.RateLimitAlgorithms; empty uses
+	// the configured algorithm.
+	RateLimitAlgorithm string `gorm:"size:20" json:"rate_limit_algorithm,omitempty"`
+	// CapPeriod decides when TotalCap starts over, in CapTimezone.
+	CapPeriod   string `gorm:"size:20" json:"cap_period,omitempty"`
+	CapTimezone string `gorm:"size:50" json:"cap_timezone,omitempty"`
+	// CapPacing spreads a periodic TotalCap over its period, following
+	// CapPacingCurve (24 hourly shares) in the curve mode.
+	CapPacing      string    `gorm:"size:20" json:"cap_pacing,omitempty"`
+	CapPacingCurve []float64 `gorm:"serializer:json" json:"cap_pacing_curve,omitempty"`
+	// Fallbacks are tried in order before BackupURL when a visitor cannot
+	// be sent to a target.
+	Fallbacks []models.Fallback `gorm:"serializer:json" json:"fallbacks,omitempty"`
+	// BotAction is one of the models.Bot* actions; empty uses the
+	// configured default.
+	BotAction string `gorm:"size:20" json:"bot_action,omitempty"`
+}
+
+// Validate checks the limits without touching a link.
+func (l *LinkLimits) Validate() error {
+	if l.RateLimit < 0 {
+		return fmt.Errorf("rate_limit must not be negative")
+	}
+	if l.RateLimitWindow < 0 {
+		return fmt.Errorf("rate_limit_window must not be negative")
+	}
+	if !models.IsValidRateLimitAction(l.RateLimitAction) {
+		return fmt.Errorf("unknown rate limit action %q", l.RateLimitAction)
+	}
+	if !services.IsValidRateLimitAlgorithm(l.RateLimitAlgorithm) {
+		return fmt.Errorf("unknown rate limit algorithm %q", l.RateLimitAlgorithm)
+	}
+	if !models.IsValidCapPeriod(l.CapPeriod) {
+		return fmt.Errorf("unknown cap period %q", l.CapPeriod)
+	}
+	if err := models.ValidateCapTimezone(l.CapTimezone); err != nil {
+		return err
+	}
+	if err := models.ValidateCapPacing(l.CapPacing, l.CapPeriod, l.CapPacingCurve); err != nil {
+		return err
+	}
+	if err := models.ValidateFallbacks(l.Fallbacks); err != nil {
+		return err
+	}
+	if !models.IsValidBotAction(l.BotAction) {
+		return fmt.Errorf("unknown bot action %q", l.BotAction)
+	}
+	return nil
+}
+
+// validateFallbackCountries checks that the fallbacks are scoped by country
+// codes, ALL or existing country groups.
+func (l *LinkLimits) validateFallbackCountries(groups *services.CountryGroupService) error {
+	for i, fallback := range l.Fallbacks {
+		if err := groups.ValidateCountries(fallback.Countries); err != nil {
+			return fmt.Errorf("fallback %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateTargetIndex checks the index of the target used by the "target"
+// action among the targets created with the link.
+func (l *LinkLimits) validateTargetIndex(index int, count int) error {
+	if l.RateLimitAction == models.RateLimitTarget && (index < 0 || index >= count) {
+		return fmt.Errorf("rate_limit_target_index %d is out of range", index)
+	}
+	return nil
+}
+
+// applyTo stores the limits on the link.
+func (l *LinkLimits) applyTo(link *models.Link) {
+	link.RateLimit = l.RateLimit
+	link.RateLimitWindow = l.RateLimitWindow
+	link.RateLimitAction = l.RateLimitAction
+	link.RateLimitAlgorithm = l.RateLimitAlgorithm
+	link.CapPeriod = l.CapPeriod
+	link.CapTimezone = l.CapTimezone
+	link.CapPacing = l.CapPacing
+	link.CapPacingCurve = marshalCurve(l.CapPacingCurve)
+	link.Fallbacks = marshalFallbacks(l.Fallbacks)
+	link.BotAction = l.BotAction
+}
+
+// marshalFallbacks stores a fallback chain as a JSON array with upper-case
+// countries, or an empty string when there is none.
+func marshalFallbacks(fallbacks []models.Fallback) string {
+	if len(fallbacks) == 0 {
+		return ""
+	}
+	stored := make([]models.Fallback, len(fallbacks))
+	for i, fallback := range fallbacks {
+		stored[i] = fallback
+		stored[i].Countries = upperList(fallback.Countries)
+	}
+	data, _ := json.Marshal(stored)
+	return string(data)
+}
+
+// marshalCurve stores a pacing curve as a JSON array, or an empty string
+// when there is none.
+func marshalCurve(curve []float64) string {
+	if len(curve) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(curve)
+	return string(data)
+}
+
+// validateLimitTarget checks that a link sending visitors over its limit to
+// a target designates one of its own targets.
+func validateLimitTarget(link *models.Link, targets []models.Target) error {
+	if link.RateLimitAction != models.RateLimitTarget {
+		return nil
+	}
+	for _, target := range targets {
+		if target.ID == link.RateLimitTargetID {
+			return nil
+		}
+	}
+	return fmt.Errorf("rate_limit_target_id must be a target of the link")
+}
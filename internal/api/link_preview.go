@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+// LinkPreview is the Open Graph preview served to link preview crawlers
+// instead of redirecting them.
+type LinkPreview struct {
+	PreviewTitle       string `json:"preview_title,omitempty"`
+	PreviewDescription string `json:"preview_description,omitempty"`
+	// PreviewImage is an http or https URL of the preview image.
+	PreviewImage string `json:"preview_image,omitempty"`
+}
+
+// Validate checks the preview without touching a link.
+func (p *LinkPreview) Validate() error {
+	if utf8.RuneCountInString(p.PreviewTitle) > 200 {
+		return fmt.Errorf("preview_title must be at most 200 characters")
+	}
+	if utf8.RuneCountInString(p.PreviewDescription) > 500 {
+		return fmt.Errorf("preview_description must be at most 500 characters")
+	}
+	if p.PreviewImage != "" {
+		u, err := url.Parse(p.PreviewImage)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("preview_image must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// applyTo stores the preview on the link.
+func (p *LinkPreview) applyTo(link *models.Link) {
+	link.PreviewTitle = p.PreviewTitle
+	link.PreviewDescription = p.PreviewDescription
+	link.PreviewImage = p.PreviewImage
+}
+
+// previewOf returns the preview stored on a link.
+func previewOf(link *models.Link) LinkPreview {
+	return LinkPreview{
+		PreviewTitle:       link.PreviewTitle,
+		PreviewDescription: link.PreviewDescription,
+		PreviewImage:       link.PreviewImage,
+	}
+}
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta property="og:type" content="website">
+<meta property="og:url" content="{{.URL}}">
+<meta property="og:title" content="{{.Title}}">
+{{- if .Description}}
+<meta name="description" content="{{.Description}}">
+<meta property="og:description" content="{{.Description}}">
+{{- end}}
+{{- if .Image}}
+<meta property="og:image" content="{{.Image}}">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:image" content="{{.Image}}">
+{{- else}}
+<meta name="twitter:card" content="summary">
+{{- end}}
+<meta name="twitter:title" content="{{.Title}}">
+<meta name="robots" content="noindex">
+</head>
+<body></body>
+</html>
+`))
+
+// servePreview responds with the link's Open Graph page, giving the link's
+// URL under baseURL. Links without a title are previewed under their ID.
+func servePreview(c *gin.Context, link *models.Link, baseURL string) {
+	title := link.PreviewTitle
+	if title == "" {
+		title = link.LinkID
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Status(http.StatusOK)
+	_ = previewPage.Execute(c.Writer, struct {
+		URL, Title, Description, Image string
+	}{
+		URL:         link.PublicURL(baseURL),
+		Title:       title,
+		Description: link.PreviewDescription,
+		Image:       link.PreviewImage,
+	})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	
+	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/pkg/clientip"
+)
+
+type PostbackHandler struct {
+	conversionService *services.ConversionService
+	auth              *services.PostbackAuth
+	clientIPs         *clientip.Resolver
+}
+
+// NewPostbackHandler creates a handler accepting the postbacks that auth
+// lets through.
+func NewPostbackHandler(db *gorm.DB, redis *redis.Client, auth *services.PostbackAuth, clientIPs *clientip.Resolver) *PostbackHandler {
+	return &PostbackHandler{
+		conversionService: services.NewConversionService(db, redis),
+		auth:              auth,
+		clientIPs:         clientIPs,
+	}
+}
+
+// HandlePostback records a conversion reported by a network. Parameters can
+// be sent in the query string or, for POST, as a form body. The postback
+// is checked against the network's secret and allowed IPs first.
+func (h *PostbackHandler) HandlePostback(c *gin.Context) {
+	network := postbackParam(c, "network")
+	ip := h.clientIPs.ClientIP(c.Request)
+	if err := h.auth.Verify(network, postbackParam(c, "token"), ip); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	
+	clickID := postbackParam(c, "click_id")
+	if clickID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "click_id is required"})
+		return
+	}
+	
+	var payout float64
+	if raw := postbackParam(c, "payout"); raw != "" {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payout"})
+			return
+		}
+		payout = value
+	}
+	
+	conversion, err := h.conversionService.RecordPostback(c.Request.Context(), &services.Postback{
+		Network:       network,
+		ClickID:       clickID,
+		TransactionID: postbackParam(c, "txid"),
+		Payout:        payout,
+		Status:        strings.ToLower(postbackParam(c, "status")),
+		IP:            ip,
+	})
+	switch {
+	case errors.Is(err, services.ErrUnknownClick):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidConversionStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record conversion"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, conversion)
+}
+
+func postbackParam(c *gin.Context, name string) string {
+	if value := c.PostForm(name); value != "" {
+		return value
+	}
+	return c.Query(name)
+}
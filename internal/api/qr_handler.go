@@ -0,0 +1,214 @@
+package api
+
+import (
+	"archive/zip"
+	"fmt"
+	"net/http"
+	"strings"
+	
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/pkg/clientip"
+	"github.com/raoxb/smart_redirect/pkg/qrcode"
+)
+
+// maxQRExport bounds the number of codes in one ZIP export.
+const maxQRExport = 500
+
+type QRHandler struct {
+	db        *gorm.DB
+	publicURL string
+	clientIPs *clientip.Resolver
+}
+
+// NewQRHandler creates a handler encoding links under publicURL or, when it
+// is empty, the host of the request, reading the scheme from the
+// X-Forwarded-Proto header of the proxies trusted by clientIPs.
+func NewQRHandler(db *gorm.DB, publicURL string, clientIPs *clientip.Resolver) *QRHandler {
+	return &QRHandler{
+		db:        db,
+		publicURL: publicURL,
+		clientIPs: clientIPs,
+	}
+}
+
+// QROptions are the rendering options accepted in the query string of the
+// single code endpoint and in the body of the export. Empty fields use
+// qrcode.DefaultOptions.
+type QROptions struct {
+	// Format is "png" (default) or "svg".
+	Format     string `form:"format" json:"format"`
+	Size       int    `form:"size" json:"size"`
+	Level      string `form:"level" json:"level"`
+	Margin     *int   `form:"margin" json:"margin"`
+	Foreground string `form:"fg" json:"fg"`
+	Background string `form:"bg" json:"bg"`
+}
+
+// options validates the request and returns the format and render options.
+func (r *QROptions) options() (string, qrcode.Options, error) {
+	opts := qrcode.DefaultOptions()
+	format := strings.ToLower(r.Format)
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		return "", opts, fmt.Errorf("format must be png or svg")
+	}
+	
+	if r.Size != 0 {
+		opts.Size = r.Size
+	}
+	if r.Level != "" {
+		opts.Level = strings.ToUpper(r.Level)
+	}
+	if r.Margin != nil {
+		opts.Margin = *r.Margin
+	}
+	var err error
+	if r.Foreground != "" {
+		if opts.Foreground, err = qrcode.ParseColor(r.Foreground); err != nil {
+			return "", opts, err
+		}
+	}
+	if r.Background != "" {
+		if opts.Background, err = qrcode.ParseColor(r.Background); err != nil {
+			return "", opts, err
+		}
+	}
+	return format, opts, opts.Validate()
+}
+
+// GetLinkQR renders a QR code of the link's public URL.
+func (h *QRHandler) GetLinkQR(c *gin.Context) {
+	var req QROptions
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format, opts, err := req.options()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	var link models.Link
+	if err := h.db.Where("link_id = ?", c.Param("link_id")).First(&link).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+		return
+	}
+	
+	data, contentType, err := renderQR(link.PublicURL(h.baseURL(c)), format, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s.%s", link.LinkID, format))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ExportQRRequest selects the links of a QR code export.
+type ExportQRRequest struct {
+	LinkIDs []string `json:"link_ids" binding:"required,min=1"`
+	QROptions
+}
+
+// ExportQRCodes renders a QR code for each selected link and returns them
+// as a ZIP archive with one <link_id>.<format> file per link.
+func (h *QRHandler) ExportQRCodes(c *gin.Context) {
+	var req ExportQRRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.LinkIDs) > maxQRExport {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d links can be exported at once", maxQRExport)})
+		return
+	}
+	format, opts, err := req.options()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	var links []models.Link
+	if err := h.db.Where("link_id IN ?", req.LinkIDs).Find(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch links"})
+		return
+	}
+	found := make(map[string]bool, len(links))
+	for _, link := range links {
+		found[link.LinkID] = true
+	}
+	var missing []string
+	for _, linkID := range req.LinkIDs {
+		if !found[linkID] {
+			missing = append(missing, linkID)
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "links not found", "link_ids": missing})
+		return
+	}
+	
+	// Render everything before writing so that a failure is still a JSON error
+	base := h.baseURL(c)
+	files := make(map[string][]byte, len(links))
+	for _, link := range links {
+		data, _, err := renderQR(link.PublicURL(base), format, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %v", link.LinkID, err)})
+			return
+		}
+		files[link.LinkID+"."+format] = data
+	}
+	
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename=qr_codes.zip")
+	
+	archive := zip.NewWriter(c.Writer)
+	defer archive.Close()
+	for _, link := range links {
+		name := link.LinkID + "." + format
+		w, err := archive.Create(name)
+		if err != nil {
+			return
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			return
+		}
+	}
+}
+
+// baseURL returns the configured public URL, or the scheme and host of
+// the request.
+func (h *QRHandler) baseURL(c *gin.Context) string {
+	if h.publicURL != "" {
+		return h.publicURL
+	}
+	return requestBaseURL(c, h.clientIPs)
+}
+
+// requestBaseURL returns the scheme and host the request was made to. The
+// X-Forwarded-Proto header is only believed from trusted proxies.
+func requestBaseURL(c *gin.Context, clientIPs *clientip.Resolver) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	} else if clientIPs.FromTrustedProxy(c.Request) && c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func renderQR(content string, format string, opts qrcode.Options) ([]byte, string, error) {
+	if format == "svg" {
+		data, err := qrcode.SVG(content, opts)
+		return data, "image/svg+xml", err
+	}
+	data, err := qrcode.PNG(content, opts)
+	return data, "image/png", err
+}
@@ -2,44 +2,56 @@ package api
 
 import (
 	"context"
-	"fmt"
-	"net"
+	"errors"
+	"log"
 	"net/http"
-	"net/url"
-	"strings"
 	"time"
 	
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 	
+	"github.com/raoxb/smart_redirect/internal/config"
 	"github.com/raoxb/smart_redirect/internal/models"
 	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/pkg/clientip"
 	"github.com/raoxb/smart_redirect/pkg/geoip"
+	"github.com/raoxb/smart_redirect/pkg/useragent"
 )
 
 type RedirectHandler struct {
 	linkService  *services.LinkService
 	rateLimiter  *services.RateLimiter
 	statsService *services.StatsService
-	geoIP        *geoip.GeoIP
+	geoIP        geoip.Provider
 	db           *gorm.DB
+	limits       config.RateLimitConfig
+	bots         *services.BotFilter
+	clientIPs    *clientip.Resolver
 }
 
-func NewRedirectHandler(db *gorm.DB, redis *redis.Client) *RedirectHandler {
+// NewRedirectHandler creates a handler applying the given rate limits to
+// every link; links may override the per-IP link limit and the action on
+// the bots the filter finds. Visitors on the block list of ipRanges are
+// refused. Visitor addresses are resolved by clientIPs and located by geoIP.
+func NewRedirectHandler(db *gorm.DB, redis *redis.Client, limits config.RateLimitConfig, bots *services.BotFilter, ipRanges *services.IPRangeService, clientIPs *clientip.Resolver, geoIP geoip.Provider) *RedirectHandler {
 	return &RedirectHandler{
 		linkService:  services.NewLinkService(db, redis),
-		rateLimiter:  services.NewRateLimiter(redis),
+		rateLimiter:  services.NewRateLimiter(redis, ipRanges),
 		statsService: services.NewStatsService(db, redis),
-		geoIP:        geoip.NewGeoIP(),
+		geoIP:        geoIP,
 		db:           db,
+		limits:       limits,
+		bots:         bots,
+		clientIPs:    clientIPs,
 	}
 }
 
 func (h *RedirectHandler) HandleRedirect(c *gin.Context) {
 	bu := c.Param("bu")
 	linkID := c.Param("link_id")
-	clientIP := getClientIP(c)
+	clientIP := h.clientIPs.ClientIP(c.Request)
 	
 	blocked, reason := h.rateLimiter.IsIPBlocked(clientIP)
 	if blocked {
@@ -47,15 +59,6 @@ func (h *RedirectHandler) HandleRedirect(c *gin.Context) {
 		return
 	}
 	
-	location, err := h.geoIP.GetLocation(clientIP)
-	if err != nil {
-		location = &geoip.LocationInfo{
-			IP:          clientIP,
-			CountryCode: "UNKNOWN",
-			Country:     "Unknown",
-		}
-	}
-	
 	link, err := h.linkService.GetLinkByID(linkID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
@@ -67,99 +70,220 @@ func (h *RedirectHandler) HandleRedirect(c *gin.Context) {
 		return
 	}
 	
-	allowed, err := h.rateLimiter.CheckIPLimit(clientIP, 100, time.Hour)
-	if err != nil || !allowed {
-		go h.rateLimiter.BlockIP(clientIP, "rate limit exceeded", 24*time.Hour)
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+	if link.HasExpiredAt(time.Now()) {
+		if expiryURL := link.ExpiryRedirectURL(); expiryURL != "" {
+			c.Redirect(http.StatusFound, expiryURL)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
 		return
 	}
 	
-	allowed, err = h.rateLimiter.CheckIPLinkLimit(clientIP, link.ID, 10, 12*time.Hour)
-	if err != nil || !allowed {
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "link access limit exceeded"})
+	// Preview crawlers of messaging apps get the link's Open Graph page.
+	// They are not visitors: no caps, rate limits, IP memory or stats
+	userAgent := c.GetHeader("User-Agent")
+	if useragent.IsPreviewBot(userAgent) {
+		servePreview(c, link, requestBaseURL(c, h.clientIPs))
 		return
 	}
 	
-	globalCapKey := fmt.Sprintf("global_cap:link:%d", link.ID)
-	allowed, err = h.rateLimiter.CheckGlobalCap(globalCapKey, link.TotalCap)
-	if err != nil || !allowed {
-		if link.BackupURL != "" {
-			c.Redirect(http.StatusFound, link.BackupURL)
-			return
+	bot := h.bots.Classify(clientIP, c.Request.Header)
+	botAction := models.BotAllow
+	if bot.Bot {
+		botAction = h.bots.ActionFor(link)
+	}
+	if botAction == models.BotBlock {
+		agent := useragent.Parse(userAgent)
+		accessLog := &models.AccessLog{
+			LinkID:     link.ID,
+			IP:         clientIP,
+			UserAgent:  userAgent,
+			Referer:    c.GetHeader("Referer"),
+			DeviceType: agent.DeviceType,
+			OS:         agent.OS,
+			Browser:    agent.Browser,
+			BotVerdict: models.BotVerdictBlocked,
+			BotReason:  bot.Reason,
 		}
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "link cap reached"})
+		// Blocked bots are refused before the geo lookup; it is only done
+		// for the log
+		go func() {
+			if location, err := h.geoIP.GetLocation(clientIP); err == nil {
+				accessLog.Country = location.CountryCode
+			}
+			h.logAccess(accessLog)
+		}()
+		c.JSON(http.StatusForbidden, gin.H{"error": "automated traffic is not allowed"})
 		return
 	}
 	
-	target, err := h.linkService.SelectTarget(link, clientIP, location.CountryCode)
+	location, err := h.geoIP.GetLocation(clientIP)
 	if err != nil {
-		if link.BackupURL != "" {
-			c.Redirect(http.StatusFound, link.BackupURL)
+		location = &geoip.Location{
+			IP:          clientIP,
+			CountryCode: "UNKNOWN",
+			CountryName: "Unknown",
+		}
+	}
+	
+	if h.limits.IPLimitPerHour > 0 {
+		allowed, err := h.rateLimiter.CheckIPLimitWith(h.limits.IPLimitAlgorithm, clientIP, h.limits.IPLimitPerHour, time.Hour)
+		if err != nil || !allowed {
+			if h.limits.AutoBlockDurationHours > 0 {
+				go h.rateLimiter.BlockIP(clientIP, "rate limit exceeded", time.Duration(h.limits.AutoBlockDurationHours)*time.Hour)
+			}
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
 			return
 		}
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	}
+	
+	agent := useragent.Parse(userAgent)
+	
+	visitor := &services.Visitor{
+		IP:        clientIP,
+		Location:  location,
+		Agent:     agent,
+		Languages: services.ParseAcceptLanguage(c.GetHeader("Accept-Language")),
+		ClickID:   uuid.NewString(),
+		Bot:       bot,
+	}
+	
+	if botAction == models.BotBackup {
+		if !h.redirectToFallback(c, link, visitor, models.FallbackBot) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "automated traffic is not allowed"})
+		}
 		return
 	}
 	
-	originalParams := make(map[string]string)
-	for key, values := range c.Request.URL.Query() {
-		if len(values) > 0 {
-			originalParams[key] = values[0]
+	// Visitors over the link's per-IP limit are rejected, or sent down the
+	// fallback chain or to a designated target depending on the link's action
+	var target *models.Target
+	if limit, window := link.IPLimit(h.limits.IPLinkLimitPer12h, 12*time.Hour); limit > 0 {
+		algorithm := link.RateLimitAlgorithm
+		if algorithm == "" {
+			algorithm = h.limits.IPLinkLimitAlgorithm
+		}
+		allowed, err := h.rateLimiter.CheckIPLinkLimitWith(algorithm, clientIP, link.ID, limit, window)
+		if err != nil || !allowed {
+			if link.RateLimitAction == models.RateLimitBackup && h.redirectToFallback(c, link, visitor, models.FallbackRateLimited) {
+				return
+			}
+			if target = link.OverLimitTarget(); target == nil {
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "link access limit exceeded"})
+				return
+			}
 		}
 	}
 	
-	processedParams, err := h.linkService.ProcessParameters(target, originalParams)
+	// The hit is counted against the caps before redirecting, and given
+	// back if the redirect cannot be built. Flagged bots are redirected
+	// without counting
+	flagged := botAction == models.BotFlag
+	selected := target == nil
+	var reservation *services.CapReservation
+	if flagged {
+		if target == nil {
+			target, err = h.linkService.SelectTargetFor(link, visitor)
+		}
+	} else if target != nil {
+		reservation, err = h.linkService.Caps().Reserve(c.Request.Context(), link, target)
+	} else {
+		target, reservation, err = h.linkService.ReserveTarget(link, visitor)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process parameters"})
+		if h.redirectToFallback(c, link, visitor, services.FallbackReason(err)) {
+			return
+		}
+		if errors.Is(err, services.ErrLinkCapReached) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "link cap reached"})
+			return
+		}
+		if errors.Is(err, services.ErrLinkPaced) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "link cap over pace"})
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		return
 	}
 	
-	targetURL, err := url.Parse(target.URL)
+	targetURL, err := h.linkService.BuildTargetURL(link, target, c.Request.URL.Query(), visitor)
 	if err != nil {
+		if reservation != nil {
+			_ = reservation.Release(context.Background())
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid target URL"})
 		return
 	}
 	
-	query := targetURL.Query()
-	for k, v := range processedParams {
-		query.Set(k, v)
+	// The strategy only learns about the visitor now that the redirect is
+	// certain, not about the targets tried while reserving
+	if selected && !flagged {
+		if err := h.linkService.RecordSelection(c.Request.Context(), link, visitor, target); err != nil {
+			log.Printf("selection for link %d: %v", link.ID, err)
+		}
 	}
-	targetURL.RawQuery = query.Encode()
 	
 	go func() {
 		ctx := context.Background()
-		_ = h.linkService.IncrementHits(link.ID, target.ID)
-		_ = h.rateLimiter.IncrementCap(globalCapKey)
+		if !flagged {
+			_ = h.linkService.IncrementHits(link.ID, target.ID)
+		}
 		_ = h.rateLimiter.RecordIPAccess(clientIP, location.CountryCode)
 		_ = h.statsService.RecordVisit(ctx, link.LinkID, target.ID, clientIP, location.CountryCode)
 		
 		accessLog := &models.AccessLog{
-			LinkID:    link.ID,
-			TargetID:  target.ID,
-			IP:        clientIP,
-			UserAgent: c.GetHeader("User-Agent"),
-			Referer:   c.GetHeader("Referer"),
-			Country:   location.CountryCode,
+			LinkID:     link.ID,
+			TargetID:   &target.ID,
+			IP:         clientIP,
+			UserAgent:  userAgent,
+			Referer:    c.GetHeader("Referer"),
+			Country:    location.CountryCode,
+			DeviceType: agent.DeviceType,
+			OS:         agent.OS,
+			Browser:    agent.Browser,
+			ClickID:    visitor.ClickID,
+			BotVerdict: bot.Verdict(flagged),
+			BotReason:  bot.Reason,
 		}
-		_ = h.db.Create(accessLog)
+		h.logAccess(accessLog)
 	}()
 	
-	c.Redirect(http.StatusFound, targetURL.String())
+	c.Redirect(http.StatusFound, targetURL)
 }
 
-func getClientIP(c *gin.Context) string {
-	if ip := c.GetHeader("X-Real-IP"); ip != "" {
-		return ip
+// redirectToFallback sends the visitor to the first entry of the link's
+// fallback chain matching the reason and logs the hit. It reports false,
+// without responding, when no entry matches.
+func (h *RedirectHandler) redirectToFallback(c *gin.Context, link *models.Link, visitor *services.Visitor, reason string) bool {
+	fallbackURL := h.linkService.FallbackURL(link, reason, visitor.CountryCode())
+	if fallbackURL == "" {
+		return false
 	}
 	
-	if ip := c.GetHeader("X-Forwarded-For"); ip != "" {
-		parts := strings.Split(ip, ",")
-		return strings.TrimSpace(parts[0])
+	accessLog := &models.AccessLog{
+		LinkID:         link.ID,
+		IP:             visitor.IP,
+		UserAgent:      c.GetHeader("User-Agent"),
+		Referer:        c.GetHeader("Referer"),
+		Country:        visitor.CountryCode(),
+		DeviceType:     visitor.Agent.DeviceType,
+		OS:             visitor.Agent.OS,
+		Browser:        visitor.Agent.Browser,
+		ClickID:        visitor.ClickID,
+		FallbackReason: reason,
+		BotVerdict:     visitor.Bot.Verdict(false),
+		BotReason:      visitor.Bot.Reason,
 	}
+	go h.logAccess(accessLog)
 	
-	if ip, _, err := net.SplitHostPort(c.Request.RemoteAddr); err == nil {
-		return ip
+	c.Redirect(http.StatusFound, fallbackURL)
+	return true
+}
+
+// logAccess stores an access log. It runs after the response, so a failure
+// can only be reported in the server log.
+func (h *RedirectHandler) logAccess(accessLog *models.AccessLog) {
+	if err := h.db.Create(accessLog).Error; err != nil {
+		log.Printf("access log for link %d: %v", accessLog.LinkID, err)
 	}
-	
-	return c.Request.RemoteAddr
-}
\ No newline at end of file
+}
@@ -17,24 +17,31 @@ type StatsHandler struct {
 	db           *gorm.DB
 	rateLimiter  *services.RateLimiter
 	statsService *services.StatsService
+	bandit       *services.BanditService
+	caps         *services.CapService
 }
 
-func NewStatsHandler(db *gorm.DB, redis *redis.Client) *StatsHandler {
+func NewStatsHandler(db *gorm.DB, redis *redis.Client, ipRanges *services.IPRangeService) *StatsHandler {
 	return &StatsHandler{
 		db:           db,
-		rateLimiter:  services.NewRateLimiter(redis),
+		rateLimiter:  services.NewRateLimiter(redis, ipRanges),
 		statsService: services.NewStatsService(db, redis),
+		bandit:       services.NewBanditService(redis),
+		caps:         services.NewCapService(db, redis),
 	}
 }
 
 type LinkStats struct {
-	LinkID       string `json:"link_id"`
-	BusinessUnit string `json:"business_unit"`
-	TotalHits    int64  `json:"total_hits"`
-	TodayHits    int64  `json:"today_hits"`
-	UniqueIPs    int64  `json:"unique_ips"`
-	Countries    []CountryStats `json:"countries"`
-	Targets      []TargetStats  `json:"targets"`
+	LinkID           string           `json:"link_id"`
+	BusinessUnit     string           `json:"business_unit"`
+	TotalHits        int64            `json:"total_hits"`
+	TodayHits        int64            `json:"today_hits"`
+	UniqueIPs        int64            `json:"unique_ips"`
+	Countries        []CountryStats   `json:"countries"`
+	Targets          []TargetStats    `json:"targets"`
+	Devices          []BreakdownStats `json:"devices"`
+	OperatingSystems []BreakdownStats `json:"operating_systems"`
+	Browsers         []BreakdownStats `json:"browsers"`
 }
 
 type CountryStats struct {
@@ -42,6 +49,13 @@ type CountryStats struct {
 	Hits    int64  `json:"hits"`
 }
 
+// BreakdownStats is the hit count for one value of an access log column,
+// such as a device type or OS.
+type BreakdownStats struct {
+	Value string `json:"value"`
+	Hits  int64  `json:"hits"`
+}
+
 type TargetStats struct {
 	TargetID uint   `json:"target_id"`
 	URL      string `json:"url"`
@@ -82,19 +96,130 @@ func (h *StatsHandler) GetLinkStats(c *gin.Context) {
 		Group("targets.id, targets.url").
 		Scan(&targets)
 	
+	linkLogs := h.db.Model(&models.AccessLog{}).Where("link_id = ?", link.ID)
+	
 	stats := LinkStats{
-		LinkID:       link.LinkID,
-		BusinessUnit: link.BusinessUnit,
-		TotalHits:    totalHits,
-		TodayHits:    todayHits,
-		UniqueIPs:    uniqueIPs,
-		Countries:    countries,
-		Targets:      targets,
+		LinkID:           link.LinkID,
+		BusinessUnit:     link.BusinessUnit,
+		TotalHits:        totalHits,
+		TodayHits:        todayHits,
+		UniqueIPs:        uniqueIPs,
+		Countries:        countries,
+		Targets:          targets,
+		Devices:          breakdownBy(linkLogs, "device_type", 0),
+		OperatingSystems: breakdownBy(linkLogs, "os", 0),
+		Browsers:         breakdownBy(linkLogs, "browser", 0),
 	}
 	
 	c.JSON(http.StatusOK, stats)
 }
 
+// BanditTargetStats is what the bandit has learned about one target.
+type BanditTargetStats struct {
+	services.ArmStats
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// GetBanditStats reports the clicks, conversions and learned traffic share
+// of each active target of a link using a bandit selection strategy.
+func (h *StatsHandler) GetBanditStats(c *gin.Context) {
+	linkID := c.Param("link_id")
+	
+	var link models.Link
+	if err := h.db.Preload("Targets", "is_active = ?", true).Where("link_id = ?", linkID).First(&link).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+		return
+	}
+	
+	targets := make([]*models.Target, len(link.Targets))
+	weights := make([]int, len(link.Targets))
+	for i := range link.Targets {
+		targets[i] = &link.Targets[i]
+		weights[i] = link.Targets[i].Weight
+	}
+	
+	ctx := c.Request.Context()
+	var arms []services.ArmStats
+	var err error
+	switch link.SelectionStrategy {
+	case services.StrategyThompson, services.StrategyEpsilonGreedy:
+		arms, err = h.bandit.LearnedWeights(ctx, link.SelectionStrategy, targets, weights)
+	default:
+		arms, err = h.bandit.Arms(ctx, targets)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load bandit stats"})
+		return
+	}
+	
+	result := make([]BanditTargetStats, len(arms))
+	for i, arm := range arms {
+		result[i] = BanditTargetStats{
+			ArmStats: arm,
+			URL:      targets[i].URL,
+			Weight:   targets[i].Weight,
+		}
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"link_id":            link.LinkID,
+		"selection_strategy": link.SelectionStrategy,
+		"targets":            result,
+	})
+}
+
+// TargetCapStats is the cap consumption of one target.
+type TargetCapStats struct {
+	TargetID uint   `json:"target_id"`
+	URL      string `json:"url"`
+	*services.CapHistory
+}
+
+// GetCapStats reports the consumption of a link's cap and its targets' caps
+// over the current and previous cap periods.
+func (h *StatsHandler) GetCapStats(c *gin.Context) {
+	linkID := c.Param("link_id")
+	periods, _ := strconv.Atoi(c.DefaultQuery("periods", "7"))
+	if periods < 1 || periods > 90 {
+		periods = 7
+	}
+	
+	var link models.Link
+	if err := h.db.Preload("Targets").Where("link_id = ?", linkID).First(&link).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+		return
+	}
+	
+	ctx := c.Request.Context()
+	linkHistory, err := h.caps.LinkHistory(ctx, &link, periods)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load cap stats"})
+		return
+	}
+	
+	targets := make([]TargetCapStats, 0, len(link.Targets))
+	for i := range link.Targets {
+		target := &link.Targets[i]
+		history, err := h.caps.TargetHistory(ctx, &link, target, periods)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load cap stats"})
+			return
+		}
+		targets = append(targets, TargetCapStats{
+			TargetID:   target.ID,
+			URL:        target.URL,
+			CapHistory: history,
+		})
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"link_id": link.LinkID,
+		"link":    linkHistory,
+		"targets": targets,
+	})
+}
+
 func (h *StatsHandler) GetSystemStats(c *gin.Context) {
 	var totalLinks int64
 	h.db.Model(&models.Link{}).Count(&totalLinks)
@@ -117,15 +242,36 @@ func (h *StatsHandler) GetSystemStats(c *gin.Context) {
 		Limit(10).
 		Scan(&topCountries)
 	
+	allLogs := h.db.Model(&models.AccessLog{})
+	
 	c.JSON(http.StatusOK, gin.H{
-		"total_links":   totalLinks,
-		"total_hits":    totalHits,
-		"today_hits":    todayHits,
-		"unique_ips":    uniqueIPs,
-		"top_countries": topCountries,
+		"total_links":       totalLinks,
+		"total_hits":        totalHits,
+		"today_hits":        todayHits,
+		"unique_ips":        uniqueIPs,
+		"top_countries":     topCountries,
+		"devices":           breakdownBy(allLogs, "device_type", 0),
+		"operating_systems": breakdownBy(allLogs, "os", 0),
+		"top_browsers":      breakdownBy(allLogs, "browser", 10),
 	})
 }
 
+// breakdownBy groups the access logs matched by query on column. The
+// column name must come from code, never from user input.
+func breakdownBy(query *gorm.DB, column string, limit int) []BreakdownStats {
+	stats := []BreakdownStats{}
+	q := query.Session(&gorm.Session{}).
+		Select(column + " as value, COUNT(*) as hits").
+		Where(column + " <> ''").
+		Group(column).
+		Order("hits DESC")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	q.Scan(&stats)
+	return stats
+}
+
 func (h *StatsHandler) GetIPInfo(c *gin.Context) {
 	ip := c.Param("ip")
 	
@@ -259,6 +405,9 @@ func (h *StatsHandler) GetAccessLogs(c *gin.Context) {
 	linkID := c.Query("link_id")
 	ip := c.Query("ip")
 	country := c.Query("country")
+	deviceType := c.Query("device_type")
+	osName := c.Query("os")
+	botVerdict := c.Query("bot_verdict")
 	
 	// Validate pagination
 	if page < 1 {
@@ -286,6 +435,15 @@ func (h *StatsHandler) GetAccessLogs(c *gin.Context) {
 	if country != "" {
 		query = query.Where("country = ?", country)
 	}
+	if deviceType != "" {
+		query = query.Where("device_type = ?", deviceType)
+	}
+	if osName != "" {
+		query = query.Where("os = ?", osName)
+	}
+	if botVerdict != "" {
+		query = query.Where("bot_verdict = ?", botVerdict)
+	}
 	
 	// Get total count
 	var total int64
@@ -305,8 +463,11 @@ func (h *StatsHandler) GetAccessLogs(c *gin.Context) {
 			logs[i].Link = &link
 		}
 		
+		if logs[i].TargetID == nil {
+			continue
+		}
 		var target models.Target
-		if err := h.db.Where("id = ?", logs[i].TargetID).First(&target).Error; err == nil {
+		if err := h.db.Where("id = ?", *logs[i].TargetID).First(&target).Error; err == nil {
 			logs[i].Target = &target
 		}
 	}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/pkg/useragent"
+)
+
+// TargetRules holds the optional targeting rules accepted everywhere a
+// target is created: the target endpoints, batch creation and templates.
+type TargetRules struct {
+	Priority          int                     `json:"priority,omitempty"`
+	ExcludedCountries []string                `json:"excluded_countries,omitempty"`
+	CountryWeights    map[string]int          `json:"country_weights,omitempty"`
+	Schedule          *models.TargetSchedule  `json:"schedule,omitempty"`
+	DeviceTypes       []string                `json:"device_types,omitempty"`
+	OperatingSystems  []string                `json:"operating_systems,omitempty"`
+	Browsers          []string                `json:"browsers,omitempty"`
+	Languages         []string                `json:"languages,omitempty"`
+	Regions           []string                `json:"regions,omitempty"`
+	ExcludedRegions   []string                `json:"excluded_regions,omitempty"`
+	Cities            []string                `json:"cities,omitempty"`
+	ExcludedCities    []string                `json:"excluded_cities,omitempty"`
+	Transforms        []models.ParamTransform `json:"transforms,omitempty"`
+	PassthroughMode   string                  `json:"passthrough_mode,omitempty"`
+	PassthroughParams []string                `json:"passthrough_params,omitempty"`
+	MergePolicy       string                  `json:"merge_policy,omitempty"`
+	CapPeriod         string                  `json:"cap_period,omitempty"`
+	CapTimezone       string                  `json:"cap_timezone,omitempty"`
+	CapPacing         string                  `json:"cap_pacing,omitempty"`
+	CapPacingCurve    []float64               `json:"cap_pacing_curve,omitempty"`
+	StartsAt          *time.Time              `json:"starts_at,omitempty"`
+	ExpiresAt         *time.Time              `json:"expires_at,omitempty"`
+}
+
+// Validate checks the rules without touching a target.
+func (r *TargetRules) Validate() error {
+	if r.Priority < 0 {
+		return fmt.Errorf("priority must not be negative")
+	}
+	for key, weight := range r.CountryWeights {
+		if weight < 0 {
+			return fmt.Errorf("country weight for %q must not be negative", key)
+		}
+	}
+	if r.Schedule != nil {
+		if err := r.Schedule.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateNames("device type", r.DeviceTypes, useragent.IsDeviceType); err != nil {
+		return err
+	}
+	if err := validateNames("operating system", r.OperatingSystems, useragent.IsOS); err != nil {
+		return err
+	}
+	if err := validateNames("browser", r.Browsers, useragent.IsBrowser); err != nil {
+		return err
+	}
+	if err := validateNames("language", r.Languages, services.IsValidLanguageTag); err != nil {
+		return err
+	}
+	if err := validateNames("region", r.Regions, services.IsValidRegionCode); err != nil {
+		return err
+	}
+	if err := validateNames("region", r.ExcludedRegions, services.IsValidRegionCode); err != nil {
+		return err
+	}
+	if err := validateNames("city", r.Cities, services.IsValidCity); err != nil {
+		return err
+	}
+	if err := validateNames("city", r.ExcludedCities, services.IsValidCity); err != nil {
+		return err
+	}
+	if err := models.ValidateTransforms(r.Transforms); err != nil {
+		return err
+	}
+	if !models.IsValidPassthroughMode(r.PassthroughMode) {
+		return fmt.Errorf("unknown passthrough mode %q", r.PassthroughMode)
+	}
+	if !models.IsValidMergePolicy(r.MergePolicy) {
+		return fmt.Errorf("unknown merge policy %q", r.MergePolicy)
+	}
+	if !models.IsValidCapPeriod(r.CapPeriod) {
+		return fmt.Errorf("unknown cap period %q", r.CapPeriod)
+	}
+	if err := models.ValidateCapTimezone(r.CapTimezone); err != nil {
+		return err
+	}
+	if err := models.ValidateCapPacing(r.CapPacing, r.CapPeriod, r.CapPacingCurve); err != nil {
+		return err
+	}
+	if err := models.ValidateFlight(r.StartsAt, r.ExpiresAt); err != nil {
+		return err
+	}
+	return nil
+}
+
+// applyTo validates the rules and stores them on the target.
+func (r *TargetRules) applyTo(target *models.Target) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	target.Priority = r.Priority
+	target.Schedule = ""
+	if r.Schedule != nil && len(r.Schedule.Windows) > 0 {
+		schedule, _ := json.Marshal(r.Schedule)
+		target.Schedule = string(schedule)
+	}
+	target.ExcludedCountries = marshalList(upperList(r.ExcludedCountries))
+	target.CountryWeights = ""
+	if len(r.CountryWeights) > 0 {
+		weights := make(map[string]int, len(r.CountryWeights))
+		for key, weight := range r.CountryWeights {
+			weights[strings.ToUpper(key)] = weight
+		}
+		data, _ := json.Marshal(weights)
+		target.CountryWeights = string(data)
+	}
+	target.DeviceTypes = marshalList(r.DeviceTypes)
+	target.OperatingSystems = marshalList(r.OperatingSystems)
+	target.Browsers = marshalList(r.Browsers)
+	target.Languages = marshalList(r.Languages)
+	target.Regions = marshalList(upperList(r.Regions))
+	target.ExcludedRegions = marshalList(upperList(r.ExcludedRegions))
+	target.Cities = marshalList(r.Cities)
+	target.ExcludedCities = marshalList(r.ExcludedCities)
+	target.Transforms = ""
+	if len(r.Transforms) > 0 {
+		transforms, _ := json.Marshal(r.Transforms)
+		target.Transforms = string(transforms)
+	}
+	target.PassthroughMode = r.PassthroughMode
+	target.PassthroughParams = marshalList(r.PassthroughParams)
+	target.MergePolicy = r.MergePolicy
+	target.CapPeriod = r.CapPeriod
+	target.CapTimezone = r.CapTimezone
+	target.CapPacing = r.CapPacing
+	target.CapPacingCurve = marshalCurve(r.CapPacingCurve)
+	target.StartsAt = r.StartsAt
+	target.ExpiresAt = r.ExpiresAt
+
+	return nil
+}
+
+// validateCountries checks that the target's country lists and weight
+// overrides only use country codes, ALL or existing country groups.
+func validateCountries(groups *services.CountryGroupService, countries []string, rules *TargetRules) error {
+	weightKeys := make([]string, 0, len(rules.CountryWeights))
+	for key := range rules.CountryWeights {
+		weightKeys = append(weightKeys, key)
+	}
+
+	for _, list := range [][]string{countries, rules.ExcludedCountries, weightKeys} {
+		if err := groups.ValidateCountries(list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMacros reports unknown macros in the target URL, in ParamMapping
+// source keys and in StaticParams values, so they are caught on save rather
+// than left unexpanded at redirect time. Macros in the URL's scheme or host
+// are refused.
+func validateMacros(targetURL string, paramMapping map[string]string, staticParams map[string]string) error {
+	if err := services.ValidateURLMacros(targetURL); err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+	for key := range paramMapping {
+		if strings.HasPrefix(key, "{") {
+			if err := services.ValidateMacros(key); err != nil {
+				return fmt.Errorf("param_mapping: %w", err)
+			}
+		}
+	}
+	for key, value := range staticParams {
+		if err := services.ValidateMacros(value); err != nil {
+			return fmt.Errorf("static_params %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func validateNames(kind string, names []string, known func(string) bool) error {
+	for _, name := range names {
+		if !known(name) {
+			return fmt.Errorf("unknown %s %q", kind, name)
+		}
+	}
+	return nil
+}
+
+// marshalList stores a list the same way as Target.Countries: a JSON
+// array, or an empty string when there is nothing to restrict.
+func marshalList(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
+func upperList(list []string) []string {
+	result := make([]string, len(list))
+	for i, item := range list {
+		result[i] = strings.ToUpper(item)
+	}
+	return result
+}
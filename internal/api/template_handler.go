@@ -10,28 +10,39 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	
+	"github.com/raoxb/smart_redirect/internal/config"
 	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/internal/services"
 )
 
 type TemplateHandler struct {
-	db *gorm.DB
+	db            *gorm.DB
+	countryGroups *services.CountryGroupService
+	linkIDs       *services.LinkIDGenerator
 }
 
-func NewTemplateHandler(db *gorm.DB) *TemplateHandler {
-	return &TemplateHandler{db: db}
+func NewTemplateHandler(db *gorm.DB, linkIDs config.LinkIDConfig) *TemplateHandler {
+	return &TemplateHandler{
+		db:            db,
+		countryGroups: services.NewCountryGroupService(db, nil),
+		linkIDs:       services.NewLinkIDGenerator(db, linkIDs),
+	}
 }
 
 type LinkTemplate struct {
-	ID           uint                   `gorm:"primaryKey" json:"id"`
-	Name         string                 `gorm:"size:100" json:"name"`
-	Description  string                 `json:"description"`
-	BusinessUnit string                 `gorm:"size:10" json:"business_unit"`
-	Network      string                 `gorm:"size:50" json:"network"`
-	TotalCap     int                    `json:"total_cap"`
-	BackupURL    string                 `json:"backup_url"`
-	TargetConfig string                 `gorm:"type:jsonb" json:"target_config"`
-	CreatedAt    time.Time              `json:"created_at"`
-	UpdatedAt    time.Time              `json:"updated_at"`
+	ID                uint   `gorm:"primaryKey" json:"id"`
+	Name              string `gorm:"size:100" json:"name"`
+	Description       string `json:"description"`
+	BusinessUnit      string `gorm:"size:10" json:"business_unit"`
+	Network           string `gorm:"size:50" json:"network"`
+	TotalCap          int    `json:"total_cap"`
+	BackupURL         string `json:"backup_url"`
+	SelectionStrategy string `gorm:"size:20" json:"selection_strategy"`
+	LinkLimits
+	RateLimitTargetIndex int       `json:"rate_limit_target_index"`
+	TargetConfig         string    `gorm:"type:jsonb" json:"target_config"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
 }
 
 type TemplateTargetConfig struct {
@@ -41,16 +52,22 @@ type TemplateTargetConfig struct {
 	Countries    []string          `json:"countries"`
 	ParamMapping map[string]string `json:"param_mapping"`
 	StaticParams map[string]string `json:"static_params"`
+	TargetRules
 }
 
 type CreateTemplateRequest struct {
-	Name         string                 `json:"name" binding:"required"`
-	Description  string                 `json:"description"`
-	BusinessUnit string                 `json:"business_unit" binding:"required"`
-	Network      string                 `json:"network" binding:"required"`
-	TotalCap     int                    `json:"total_cap"`
-	BackupURL    string                 `json:"backup_url"`
-	Targets      []TemplateTargetConfig `json:"targets" binding:"required"`
+	Name              string `json:"name" binding:"required"`
+	Description       string `json:"description"`
+	BusinessUnit      string `json:"business_unit" binding:"required"`
+	Network           string `json:"network" binding:"required"`
+	TotalCap          int    `json:"total_cap"`
+	BackupURL         string `json:"backup_url"`
+	SelectionStrategy string `json:"selection_strategy"`
+	LinkLimits
+	// RateLimitTargetIndex is the index in Targets of the target used by the
+	// "target" rate limit action.
+	RateLimitTargetIndex int                    `json:"rate_limit_target_index"`
+	Targets              []TemplateTargetConfig `json:"targets" binding:"required"`
 }
 
 func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
@@ -60,6 +77,29 @@ func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
 		return
 	}
 	
+	if err := h.validateTemplateTargets(req.Targets); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if !services.IsValidSelectionStrategy(req.SelectionStrategy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown selection strategy %q", req.SelectionStrategy)})
+		return
+	}
+	
+	if err := req.LinkLimits.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validateTargetIndex(req.RateLimitTargetIndex, len(req.Targets)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validateFallbackCountries(h.countryGroups); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
 	targetsJSON, err := json.Marshal(req.Targets)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to serialize targets"})
@@ -67,13 +107,16 @@ func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
 	}
 	
 	template := &LinkTemplate{
-		Name:         req.Name,
-		Description:  req.Description,
-		BusinessUnit: req.BusinessUnit,
-		Network:      req.Network,
-		TotalCap:     req.TotalCap,
-		BackupURL:    req.BackupURL,
-		TargetConfig: string(targetsJSON),
+		Name:                 req.Name,
+		Description:          req.Description,
+		BusinessUnit:         req.BusinessUnit,
+		Network:              req.Network,
+		TotalCap:             req.TotalCap,
+		BackupURL:            req.BackupURL,
+		SelectionStrategy:    req.SelectionStrategy,
+		LinkLimits:           req.LinkLimits,
+		RateLimitTargetIndex: req.RateLimitTargetIndex,
+		TargetConfig:         string(targetsJSON),
 	}
 	
 	if err := h.db.Create(template).Error; err != nil {
@@ -149,6 +192,29 @@ func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
 		return
 	}
 	
+	if err := h.validateTemplateTargets(req.Targets); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if !services.IsValidSelectionStrategy(req.SelectionStrategy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown selection strategy %q", req.SelectionStrategy)})
+		return
+	}
+	
+	if err := req.LinkLimits.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validateTargetIndex(req.RateLimitTargetIndex, len(req.Targets)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validateFallbackCountries(h.countryGroups); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
 	targetsJSON, err := json.Marshal(req.Targets)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to serialize targets"})
@@ -161,6 +227,9 @@ func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
 	template.Network = req.Network
 	template.TotalCap = req.TotalCap
 	template.BackupURL = req.BackupURL
+	template.SelectionStrategy = req.SelectionStrategy
+	template.LinkLimits = req.LinkLimits
+	template.RateLimitTargetIndex = req.RateLimitTargetIndex
 	template.TargetConfig = string(targetsJSON)
 	
 	if err := h.db.Save(&template).Error; err != nil {
@@ -192,6 +261,21 @@ func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
 }
 
+func (h *TemplateHandler) validateTemplateTargets(targets []TemplateTargetConfig) error {
+	for i, target := range targets {
+		if err := target.Validate(); err != nil {
+			return fmt.Errorf("invalid target %d: %w", i, err)
+		}
+		if err := validateCountries(h.countryGroups, target.Countries, &target.TargetRules); err != nil {
+			return fmt.Errorf("invalid target %d: %w", i, err)
+		}
+		if err := validateMacros(target.URL, target.ParamMapping, target.StaticParams); err != nil {
+			return fmt.Errorf("invalid target %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
 type CreateFromTemplateRequest struct {
 	TemplateID uint                   `json:"template_id" binding:"required"`
 	Count      int                    `json:"count" binding:"required,min=1,max=100"`
@@ -227,11 +311,13 @@ func (h *TemplateHandler) CreateLinksFromTemplate(c *gin.Context) {
 	
 	for i := 0; i < req.Count; i++ {
 		link := &models.Link{
-			BusinessUnit: template.BusinessUnit,
-			Network:      template.Network,
-			TotalCap:     template.TotalCap,
-			BackupURL:    template.BackupURL,
+			BusinessUnit:      template.BusinessUnit,
+			Network:           template.Network,
+			TotalCap:          template.TotalCap,
+			BackupURL:         template.BackupURL,
+			SelectionStrategy: template.SelectionStrategy,
 		}
+		template.LinkLimits.applyTo(link)
 		
 		if overrides, ok := req.Overrides["business_unit"].(string); ok {
 			link.BusinessUnit = overrides
@@ -245,8 +331,81 @@ func (h *TemplateHandler) CreateLinksFromTemplate(c *gin.Context) {
 		if overrides, ok := req.Overrides["backup_url"].(string); ok {
 			link.BackupURL = overrides
 		}
+		if overrides, ok := req.Overrides["selection_strategy"].(string); ok {
+			if !services.IsValidSelectionStrategy(overrides) {
+				response.Errors = append(response.Errors, BatchError{
+					Index:   i,
+					Message: fmt.Sprintf("Unknown selection strategy: %s", overrides),
+				})
+				continue
+			}
+			link.SelectionStrategy = overrides
+		}
+		if overrides, ok := req.Overrides["rate_limit"].(float64); ok {
+			link.RateLimit = int(overrides)
+		}
+		if overrides, ok := req.Overrides["rate_limit_window"].(float64); ok {
+			link.RateLimitWindow = int(overrides)
+		}
+		if overrides, ok := req.Overrides["rate_limit_action"].(string); ok {
+			link.RateLimitAction = overrides
+		}
+		if overrides, ok := req.Overrides["rate_limit_algorithm"].(string); ok {
+			link.RateLimitAlgorithm = overrides
+		}
+		if overrides, ok := req.Overrides["cap_period"].(string); ok {
+			link.CapPeriod = overrides
+		}
+		if overrides, ok := req.Overrides["cap_timezone"].(string); ok {
+			link.CapTimezone = overrides
+		}
+		if overrides, ok := req.Overrides["cap_pacing"].(string); ok {
+			link.CapPacing = overrides
+		}
+		if overrides, ok := req.Overrides["cap_pacing_curve"].([]interface{}); ok {
+			data, _ := json.Marshal(overrides)
+			link.CapPacingCurve = string(data)
+		}
+		if overrides, ok := req.Overrides["bot_action"].(string); ok {
+			link.BotAction = overrides
+		}
+		flight, err := flightOverrides(req.Overrides)
+		if err == nil {
+			flight.applyTo(link)
+			err = flight.Validate()
+		}
+		if err != nil {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Invalid flight: %v", err),
+			})
+			continue
+		}
+		limits := LinkLimits{
+			RateLimit:          link.RateLimit,
+			RateLimitWindow:    link.RateLimitWindow,
+			RateLimitAction:    link.RateLimitAction,
+			RateLimitAlgorithm: link.RateLimitAlgorithm,
+			CapPeriod:          link.CapPeriod,
+			CapTimezone:        link.CapTimezone,
+			CapPacing:          link.CapPacing,
+			CapPacingCurve:     models.ParsePacingCurve(link.CapPacingCurve),
+			Fallbacks:          link.GetFallbacks(),
+			BotAction:          link.BotAction,
+		}
+		err = limits.Validate()
+		if err == nil {
+			err = limits.validateTargetIndex(template.RateLimitTargetIndex, len(targetConfigs))
+		}
+		if err != nil {
+			response.Errors = append(response.Errors, BatchError{
+				Index:   i,
+				Message: fmt.Sprintf("Invalid limits: %v", err),
+			})
+			continue
+		}
 		
-		if err := h.db.Create(link).Error; err != nil {
+		if err := h.linkIDs.Create(link); err != nil {
 			response.Errors = append(response.Errors, BatchError{
 				Index:   i,
 				Message: fmt.Sprintf("Failed to create link: %v", err),
@@ -255,7 +414,7 @@ func (h *TemplateHandler) CreateLinksFromTemplate(c *gin.Context) {
 		}
 		
 		hasError := false
-		for _, targetConfig := range targetConfigs {
+		for j, targetConfig := range targetConfigs {
 			paramMapping, _ := json.Marshal(targetConfig.ParamMapping)
 			staticParams, _ := json.Marshal(targetConfig.StaticParams)
 			countries := ""
@@ -274,6 +433,15 @@ func (h *TemplateHandler) CreateLinksFromTemplate(c *gin.Context) {
 				StaticParams: string(staticParams),
 			}
 			
+			if err := targetConfig.applyTo(target); err != nil {
+				response.Errors = append(response.Errors, BatchError{
+					Index:   i,
+					Message: fmt.Sprintf("Invalid target: %v", err),
+				})
+				hasError = true
+				break
+			}
+			
 			if err := h.db.Create(target).Error; err != nil {
 				response.Errors = append(response.Errors, BatchError{
 					Index:   i,
@@ -282,6 +450,20 @@ func (h *TemplateHandler) CreateLinksFromTemplate(c *gin.Context) {
 				hasError = true
 				break
 			}
+			
+			if link.RateLimitAction == models.RateLimitTarget && j == template.RateLimitTargetIndex {
+				link.RateLimitTargetID = target.ID
+			}
+		}
+		
+		if !hasError && link.RateLimitTargetID != 0 {
+			if err := h.db.Model(link).Update("rate_limit_target_id", link.RateLimitTargetID).Error; err != nil {
+				response.Errors = append(response.Errors, BatchError{
+					Index:   i,
+					Message: fmt.Sprintf("Failed to update link: %v", err),
+				})
+				hasError = true
+			}
 		}
 		
 		if !hasError {
@@ -13,11 +13,19 @@ type Config struct {
 	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
 	Logging  LoggingConfig  `mapstructure:"logging"`
 	GeoIP    GeoIPConfig    `mapstructure:"geoip"`
+	LinkIDs  LinkIDConfig   `mapstructure:"link_ids"`
+	BotFilter BotFilterConfig `mapstructure:"bot_filter"`
+	ClientIP ClientIPConfig `mapstructure:"client_ip"`
+	Postback PostbackConfig `mapstructure:"postback"`
 }
 
 type ServerConfig struct {
 	Port int    `mapstructure:"port"`
 	Mode string `mapstructure:"mode"`
+	// PublicURL is the scheme and host visitors reach redirects on, used
+	// in QR codes. Empty uses the host of the API request, taking the
+	// scheme from X-Forwarded-Proto only when a trusted proxy sends it.
+	PublicURL string `mapstructure:"public_url"`
 }
 
 type DatabaseConfig struct {
@@ -48,9 +56,141 @@ type SecurityConfig struct {
 	JWTExpireHours int    `mapstructure:"jwt_expire_hours"`
 }
 
+// RateLimitConfig holds the redirect limits applied to every link. A
+// limit of 0 or less disables it. Links may override the per-IP link limit.
+// Algorithms are the names in services.RateLimitAlgorithms; empty uses the
+// default.
 type RateLimitConfig struct {
-	IPLimitPerHour int `mapstructure:"ip_limit_per_hour"`
-	GlobalDailyCap int `mapstructure:"global_daily_cap"`
+	IPLimitPerHour         int    `mapstructure:"ip_limit_per_hour"`
+	IPLimitAlgorithm       string `mapstructure:"ip_limit_algorithm"`
+	IPLinkLimitPer12h      int    `mapstructure:"ip_link_limit_per_12h"`
+	IPLinkLimitAlgorithm   string `mapstructure:"ip_link_limit_algorithm"`
+	AutoBlockDurationHours int    `mapstructure:"auto_block_duration_hours"`
+	GlobalDailyCap         int    `mapstructure:"global_daily_cap"`
+}
+
+// DefaultRateLimits returns the limits used when the config file does not
+// set them.
+func DefaultRateLimits() RateLimitConfig {
+	return RateLimitConfig{
+		IPLimitPerHour:         100,
+		IPLinkLimitPer12h:      10,
+		AutoBlockDurationHours: 24,
+	}
+}
+
+// LinkIDFormat is the length and alphabet of generated link IDs.
+type LinkIDFormat struct {
+	Length   int    `mapstructure:"length"`
+	Alphabet string `mapstructure:"alphabet"`
+}
+
+// LinkIDConfig is the format of generated link IDs, with overrides by
+// business unit. Zero override fields use the default format.
+type LinkIDConfig struct {
+	LinkIDFormat  `mapstructure:",squash"`
+	BusinessUnits map[string]LinkIDFormat `mapstructure:"business_units"`
+}
+
+// DefaultLinkIDs returns the format used when the config file does not set
+// one: 6 lower-case hex characters.
+func DefaultLinkIDs() LinkIDConfig {
+	return LinkIDConfig{
+		LinkIDFormat: LinkIDFormat{
+			Length:   6,
+			Alphabet: "0123456789abcdef",
+		},
+	}
+}
+
+// FormatFor returns the format of link IDs generated for a business unit.
+func (c LinkIDConfig) FormatFor(businessUnit string) LinkIDFormat {
+	format := c.LinkIDFormat
+	if override, ok := c.BusinessUnits[businessUnit]; ok {
+		if override.Length > 0 {
+			format.Length = override.Length
+		}
+		if override.Alphabet != "" {
+			format.Alphabet = override.Alphabet
+		}
+	}
+	return format
+}
+
+// Validate checks that generated IDs fit Link.LinkID and can vary.
+func (f LinkIDFormat) Validate() error {
+	if f.Length < 4 || f.Length > 32 {
+		return fmt.Errorf("link ID length must be between 4 and 32")
+	}
+	seen := make(map[rune]bool)
+	for _, r := range f.Alphabet {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("link ID alphabet may only use letters, digits, '-' and '_'")
+		}
+		seen[r] = true
+	}
+	if len(seen) < 2 {
+		return fmt.Errorf("link ID alphabet needs at least 2 distinct characters")
+	}
+	return nil
+}
+
+// BotFilterConfig controls the classification of redirect visitors as
+// bots. DefaultAction is one of the models.Bot* actions and applies to
+// links that do not set their own.
+type BotFilterConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	DefaultAction string `mapstructure:"default_action"`
+	// CheckHeaders classifies visitors without the headers every browser
+	// sends as bots.
+	CheckHeaders bool `mapstructure:"check_headers"`
+	// DatacenterRangesFile lists datacenter CIDRs, one per line; empty
+	// disables the datacenter check.
+	DatacenterRangesFile string `mapstructure:"datacenter_ranges_file"`
+}
+
+// DefaultBotFilter returns the bot filter used when the config file does
+// not set one: bots are detected and recorded, but allowed.
+func DefaultBotFilter() BotFilterConfig {
+	return BotFilterConfig{
+		Enabled:       true,
+		DefaultAction: "allow",
+		CheckHeaders:  true,
+	}
+}
+
+// ClientIPConfig decides how the client address of a request is found.
+// Headers, in order of priority, are only read on connections from
+// TrustedProxies (CIDRs or addresses). ProxyProtocol accepts PROXY
+// protocol headers from trusted proxies.
+type ClientIPConfig struct {
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	Headers        []string `mapstructure:"headers"`
+	ProxyProtocol  bool     `mapstructure:"proxy_protocol"`
+}
+
+// DefaultClientIP returns the settings used when the config file does not
+// set them: only a proxy on the same host is trusted.
+func DefaultClientIP() ClientIPConfig {
+	return ClientIPConfig{
+		TrustedProxies: []string{"127.0.0.0/8", "::1"},
+		Headers:        []string{"X-Forwarded-For", "X-Real-IP"},
+	}
+}
+
+// PostbackConfig authenticates conversion postbacks, per network. Postbacks
+// for networks without an entry are refused.
+type PostbackConfig struct {
+	Networks map[string]PostbackNetworkConfig `mapstructure:"networks"`
+}
+
+// PostbackNetworkConfig is what a network's postbacks must match: the
+// shared Secret, sent as the token parameter, and when AllowedIPs (CIDRs
+// or addresses) is set, a client IP in one of them. At least one of the
+// two is required.
+type PostbackNetworkConfig struct {
+	Secret     string   `mapstructure:"secret"`
+	AllowedIPs []string `mapstructure:"allowed_ips"`
 }
 
 type LoggingConfig struct {
@@ -76,6 +216,24 @@ func Load(configPath string) (*Config, error) {
 	
 	viper.AutomaticEnv()
 	
+	defaults := DefaultRateLimits()
+	viper.SetDefault("rate_limit.ip_limit_per_hour", defaults.IPLimitPerHour)
+	viper.SetDefault("rate_limit.ip_link_limit_per_12h", defaults.IPLinkLimitPer12h)
+	viper.SetDefault("rate_limit.auto_block_duration_hours", defaults.AutoBlockDurationHours)
+	
+	linkIDs := DefaultLinkIDs()
+	viper.SetDefault("link_ids.length", linkIDs.Length)
+	viper.SetDefault("link_ids.alphabet", linkIDs.Alphabet)
+	
+	bots := DefaultBotFilter()
+	viper.SetDefault("bot_filter.enabled", bots.Enabled)
+	viper.SetDefault("bot_filter.default_action", bots.DefaultAction)
+	viper.SetDefault("bot_filter.check_headers", bots.CheckHeaders)
+	
+	clientIP := DefaultClientIP()
+	viper.SetDefault("client_ip.trusted_proxies", clientIP.TrustedProxies)
+	viper.SetDefault("client_ip.headers", clientIP.Headers)
+	
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -85,6 +243,15 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 	
+	if err := config.LinkIDs.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid link_ids: %w", err)
+	}
+	for bu := range config.LinkIDs.BusinessUnits {
+		if err := config.LinkIDs.FormatFor(bu).Validate(); err != nil {
+			return nil, fmt.Errorf("invalid link_ids for %s: %w", bu, err)
+		}
+	}
+	
 	return &config, nil
 }
 
@@ -45,6 +45,10 @@ func autoMigrate(db *gorm.DB) error {
 		&models.Target{},
 		&models.LinkPermission{},
 		&models.AccessLog{},
+		&models.CountryGroup{},
+		&models.Conversion{},
+		&models.IPRange{},
+		&models.CapPeriodUsage{},
 		&api.LinkTemplate{},
 	)
 }
\ No newline at end of file
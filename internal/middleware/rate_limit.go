@@ -8,13 +8,17 @@ import (
 	"github.com/redis/go-redis/v9"
 	
 	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/pkg/clientip"
 )
 
-func RateLimitMiddleware(redis *redis.Client, limit int, duration time.Duration) gin.HandlerFunc {
-	rateLimiter := services.NewRateLimiter(redis)
+// RateLimitMiddleware limits requests per client address, as resolved by
+// clientIPs, and blocks addresses that go over the limit. Addresses on the
+// block lists of ipRanges are refused.
+func RateLimitMiddleware(redis *redis.Client, ipRanges *services.IPRangeService, clientIPs *clientip.Resolver, limit int, duration time.Duration) gin.HandlerFunc {
+	rateLimiter := services.NewRateLimiter(redis, ipRanges)
 	
 	return func(c *gin.Context) {
-		ip := getClientIP(c)
+		ip := clientIPs.ClientIP(c.Request)
 		
 		blocked, reason := rateLimiter.IsIPBlocked(ip)
 		if blocked {
@@ -43,15 +47,3 @@ func RateLimitMiddleware(redis *redis.Client, limit int, duration time.Duration)
 		c.Next()
 	}
 }
-
-func getClientIP(c *gin.Context) string {
-	if ip := c.GetHeader("X-Real-IP"); ip != "" {
-		return ip
-	}
-	
-	if ip := c.GetHeader("X-Forwarded-For"); ip != "" {
-		return ip
-	}
-	
-	return c.ClientIP()
-}
\ No newline at end of file
@@ -5,15 +5,26 @@ import (
 )
 
 type AccessLog struct {
-	ID         uint      `gorm:"primaryKey" json:"id"`
-	LinkID     uint      `gorm:"index" json:"link_id"`
-	TargetID   uint      `gorm:"index" json:"target_id"`
-	IP         string    `gorm:"index;size:45" json:"ip"`
-	UserAgent  string    `json:"user_agent"`
-	Referer    string    `json:"referer"`
-	Country    string    `gorm:"size:2" json:"country"`
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	LinkID     uint   `gorm:"index" json:"link_id"`
+	TargetID   *uint  `gorm:"index" json:"target_id"`
+	IP         string `gorm:"index;size:45" json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	Referer    string `json:"referer"`
+	Country    string `gorm:"size:2" json:"country"`
+	DeviceType string `gorm:"size:20;index" json:"device_type"`
+	OS         string `gorm:"size:20;index" json:"os"`
+	Browser    string `gorm:"size:20" json:"browser"`
+	ClickID    string `gorm:"size:36;index" json:"click_id"`
+	// FallbackReason is set, and TargetID nil, when the visitor was sent
+	// down the link's fallback chain.
+	FallbackReason string `gorm:"size:20;index" json:"fallback_reason,omitempty"`
+	// BotVerdict is one of the BotVerdict* values, and BotReason the signal
+	// behind a bot verdict.
+	BotVerdict string    `gorm:"size:20;index" json:"bot_verdict,omitempty"`
+	BotReason  string    `gorm:"size:20" json:"bot_reason,omitempty"`
 	CreatedAt  time.Time `gorm:"index" json:"created_at"`
-	
+
 	Link   *Link   `gorm:"foreignKey:LinkID;references:ID" json:"link,omitempty"`
 	Target *Target `gorm:"foreignKey:TargetID;references:ID" json:"target,omitempty"`
-}
\ No newline at end of file
+}
@@ -0,0 +1,44 @@
+package models
+
+// Bot actions decide what happens to a visitor classified as a bot.
+const (
+	BotAllow  = "allow"  // treat the visitor as a human
+	BotBackup = "backup" // send the visitor down the fallback chain
+	BotBlock  = "block"  // respond 403
+	BotFlag   = "flag"   // redirect without counting against the caps
+)
+
+// IsValidBotAction reports whether action is known. Empty uses the
+// configured default.
+func IsValidBotAction(action string) bool {
+	switch action {
+	case "", BotAllow, BotBackup, BotBlock, BotFlag:
+		return true
+	}
+	return false
+}
+
+// Bot verdicts are recorded on access logs.
+const (
+	BotVerdictHuman   = "human"   // no bot signal
+	BotVerdictBot     = "bot"     // a bot, allowed or sent to the fallback chain
+	BotVerdictFlagged = "flagged" // a bot redirected without counting against the caps
+	BotVerdictBlocked = "blocked" // a bot refused by the block action
+)
+
+// Bot reasons name the signal that classified a visitor as a bot.
+const (
+	BotReasonKnownBot   = "known_bot"  // the User-Agent of a crawler or HTTP library
+	BotReasonHeadless   = "headless"   // the User-Agent of a headless browser
+	BotReasonHeaders    = "headers"    // browser headers missing or inconsistent
+	BotReasonDatacenter = "datacenter" // the IP is in a datacenter range
+)
+
+// BotActionOr returns the link's bot action, or the given default when the
+// link does not set one.
+func (l *Link) BotActionOr(defaultAction string) string {
+	if l.BotAction != "" {
+		return l.BotAction
+	}
+	return defaultAction
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Cap pacing spreads a periodic cap over its period instead of letting it
+// be used up as fast as traffic comes in.
+const (
+	PacingNone  = "none"  // the whole cap is available at once (default)
+	PacingEven  = "even"  // the cap opens linearly over the period
+	PacingCurve = "curve" // the cap opens following CapPacingCurve
+)
+
+// PacingCurveHours is the length of a pacing curve: one share per hour of
+// the day.
+const PacingCurveHours = 24
+
+// IsValidCapPacing reports whether pacing is known. Empty means none.
+func IsValidCapPacing(pacing string) bool {
+	switch pacing {
+	case "", PacingNone, PacingEven, PacingCurve:
+		return true
+	}
+	return false
+}
+
+// ValidateCapPacing checks a pacing mode together with the cap period and
+// curve it applies to. Pacing needs a periodic cap, and the curve mode a
+// curve of PacingCurveHours non-negative shares, not all zero.
+func ValidateCapPacing(pacing string, period string, curve []float64) error {
+	if !IsValidCapPacing(pacing) {
+		return fmt.Errorf("unknown cap pacing %q", pacing)
+	}
+	if pacing == "" || pacing == PacingNone {
+		return nil
+	}
+	if !IsPeriodicCap(period) {
+		return fmt.Errorf("cap pacing requires an hourly, daily or weekly cap period")
+	}
+	if pacing != PacingCurve {
+		return nil
+	}
+	if len(curve) != PacingCurveHours {
+		return fmt.Errorf("cap pacing curve must have %d hourly shares", PacingCurveHours)
+	}
+	total := 0.0
+	for _, share := range curve {
+		if share < 0 {
+			return fmt.Errorf("cap pacing curve shares must not be negative")
+		}
+		total += share
+	}
+	if total == 0 {
+		return fmt.Errorf("cap pacing curve must not be all zero")
+	}
+	return nil
+}
+
+// ParsePacingCurve decodes a CapPacingCurve column, returning nil when it
+// is empty or malformed.
+func ParsePacingCurve(raw string) []float64 {
+	if raw == "" {
+		return nil
+	}
+	var curve []float64
+	if err := json.Unmarshal([]byte(raw), &curve); err != nil {
+		return nil
+	}
+	return curve
+}
+
+// PaceCap returns how many hits of cap may have been used by at, in the
+// period starting at start. Unpaced and lifetime caps are returned as is.
+// The allowance is rounded up, so a hit goes through as soon as any share
+// of the period has elapsed. It is 0 at the exact start of the period, and
+// while the curve has given no share, which closes the cap.
+func PaceCap(cap int, period string, pacing string, curve []float64, start time.Time, at time.Time) int {
+	if cap <= 0 || !IsPeriodicCap(period) {
+		return cap
+	}
+
+	var share float64
+	switch pacing {
+	case PacingEven:
+		share = evenShare(period, start, at)
+	case PacingCurve:
+		if len(curve) != PacingCurveHours {
+			share = evenShare(period, start, at)
+		} else {
+			share = curveShare(period, curve, start, at)
+		}
+	default:
+		return cap
+	}
+
+	paced := int(math.Ceil(float64(cap) * math.Min(math.Max(share, 0), 1)))
+	if paced > cap {
+		return cap
+	}
+	return paced
+}
+
+// evenShare is the elapsed part of the period.
+func evenShare(period string, start time.Time, at time.Time) float64 {
+	end := nextCapPeriod(period, start)
+	return float64(at.Sub(start)) / float64(end.Sub(start))
+}
+
+// curveShare is the part of the curve elapsed in the period. Hourly caps
+// have no hours to weigh and open evenly; weekly caps give each day the
+// same share and follow the curve within the day.
+func curveShare(period string, curve []float64, start time.Time, at time.Time) float64 {
+	if period == CapHourly {
+		return evenShare(period, start, at)
+	}
+
+	days := 1
+	if period == CapWeekly {
+		days = 7
+	}
+	day := 0
+	for day < days-1 && !start.AddDate(0, 0, day+1).After(at) {
+		day++
+	}
+
+	local := at.In(start.Location())
+	hour := local.Hour()
+	withinHour := float64(local.Minute()*60+local.Second()) / 3600
+
+	total, elapsed := 0.0, 0.0
+	for h, weight := range curve {
+		total += weight
+		if h < hour {
+			elapsed += weight
+		}
+	}
+	elapsed += curve[hour] * withinHour
+
+	return (float64(day) + elapsed/total) / float64(days)
+}
+
+func nextCapPeriod(period string, start time.Time) time.Time {
+	switch period {
+	case CapHourly:
+		return start.Add(time.Hour)
+	case CapWeekly:
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// PacedTotalCap returns how much of TotalCap may have been used by at.
+func (l *Link) PacedTotalCap(at time.Time) int {
+	start := CapPeriodStart(l.CapPeriod, l.CapTimezone, at)
+	return PaceCap(l.TotalCap, l.CapPeriod, l.CapPacing, ParsePacingCurve(l.CapPacingCurve), start, at)
+}
+
+// PacedCap returns how much of the target's Cap may have been used by at.
+func (t *Target) PacedCap(link *Link, at time.Time) int {
+	start := CapPeriodStart(t.CapPeriod, t.CapTimezoneFor(link), at)
+	return PaceCap(t.Cap, t.CapPeriod, t.CapPacing, ParsePacingCurve(t.CapPacingCurve), start, at)
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaceCap(t *testing.T) {
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC) // Monday
+	at := func(days int, hours int, minutes int) time.Time {
+		return start.AddDate(0, 0, days).Add(time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute)
+	}
+
+	t.Run("Unpaced", func(t *testing.T) {
+		assert.Equal(t, 240, PaceCap(240, CapDaily, "", nil, start, at(0, 1, 0)))
+		assert.Equal(t, 240, PaceCap(240, CapLifetime, PacingEven, nil, start, at(0, 1, 0)))
+	})
+
+	t.Run("Even", func(t *testing.T) {
+		assert.Equal(t, 1, PaceCap(240, CapDaily, PacingEven, nil, start, at(0, 0, 1)))
+		assert.Equal(t, 60, PaceCap(240, CapDaily, PacingEven, nil, start, at(0, 6, 0)))
+		assert.Equal(t, 30, PaceCap(60, CapHourly, PacingEven, nil, start, at(0, 0, 30)))
+		assert.Equal(t, 70, PaceCap(140, CapWeekly, PacingEven, nil, start, at(3, 12, 0)))
+	})
+
+	t.Run("Curve", func(t *testing.T) {
+		// Nothing before 08:00, then 10 per hour for 12 hours, then nothing
+		curve := make([]float64, PacingCurveHours)
+		for h := 8; h < 20; h++ {
+			curve[h] = 1
+		}
+		assert.Equal(t, 0, PaceCap(120, CapDaily, PacingCurve, curve, start, at(0, 7, 59)))
+		assert.Equal(t, 15, PaceCap(120, CapDaily, PacingCurve, curve, start, at(0, 9, 30)))
+		assert.Equal(t, 120, PaceCap(120, CapDaily, PacingCurve, curve, start, at(0, 21, 0)))
+		// Each day of a week gets a seventh
+		assert.Equal(t, 30, PaceCap(140, CapWeekly, PacingCurve, curve, start, at(1, 14, 0)))
+	})
+}
+
+func TestValidateCapPacing(t *testing.T) {
+	curve := make([]float64, PacingCurveHours)
+	assert.NoError(t, ValidateCapPacing("", "", nil))
+	assert.NoError(t, ValidateCapPacing(PacingEven, CapDaily, nil))
+	assert.Error(t, ValidateCapPacing("fast", CapDaily, nil))
+	assert.Error(t, ValidateCapPacing(PacingEven, CapLifetime, nil))
+	assert.Error(t, ValidateCapPacing(PacingCurve, CapDaily, curve[:12]))
+	assert.Error(t, ValidateCapPacing(PacingCurve, CapDaily, curve))
+
+	curve[0] = -1
+	curve[1] = 2
+	assert.Error(t, ValidateCapPacing(PacingCurve, CapDaily, curve))
+	curve[0] = 0
+	assert.NoError(t, ValidateCapPacing(PacingCurve, CapDaily, curve))
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Cap periods decide when Link.TotalCap and Target.Cap start over.
+const (
+	CapLifetime = "lifetime" // never resets (default)
+	CapHourly   = "hourly"
+	CapDaily    = "daily"
+	CapWeekly   = "weekly" // weeks start on Monday
+)
+
+// IsValidCapPeriod reports whether period is known. Empty means lifetime.
+func IsValidCapPeriod(period string) bool {
+	switch period {
+	case "", CapLifetime, CapHourly, CapDaily, CapWeekly:
+		return true
+	}
+	return false
+}
+
+// ValidateCapTimezone checks an IANA zone used to reset caps. Empty means UTC.
+func ValidateCapTimezone(tz string) error {
+	if tz == "" {
+		return nil
+	}
+	if _, err := loadLocation(tz); err != nil {
+		return fmt.Errorf("invalid cap timezone %q", tz)
+	}
+	return nil
+}
+
+// IsPeriodicCap reports whether the cap resets.
+func IsPeriodicCap(period string) bool {
+	return period != "" && period != CapLifetime
+}
+
+// CapPeriodStart returns the start of the period containing at, in the
+// given zone. Lifetime caps have a single period starting at the zero time.
+func CapPeriodStart(period string, tz string, at time.Time) time.Time {
+	loc, err := loadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := at.In(loc)
+
+	switch period {
+	case CapHourly:
+		// Truncate rather than rebuild the local hour, which is ambiguous
+		// when clocks go back.
+		sinceHour := time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+		return local.Add(-sinceHour)
+	case CapDaily:
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	case CapWeekly:
+		daysSinceMonday := (int(local.Weekday()) + 6) % 7
+		return time.Date(local.Year(), local.Month(), local.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+	}
+	return time.Time{}
+}
+
+// PreviousCapPeriod returns the start of the period before the one
+// starting at start.
+func PreviousCapPeriod(period string, start time.Time) time.Time {
+	switch period {
+	case CapHourly:
+		return start.Add(-time.Hour)
+	case CapDaily:
+		return start.AddDate(0, 0, -1)
+	case CapWeekly:
+		return start.AddDate(0, 0, -7)
+	}
+	return start
+}
+
+// CapPeriodLabel names the period starting at start, e.g. "2024-03-01" for
+// a day or the week starting that Monday, and "2024-03-01T13+01:00" or
+// "2024-03-01T13Z" for an hour. Hours carry their offset so that the hour
+// repeated when clocks go back gets its own label. It is empty for
+// lifetime caps.
+func CapPeriodLabel(period string, start time.Time) string {
+	switch period {
+	case CapHourly:
+		return start.Format("2006-01-02T15Z07:00")
+	case CapDaily, CapWeekly:
+		return start.Format("2006-01-02")
+	}
+	return ""
+}
+
+// CapRetention is how long the counter of a finished period is kept for
+// reporting.
+func CapRetention(period string) time.Duration {
+	switch period {
+	case CapHourly:
+		return 8 * 24 * time.Hour
+	case CapDaily:
+		return 92 * 24 * time.Hour
+	case CapWeekly:
+		return 53 * 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// CapTimezoneFor returns the zone the target's cap resets in: its own, or
+// the link's when it has none.
+func (t *Target) CapTimezoneFor(link *Link) string {
+	if t.CapTimezone != "" || link == nil {
+		return t.CapTimezone
+	}
+	return link.CapTimezone
+}
+
+// Cap usage scopes: whose cap a CapPeriodUsage counts.
+const (
+	CapScopeLink   = "link"
+	CapScopeTarget = "target"
+)
+
+// CapPeriodUsage is the number of hits counted in a finished period of a
+// link or target cap. The live counters are in Redis and expire after
+// CapRetention; finished periods are archived here so that reports do not
+// depend on them.
+type CapPeriodUsage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Scope     string    `gorm:"size:10;uniqueIndex:idx_cap_usage_period" json:"scope"`
+	OwnerID   uint      `gorm:"uniqueIndex:idx_cap_usage_period" json:"owner_id"`
+	CapPeriod string    `gorm:"size:20;uniqueIndex:idx_cap_usage_period" json:"cap_period"`
+	Period    string    `gorm:"size:20;uniqueIndex:idx_cap_usage_period" json:"period"`
+	Hits      int       `json:"hits"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
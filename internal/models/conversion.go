@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// Conversion statuses reported by postbacks.
+const (
+	ConversionApproved = "approved"
+	ConversionPending  = "pending"
+	ConversionRejected = "rejected"
+)
+
+// Conversion is a conversion reported by a network postback for the click
+// recorded in an AccessLog.
+type Conversion struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ClickID       string    `gorm:"uniqueIndex:idx_conversion_click_txn;size:36" json:"click_id"`
+	TransactionID string    `gorm:"uniqueIndex:idx_conversion_click_txn;size:100" json:"transaction_id"`
+	AccessLogID   uint      `gorm:"index" json:"access_log_id"`
+	LinkID        uint      `gorm:"index" json:"link_id"`
+	TargetID      *uint     `gorm:"index" json:"target_id"`
+	Payout        float64   `json:"payout"`
+	Status        string    `gorm:"size:20;index" json:"status"`
+	IP            string    `gorm:"size:45" json:"ip"`
+	CreatedAt     time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	AccessLog *AccessLog `gorm:"foreignKey:AccessLogID;references:ID" json:"access_log,omitempty"`
+	Link      *Link      `gorm:"foreignKey:LinkID;references:ID" json:"link,omitempty"`
+	Target    *Target    `gorm:"foreignKey:TargetID;references:ID" json:"target,omitempty"`
+}
+
+// IsValidConversionStatus reports whether status is a known conversion status.
+func IsValidConversionStatus(status string) bool {
+	switch status {
+	case ConversionApproved, ConversionPending, ConversionRejected:
+		return true
+	}
+	return false
+}
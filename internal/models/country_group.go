@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// CountryGroup is a named set of country codes, such as AFRICA or LATAM,
+// that can be used anywhere a target lists countries.
+type CountryGroup struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;size:50" json:"name"`
+	Description string    `json:"description"`
+	Countries   string    `json:"countries"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CountryList returns the group's country codes.
+func (g *CountryGroup) CountryList() []string {
+	return ParseStringList(g.Countries)
+}
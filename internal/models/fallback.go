@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// Fallback reasons say why a visitor could not be sent to a target.
+const (
+	FallbackCapReached  = "cap_reached"  // the link's total cap is reached or over pace
+	FallbackNoTarget    = "no_target"    // no target is eligible for the visitor
+	FallbackGeoMismatch = "geo_mismatch" // targets exist but none for the visitor's location
+	FallbackRateLimited = "rate_limited" // the visitor is over the link's rate limit
+	FallbackBot         = "bot"          // the visitor is a bot and the link's bot action is backup
+)
+
+// FallbackReasons lists the valid reasons.
+var FallbackReasons = []string{
+	FallbackCapReached,
+	FallbackNoTarget,
+	FallbackGeoMismatch,
+	FallbackRateLimited,
+	FallbackBot,
+}
+
+// Fallback is one entry of a link's fallback chain. Entries are tried in
+// order and the first one matching the visitor's country and the reason is
+// used. Empty Countries or Reasons match everything.
+type Fallback struct {
+	URL       string   `json:"url"`
+	Countries []string `json:"countries,omitempty"`
+	Reasons   []string `json:"reasons,omitempty"`
+}
+
+// IsValidFallbackReason reports whether reason is known.
+func IsValidFallbackReason(reason string) bool {
+	return containsString(FallbackReasons, reason)
+}
+
+// ValidateFallbacks checks the URLs and reasons of a fallback chain.
+// Countries are checked by the caller, which knows the country groups.
+func ValidateFallbacks(fallbacks []Fallback) error {
+	for i, fallback := range fallbacks {
+		u, err := url.Parse(fallback.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("fallback %d: invalid url %q", i, fallback.URL)
+		}
+		for _, reason := range fallback.Reasons {
+			if !IsValidFallbackReason(reason) {
+				return fmt.Errorf("fallback %d: unknown reason %q", i, reason)
+			}
+		}
+	}
+	return nil
+}
+
+// GetFallbacks returns the link's fallback chain, or nil when it has none.
+func (l *Link) GetFallbacks() []Fallback {
+	if l.Fallbacks == "" {
+		return nil
+	}
+	var fallbacks []Fallback
+	if err := json.Unmarshal([]byte(l.Fallbacks), &fallbacks); err != nil {
+		return nil
+	}
+	return fallbacks
+}
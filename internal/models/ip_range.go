@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// IP range lists. Allowlisted addresses are never blocked.
+const (
+	IPRangeBlock = "block"
+	IPRangeAllow = "allow"
+)
+
+// IsValidIPRangeList reports whether list is known.
+func IsValidIPRangeList(list string) bool {
+	return list == IPRangeBlock || list == IPRangeAllow
+}
+
+// IPRange is an IPv4 or IPv6 CIDR on the block or allow list. Source labels
+// where the entry came from, such as the name of an uploaded file, so that
+// a list can be replaced as a whole.
+type IPRange struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CIDR      string     `gorm:"column:cidr;size:50;uniqueIndex:idx_ip_ranges_cidr_list" json:"cidr"`
+	List      string     `gorm:"size:10;uniqueIndex:idx_ip_ranges_cidr_list" json:"list"`
+	Source    string     `gorm:"size:100;index" json:"source"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// BlockReason describes why a blocked IP matched the entry.
+func (r *IPRange) BlockReason() string {
+	if r.Reason != "" {
+		return r.Reason
+	}
+	if r.Source != "" {
+		return "listed in " + r.Source
+	}
+	return "listed in " + r.CIDR
+}
+
+// IsExpiredAt reports whether the entry no longer applies at t.
+func (r *IPRange) IsExpiredAt(t time.Time) bool {
+	return r.ExpiresAt != nil && !t.Before(*r.ExpiresAt)
+}
@@ -1,40 +1,83 @@
 package models
 
 import (
-	"time"
 	"gorm.io/gorm"
+	"time"
 )
 
 type Link struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	LinkID      string    `gorm:"uniqueIndex;size:10" json:"link_id"`
-	BusinessUnit string   `gorm:"size:10" json:"business_unit"`
-	Network     string    `gorm:"size:50" json:"network"`
-	TotalCap    int       `json:"total_cap"`
-	CurrentHits int       `json:"current_hits"`
-	BackupURL   string    `json:"backup_url"`
-	IsActive    bool      `gorm:"default:true" json:"is_active"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
-	
-	Targets []Target `gorm:"foreignKey:LinkID;references:ID" json:"targets,omitempty"`
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	LinkID             string         `gorm:"uniqueIndex;size:32" json:"link_id"`
+	BusinessUnit       string         `gorm:"size:10" json:"business_unit"`
+	Network            string         `gorm:"size:50" json:"network"`
+	TotalCap           int            `json:"total_cap"`
+	CapPeriod          string         `gorm:"size:20" json:"cap_period"`
+	CapTimezone        string         `gorm:"size:50" json:"cap_timezone"`
+	CapPacing          string         `gorm:"size:20" json:"cap_pacing"`
+	CapPacingCurve     string         `json:"cap_pacing_curve"`
+	CurrentHits        int            `json:"current_hits"`
+	PeriodHits         int            `gorm:"-" json:"period_hits"`
+	BackupURL          string         `json:"backup_url"`
+	Fallbacks          string         `json:"fallbacks"`
+	SelectionStrategy  string         `gorm:"size:20" json:"selection_strategy"`
+	RateLimit          int            `json:"rate_limit"`
+	RateLimitWindow    int            `json:"rate_limit_window"`
+	RateLimitAction    string         `gorm:"size:20" json:"rate_limit_action"`
+	RateLimitAlgorithm string         `gorm:"size:20" json:"rate_limit_algorithm"`
+	RateLimitTargetID  uint           `json:"rate_limit_target_id"`
+	BotAction          string         `gorm:"size:20" json:"bot_action"`
+	StartsAt           *time.Time     `gorm:"index" json:"starts_at"`
+	ExpiresAt          *time.Time     `gorm:"index" json:"expires_at"`
+	ExpiryAction       string         `gorm:"size:20" json:"expiry_action"`
+	ExpiryURL          string         `json:"expiry_url"`
+	PreviewTitle       string         `gorm:"size:200" json:"preview_title"`
+	PreviewDescription string         `gorm:"size:500" json:"preview_description"`
+	PreviewImage       string         `json:"preview_image"`
+	IsActive           bool           `gorm:"default:true" json:"is_active"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Targets     []Target         `gorm:"foreignKey:LinkID;references:ID" json:"targets,omitempty"`
 	Permissions []LinkPermission `gorm:"foreignKey:LinkID;references:ID" json:"permissions,omitempty"`
 }
 
 type Target struct {
-	ID            uint      `gorm:"primaryKey" json:"id"`
-	LinkID        uint      `gorm:"index" json:"link_id"`
-	URL           string    `json:"url"`
-	Weight        int       `json:"weight"`
-	Cap           int       `json:"cap"`
-	CurrentHits   int       `json:"current_hits"`
-	Countries     string    `json:"countries"`
-	ParamMapping  string    `gorm:"type:jsonb" json:"param_mapping"`
-	StaticParams  string    `gorm:"type:jsonb" json:"static_params"`
-	IsActive      bool      `gorm:"default:true" json:"is_active"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
-	
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	LinkID            uint       `gorm:"index" json:"link_id"`
+	URL               string     `json:"url"`
+	Weight            int        `json:"weight"`
+	CountryWeights    string     `json:"country_weights"`
+	Priority          int        `gorm:"default:0" json:"priority"`
+	Cap               int        `json:"cap"`
+	CapPeriod         string     `gorm:"size:20" json:"cap_period"`
+	CapTimezone       string     `gorm:"size:50" json:"cap_timezone"`
+	CapPacing         string     `gorm:"size:20" json:"cap_pacing"`
+	CapPacingCurve    string     `json:"cap_pacing_curve"`
+	CurrentHits       int        `json:"current_hits"`
+	PeriodHits        int        `gorm:"-" json:"period_hits"`
+	Countries         string     `json:"countries"`
+	ExcludedCountries string     `json:"excluded_countries"`
+	ParamMapping      string     `gorm:"type:jsonb" json:"param_mapping"`
+	StaticParams      string     `gorm:"type:jsonb" json:"static_params"`
+	Transforms        string     `json:"transforms"`
+	PassthroughMode   string     `gorm:"size:20" json:"passthrough_mode"`
+	PassthroughParams string     `json:"passthrough_params"`
+	MergePolicy       string     `gorm:"size:20" json:"merge_policy"`
+	Schedule          string     `json:"schedule"`
+	DeviceTypes       string     `json:"device_types"`
+	OperatingSystems  string     `json:"operating_systems"`
+	Browsers          string     `json:"browsers"`
+	Languages         string     `json:"languages"`
+	Regions           string     `json:"regions"`
+	ExcludedRegions   string     `json:"excluded_regions"`
+	Cities            string     `json:"cities"`
+	ExcludedCities    string     `json:"excluded_cities"`
+	StartsAt          *time.Time `gorm:"index" json:"starts_at"`
+	ExpiresAt         *time.Time `gorm:"index" json:"expires_at"`
+	IsActive          bool       `gorm:"default:true" json:"is_active"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+
 	Link *Link `gorm:"foreignKey:LinkID" json:"link,omitempty"`
-}
\ No newline at end of file
+}
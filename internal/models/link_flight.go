@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Expiry actions decide what visitors of an expired link get.
+const (
+	ExpiryNotFound = "not_found" // respond 404 (default)
+	ExpiryBackup   = "backup"    // redirect to BackupURL, or 404 when it is empty
+	ExpiryRedirect = "redirect"  // redirect to ExpiryURL
+)
+
+// IsValidExpiryAction reports whether action is known. Empty means not_found.
+func IsValidExpiryAction(action string) bool {
+	switch action {
+	case "", ExpiryNotFound, ExpiryBackup, ExpiryRedirect:
+		return true
+	}
+	return false
+}
+
+// ValidateFlight checks flight dates: the end, when set, must come after
+// the start.
+func ValidateFlight(startsAt *time.Time, expiresAt *time.Time) error {
+	if startsAt != nil && expiresAt != nil && !expiresAt.After(*startsAt) {
+		return fmt.Errorf("expires_at must be after starts_at")
+	}
+	return nil
+}
+
+// ValidateExpiry checks an expiry action and the URL it needs.
+func ValidateExpiry(action string, expiryURL string) error {
+	if !IsValidExpiryAction(action) {
+		return fmt.Errorf("unknown expiry action %q", action)
+	}
+	if action != ExpiryRedirect {
+		return nil
+	}
+	u, err := url.Parse(expiryURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("expiry_url must be an http or https URL")
+	}
+	return nil
+}
+
+// inFlight reports whether at is within the flight dates. Unset dates are
+// open-ended.
+func inFlight(startsAt *time.Time, expiresAt *time.Time, at time.Time) bool {
+	if startsAt != nil && at.Before(*startsAt) {
+		return false
+	}
+	return expiresAt == nil || at.Before(*expiresAt)
+}
+
+// HasStartedAt reports whether the link's flight has started at the given
+// time.
+func (l *Link) HasStartedAt(at time.Time) bool {
+	return l.StartsAt == nil || !at.Before(*l.StartsAt)
+}
+
+// HasExpiredAt reports whether the link's flight has ended at the given
+// time.
+func (l *Link) HasExpiredAt(at time.Time) bool {
+	return l.ExpiresAt != nil && !at.Before(*l.ExpiresAt)
+}
+
+// ExpiryRedirectURL returns where visitors of the expired link go, or an
+// empty string for a 404.
+func (l *Link) ExpiryRedirectURL() string {
+	switch l.ExpiryAction {
+	case ExpiryBackup:
+		return l.BackupURL
+	case ExpiryRedirect:
+		return l.ExpiryURL
+	}
+	return ""
+}
+
+// IsInFlightAt reports whether the target's flight dates allow traffic at
+// the given time.
+func (t *Target) IsInFlightAt(at time.Time) bool {
+	return inFlight(t.StartsAt, t.ExpiresAt, at)
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLink_Flight(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	link := &Link{StartsAt: &start, ExpiresAt: &end, BackupURL: "https://backup.example.com"}
+
+	assert.False(t, link.HasStartedAt(start.Add(-time.Second)))
+	assert.True(t, link.HasStartedAt(start))
+	assert.False(t, link.HasExpiredAt(end.Add(-time.Second)))
+	assert.True(t, link.HasExpiredAt(end))
+
+	assert.Equal(t, "", link.ExpiryRedirectURL())
+	link.ExpiryAction = ExpiryBackup
+	assert.Equal(t, "https://backup.example.com", link.ExpiryRedirectURL())
+
+	target := &Target{ExpiresAt: &end}
+	assert.True(t, target.IsInFlightAt(start))
+	assert.False(t, target.IsInFlightAt(end))
+
+	assert.Error(t, ValidateFlight(&end, &start))
+	assert.Error(t, ValidateExpiry(ExpiryRedirect, ""))
+	assert.NoError(t, ValidateExpiry(ExpiryRedirect, "https://ended.example.com"))
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Rate limit actions decide what happens to a visitor who exceeds a link's
+// per-IP limit.
+const (
+	RateLimitReject = "reject" // respond 429 (default)
+	RateLimitBackup = "backup" // redirect to the link's BackupURL
+	RateLimitTarget = "target" // send to the link's RateLimitTargetID
+)
+
+// IsValidRateLimitAction reports whether action is known. Empty means reject.
+func IsValidRateLimitAction(action string) bool {
+	switch action {
+	case "", RateLimitReject, RateLimitBackup, RateLimitTarget:
+		return true
+	}
+	return false
+}
+
+// IPLimit returns the number of visits allowed per IP to this link and the
+// window they are counted over, falling back to the given defaults when the
+// link does not override them.
+func (l *Link) IPLimit(defaultLimit int, defaultWindow time.Duration) (int, time.Duration) {
+	limit, window := defaultLimit, defaultWindow
+	if l.RateLimit > 0 {
+		limit = l.RateLimit
+	}
+	if l.RateLimitWindow > 0 {
+		window = time.Duration(l.RateLimitWindow) * time.Second
+	}
+	return limit, window
+}
+
+// OverLimitTarget returns the active target visitors over the limit are
+// sent to, or nil when the link does not designate one.
+func (l *Link) OverLimitTarget() *Target {
+	if l.RateLimitAction != RateLimitTarget || l.RateLimitTargetID == 0 {
+		return nil
+	}
+	for i := range l.Targets {
+		if l.Targets[i].ID == l.RateLimitTargetID && l.Targets[i].IsActive {
+			return &l.Targets[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLink_IPLimit(t *testing.T) {
+	limit, window := (&Link{}).IPLimit(10, 12*time.Hour)
+	assert.Equal(t, 10, limit)
+	assert.Equal(t, 12*time.Hour, window)
+
+	limit, window = (&Link{RateLimit: 3, RateLimitWindow: 600}).IPLimit(10, 12*time.Hour)
+	assert.Equal(t, 3, limit)
+	assert.Equal(t, 10*time.Minute, window)
+}
+
+func TestLink_OverLimitTarget(t *testing.T) {
+	link := &Link{
+		RateLimitAction:   RateLimitTarget,
+		RateLimitTargetID: 2,
+		Targets: []Target{
+			{ID: 1, IsActive: true},
+			{ID: 2, IsActive: true},
+		},
+	}
+	assert.Equal(t, uint(2), link.OverLimitTarget().ID)
+
+	link.Targets[1].IsActive = false
+	assert.Nil(t, link.OverLimitTarget())
+
+	link.Targets[1].IsActive = true
+	link.RateLimitAction = RateLimitReject
+	assert.Nil(t, link.OverLimitTarget())
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+)
+
+// PublicURL returns the address visitors use for the link under the given
+// base URL, e.g. "https://go.example.com/v1/bu01/abc123?network=mi".
+func (l *Link) PublicURL(base string) string {
+	u := strings.TrimRight(base, "/") + "/v1/" + url.PathEscape(l.BusinessUnit) + "/" + url.PathEscape(l.LinkID)
+	if l.Network != "" {
+		u += "?network=" + url.QueryEscape(l.Network)
+	}
+	return u
+}
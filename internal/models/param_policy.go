@@ -0,0 +1,55 @@
+package models
+
+// Passthrough modes decide which incoming query params are forwarded to a
+// target.
+const (
+	PassthroughAll       = "all"       // forward every param (default)
+	PassthroughAllowlist = "allowlist" // forward only PassthroughParams
+	PassthroughDenylist  = "denylist"  // forward everything except PassthroughParams
+)
+
+// Merge policies decide what happens when an outgoing param is already in
+// the target URL's query.
+const (
+	MergeOverride = "override" // the outgoing value replaces the URL's (default)
+	MergeKeep     = "keep"     // the URL's value is kept
+	MergeAppend   = "append"   // both are kept, the URL's first
+)
+
+// IsValidPassthroughMode reports whether mode is known. Empty means all.
+func IsValidPassthroughMode(mode string) bool {
+	switch mode {
+	case "", PassthroughAll, PassthroughAllowlist, PassthroughDenylist:
+		return true
+	}
+	return false
+}
+
+// IsValidMergePolicy reports whether policy is known. Empty means override.
+func IsValidMergePolicy(policy string) bool {
+	switch policy {
+	case "", MergeOverride, MergeKeep, MergeAppend:
+		return true
+	}
+	return false
+}
+
+// PassesThrough reports whether an incoming param is forwarded to the target.
+func (t *Target) PassesThrough(name string) bool {
+	switch t.PassthroughMode {
+	case PassthroughAllowlist:
+		return containsString(ParseStringList(t.PassthroughParams), name)
+	case PassthroughDenylist:
+		return !containsString(ParseStringList(t.PassthroughParams), name)
+	}
+	return true
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Parameter transformation operations.
+const (
+	TransformSet       = "set"       // always set Value
+	TransformDefault   = "default"   // set Value when the param is missing or empty
+	TransformDrop      = "drop"      // remove the param
+	TransformExtract   = "extract"   // keep the first capture group of Pattern, or the whole match
+	TransformReplace   = "replace"   // replace matches of Pattern with Replacement ($1 allowed)
+	TransformLower     = "lower"     // lowercase the value
+	TransformUpper     = "upper"     // uppercase the value
+	TransformURLEncode = "urlencode" // query-escape the value
+	TransformBase64    = "base64"    // standard base64 encoding of the value
+	TransformSHA256    = "sha256"    // hex SHA-256 of the value
+)
+
+var transformOps = map[string]bool{
+	TransformSet:       true,
+	TransformDefault:   true,
+	TransformDrop:      true,
+	TransformExtract:   true,
+	TransformReplace:   true,
+	TransformLower:     true,
+	TransformUpper:     true,
+	TransformURLEncode: true,
+	TransformBase64:    true,
+	TransformSHA256:    true,
+}
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+var patternCache sync.Map
+
+// ParamTransform is one step of a target's parameter pipeline. Steps run in
+// order on the outgoing parameters, after ParamMapping and StaticParams.
+// A step with Countries or Networks only runs for matching visits.
+type ParamTransform struct {
+	Op          string   `json:"op"`
+	Param       string   `json:"param"`
+	Value       string   `json:"value,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Replacement string   `json:"replacement,omitempty"`
+	Countries   []string `json:"countries,omitempty"`
+	Networks    []string `json:"networks,omitempty"`
+}
+
+// TransformContext is what conditional steps are matched against.
+type TransformContext struct {
+	Country string
+	Network string
+}
+
+// Validate checks the operation, the parameter name, the pattern and the
+// condition of the step.
+func (p *ParamTransform) Validate() error {
+	if !transformOps[p.Op] {
+		return fmt.Errorf("unknown operation %q", p.Op)
+	}
+	if strings.TrimSpace(p.Param) == "" {
+		return fmt.Errorf("%s: param is required", p.Op)
+	}
+	switch p.Op {
+	case TransformExtract, TransformReplace:
+		if p.Pattern == "" {
+			return fmt.Errorf("%s: pattern is required", p.Op)
+		}
+		if _, err := compilePattern(p.Pattern); err != nil {
+			return fmt.Errorf("%s: invalid pattern: %v", p.Op, err)
+		}
+	}
+	for _, country := range p.Countries {
+		if !countryCodePattern.MatchString(strings.ToUpper(country)) {
+			return fmt.Errorf("%s: invalid country %q", p.Op, country)
+		}
+	}
+	for _, network := range p.Networks {
+		if strings.TrimSpace(network) == "" {
+			return fmt.Errorf("%s: empty network", p.Op)
+		}
+	}
+	return nil
+}
+
+// ValidateTransforms validates every step, reporting the first error with
+// its position.
+func ValidateTransforms(steps []ParamTransform) error {
+	for i := range steps {
+		if err := steps[i].Validate(); err != nil {
+			return fmt.Errorf("transform %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Applies reports whether the step's condition matches the visit.
+func (p *ParamTransform) Applies(ctx TransformContext) bool {
+	if len(p.Countries) > 0 && !containsFold(p.Countries, ctx.Country) {
+		return false
+	}
+	if len(p.Networks) > 0 && !containsFold(p.Networks, ctx.Network) {
+		return false
+	}
+	return true
+}
+
+// ApplyTransforms runs the steps in order on params, which is modified in
+// place and returned. Value operations apply to every value of a repeated
+// param. Steps with an invalid pattern are skipped.
+func ApplyTransforms(steps []ParamTransform, params url.Values, ctx TransformContext) url.Values {
+	if params == nil {
+		params = make(url.Values)
+	}
+
+	for i := range steps {
+		step := &steps[i]
+		if !step.Applies(ctx) {
+			continue
+		}
+
+		switch step.Op {
+		case TransformSet:
+			params.Set(step.Param, step.Value)
+			continue
+		case TransformDefault:
+			if params.Get(step.Param) == "" {
+				params.Set(step.Param, step.Value)
+			}
+			continue
+		case TransformDrop:
+			params.Del(step.Param)
+			continue
+		}
+
+		transform := step.valueFunc()
+		if transform == nil {
+			continue
+		}
+		for j, value := range params[step.Param] {
+			params[step.Param][j] = transform(value)
+		}
+	}
+
+	return params
+}
+
+// valueFunc returns the function applied to each value of the param, or
+// nil when the step cannot run.
+func (p *ParamTransform) valueFunc() func(string) string {
+	switch p.Op {
+	case TransformExtract:
+		re, err := compilePattern(p.Pattern)
+		if err != nil {
+			return nil
+		}
+		return func(value string) string {
+			match := re.FindStringSubmatch(value)
+			switch {
+			case match == nil:
+				return value
+			case len(match) > 1:
+				return match[1]
+			default:
+				return match[0]
+			}
+		}
+	case TransformReplace:
+		re, err := compilePattern(p.Pattern)
+		if err != nil {
+			return nil
+		}
+		return func(value string) string {
+			return re.ReplaceAllString(value, p.Replacement)
+		}
+	case TransformLower:
+		return strings.ToLower
+	case TransformUpper:
+		return strings.ToUpper
+	case TransformURLEncode:
+		return url.QueryEscape
+	case TransformBase64:
+		return func(value string) string {
+			return base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	case TransformSHA256:
+		return func(value string) string {
+			sum := sha256.Sum256([]byte(value))
+			return hex.EncodeToString(sum[:])
+		}
+	}
+	return nil
+}
+
+// GetTransforms parses the target's parameter pipeline. It returns nil
+// when the target has none or the column is malformed.
+func (t *Target) GetTransforms() []ParamTransform {
+	if t.Transforms == "" {
+		return nil
+	}
+	var steps []ParamTransform
+	if err := json.Unmarshal([]byte(t.Transforms), &steps); err != nil {
+		return nil
+	}
+	return steps
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
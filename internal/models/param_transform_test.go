@@ -0,0 +1,69 @@
+package models
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamTransform_Validate(t *testing.T) {
+	valid := []ParamTransform{
+		{Op: TransformDefault, Param: "src", Value: "organic"},
+		{Op: TransformExtract, Param: "kw", Pattern: `^(\w+)`},
+		{Op: TransformSet, Param: "geo", Value: "af", Countries: []string{"ng"}, Networks: []string{"fb"}},
+	}
+	assert.NoError(t, ValidateTransforms(valid))
+
+	invalid := map[string]ParamTransform{
+		"unknown op":      {Op: "reverse", Param: "kw"},
+		"missing param":   {Op: TransformLower},
+		"missing pattern": {Op: TransformReplace, Param: "kw"},
+		"bad pattern":     {Op: TransformExtract, Param: "kw", Pattern: "(["},
+		"bad country":     {Op: TransformSet, Param: "kw", Countries: []string{"NGA"}},
+	}
+	for name, step := range invalid {
+		assert.Error(t, step.Validate(), name)
+	}
+}
+
+func TestApplyTransforms(t *testing.T) {
+	steps := []ParamTransform{
+		{Op: TransformDefault, Param: "src", Value: "organic"},
+		{Op: TransformDrop, Param: "debug"},
+		{Op: TransformExtract, Param: "campaign", Pattern: `cmp-(\d+)`},
+		{Op: TransformReplace, Param: "kw", Pattern: `\s+`, Replacement: "-"},
+		{Op: TransformLower, Param: "kw"},
+		{Op: TransformUpper, Param: "geo"},
+		{Op: TransformURLEncode, Param: "ref"},
+		{Op: TransformBase64, Param: "b64"},
+		{Op: TransformSHA256, Param: "email"},
+		{Op: TransformSet, Param: "offer", Value: "ng", Countries: []string{"NG"}},
+		{Op: TransformSet, Param: "offer", Value: "fb", Networks: []string{"FB"}},
+	}
+	params := url.Values{
+		"debug":    {"1"},
+		"campaign": {"summer-cmp-42-x"},
+		"kw":       {"Cheap  Flights", "Hotel  Deals"},
+		"geo":      {"ng"},
+		"ref":      {"a b&c"},
+		"b64":      {"hello"},
+		"email":    {"user@example.com"},
+	}
+
+	result := ApplyTransforms(steps, params, TransformContext{Country: "NG", Network: "mi"})
+
+	assert.Equal(t, "organic", result.Get("src"))
+	assert.NotContains(t, result, "debug")
+	assert.Equal(t, "42", result.Get("campaign"))
+	assert.Equal(t, []string{"cheap-flights", "hotel-deals"}, result["kw"])
+	assert.Equal(t, "NG", result.Get("geo"))
+	assert.Equal(t, "a+b%26c", result.Get("ref"))
+	assert.Equal(t, "aGVsbG8=", result.Get("b64"))
+	assert.Equal(t, "b4c9a289323b21a01c3e940f150eb9b8c542587f1abfd8f0e1cc1ffc5e475514", result.Get("email"))
+	assert.Equal(t, "ng", result.Get("offer"))
+
+	// Steps on missing params are no-ops, except set and default
+	result = ApplyTransforms(steps, url.Values{}, TransformContext{Network: "fb"})
+	assert.Equal(t, url.Values{"src": {"organic"}, "offer": {"fb"}}, result)
+}
@@ -3,22 +3,46 @@ package models
 import (
 	"encoding/json"
 	"gorm.io/gorm"
+	"time"
 )
 
 // TargetResponse is the response structure with parsed JSON fields
 type TargetResponse struct {
-	ID            uint                   `json:"id"`
-	LinkID        uint                   `json:"link_id"`
-	URL           string                 `json:"url"`
-	Weight        int                    `json:"weight"`
-	Cap           int                    `json:"cap"`
-	CurrentHits   int                    `json:"current_hits"`
-	Countries     []string               `json:"countries"`
-	ParamMapping  map[string]string      `json:"param_mapping"`
-	StaticParams  map[string]string      `json:"static_params"`
-	IsActive      bool                   `json:"is_active"`
-	CreatedAt     string                 `json:"created_at"`
-	UpdatedAt     string                 `json:"updated_at"`
+	ID                uint              `json:"id"`
+	LinkID            uint              `json:"link_id"`
+	URL               string            `json:"url"`
+	Weight            int               `json:"weight"`
+	CountryWeights    map[string]int    `json:"country_weights"`
+	Priority          int               `json:"priority"`
+	Cap               int               `json:"cap"`
+	CapPeriod         string            `json:"cap_period"`
+	CapTimezone       string            `json:"cap_timezone"`
+	CapPacing         string            `json:"cap_pacing"`
+	CapPacingCurve    []float64         `json:"cap_pacing_curve"`
+	CurrentHits       int               `json:"current_hits"`
+	PeriodHits        int               `json:"period_hits"`
+	Countries         []string          `json:"countries"`
+	ExcludedCountries []string          `json:"excluded_countries"`
+	ParamMapping      map[string]string `json:"param_mapping"`
+	StaticParams      map[string]string `json:"static_params"`
+	Transforms        []ParamTransform  `json:"transforms"`
+	PassthroughMode   string            `json:"passthrough_mode"`
+	PassthroughParams []string          `json:"passthrough_params"`
+	MergePolicy       string            `json:"merge_policy"`
+	Schedule          *TargetSchedule   `json:"schedule"`
+	DeviceTypes       []string          `json:"device_types"`
+	OperatingSystems  []string          `json:"operating_systems"`
+	Browsers          []string          `json:"browsers"`
+	Languages         []string          `json:"languages"`
+	Regions           []string          `json:"regions"`
+	ExcludedRegions   []string          `json:"excluded_regions"`
+	Cities            []string          `json:"cities"`
+	ExcludedCities    []string          `json:"excluded_cities"`
+	StartsAt          *time.Time        `json:"starts_at"`
+	ExpiresAt         *time.Time        `json:"expires_at"`
+	IsActive          bool              `json:"is_active"`
+	CreatedAt         string            `json:"created_at"`
+	UpdatedAt         string            `json:"updated_at"`
 }
 
 // AfterFind hook to parse JSON fields
@@ -35,13 +59,20 @@ func (t *Target) ToResponse() TargetResponse {
 		LinkID:      t.LinkID,
 		URL:         t.URL,
 		Weight:      t.Weight,
+		Priority:    t.Priority,
 		Cap:         t.Cap,
+		CapPeriod:   t.CapPeriod,
+		CapTimezone: t.CapTimezone,
+		CapPacing:   t.CapPacing,
 		CurrentHits: t.CurrentHits,
+		PeriodHits:  t.PeriodHits,
+		StartsAt:    t.StartsAt,
+		ExpiresAt:   t.ExpiresAt,
 		IsActive:    t.IsActive,
 		CreatedAt:   t.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		UpdatedAt:   t.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
-	
+
 	// Parse countries
 	if t.Countries != "" {
 		json.Unmarshal([]byte(t.Countries), &resp.Countries)
@@ -49,7 +80,7 @@ func (t *Target) ToResponse() TargetResponse {
 	if resp.Countries == nil {
 		resp.Countries = []string{}
 	}
-	
+
 	// Parse param mapping
 	if t.ParamMapping != "" {
 		json.Unmarshal([]byte(t.ParamMapping), &resp.ParamMapping)
@@ -57,7 +88,7 @@ func (t *Target) ToResponse() TargetResponse {
 	if resp.ParamMapping == nil {
 		resp.ParamMapping = make(map[string]string)
 	}
-	
+
 	// Parse static params
 	if t.StaticParams != "" {
 		json.Unmarshal([]byte(t.StaticParams), &resp.StaticParams)
@@ -65,6 +96,52 @@ func (t *Target) ToResponse() TargetResponse {
 	if resp.StaticParams == nil {
 		resp.StaticParams = make(map[string]string)
 	}
-	
+
+	resp.ExcludedCountries = ParseStringList(t.ExcludedCountries)
+	resp.CountryWeights = t.GetCountryWeights()
+	if resp.CountryWeights == nil {
+		resp.CountryWeights = make(map[string]int)
+	}
+	resp.CapPacingCurve = ParsePacingCurve(t.CapPacingCurve)
+	resp.Schedule = t.GetSchedule()
+	resp.Transforms = t.GetTransforms()
+	resp.PassthroughMode = t.PassthroughMode
+	resp.PassthroughParams = ParseStringList(t.PassthroughParams)
+	resp.MergePolicy = t.MergePolicy
+	resp.DeviceTypes = ParseStringList(t.DeviceTypes)
+	resp.OperatingSystems = ParseStringList(t.OperatingSystems)
+	resp.Browsers = ParseStringList(t.Browsers)
+	resp.Languages = ParseStringList(t.Languages)
+	resp.Regions = ParseStringList(t.Regions)
+	resp.ExcludedRegions = ParseStringList(t.ExcludedRegions)
+	resp.Cities = ParseStringList(t.Cities)
+	resp.ExcludedCities = ParseStringList(t.ExcludedCities)
+
 	return resp
-}
\ No newline at end of file
+}
+
+// GetCountryWeights returns the per-country (or per-group) weight
+// overrides, or nil when the target only uses Weight.
+func (t *Target) GetCountryWeights() map[string]int {
+	if t.CountryWeights == "" {
+		return nil
+	}
+	var weights map[string]int
+	if err := json.Unmarshal([]byte(t.CountryWeights), &weights); err != nil {
+		return nil
+	}
+	return weights
+}
+
+// ParseStringList decodes a JSON array column, returning an empty slice
+// when the column is empty or malformed.
+func ParseStringList(raw string) []string {
+	var list []string
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &list)
+	}
+	if list == nil {
+		list = []string{}
+	}
+	return list
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VisitorTimezone makes a schedule follow the visitor's own timezone
+// as reported by GeoIP instead of a fixed zone.
+const VisitorTimezone = "visitor"
+
+// TargetSchedule restricts a target to recurring weekly windows (dayparting).
+// A target without a schedule is always open.
+type TargetSchedule struct {
+	// Timezone is an IANA zone such as "Africa/Lagos", or "visitor".
+	// Empty means UTC.
+	Timezone string           `json:"timezone"`
+	Windows  []ScheduleWindow `json:"windows"`
+}
+
+// ScheduleWindow is an hour range that applies on the listed days.
+// When EndHour is not after StartHour the window runs past midnight
+// and belongs to the day it started on.
+type ScheduleWindow struct {
+	Days      []string `json:"days"`       // mon..sun, empty means every day
+	StartHour int      `json:"start_hour"` // inclusive, 0-23
+	EndHour   int      `json:"end_hour"`   // exclusive, 1-24
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+var locationCache sync.Map
+
+// Validate checks the timezone, day names and hour ranges.
+func (s *TargetSchedule) Validate() error {
+	if s.Timezone != "" && s.Timezone != VisitorTimezone {
+		if _, err := loadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("invalid schedule timezone %q", s.Timezone)
+		}
+	}
+
+	for i, w := range s.Windows {
+		for _, day := range w.Days {
+			if _, ok := weekdayNames[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("schedule window %d: invalid day %q", i, day)
+			}
+		}
+		if w.StartHour < 0 || w.StartHour > 23 {
+			return fmt.Errorf("schedule window %d: start_hour must be between 0 and 23", i)
+		}
+		if w.EndHour < 1 || w.EndHour > 24 {
+			return fmt.Errorf("schedule window %d: end_hour must be between 1 and 24", i)
+		}
+		if w.StartHour == w.EndHour {
+			return fmt.Errorf("schedule window %d: start_hour and end_hour must differ", i)
+		}
+	}
+
+	return nil
+}
+
+// IsOpen reports whether at falls inside any window. visitorTZ is used
+// when the schedule follows the visitor; unknown zones fall back to UTC.
+func (s *TargetSchedule) IsOpen(at time.Time, visitorTZ string) bool {
+	if len(s.Windows) == 0 {
+		return true
+	}
+
+	tz := s.Timezone
+	if tz == VisitorTimezone {
+		tz = visitorTZ
+	}
+	loc, err := loadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	local := at.In(loc)
+	hour := local.Hour()
+	yesterday := local.AddDate(0, 0, -1).Weekday()
+
+	for _, w := range s.Windows {
+		if w.StartHour < w.EndHour {
+			if hour >= w.StartHour && hour < w.EndHour && w.appliesOn(local.Weekday()) {
+				return true
+			}
+			continue
+		}
+
+		// Overnight window, e.g. 22 -> 6
+		if hour >= w.StartHour && w.appliesOn(local.Weekday()) {
+			return true
+		}
+		if hour < w.EndHour && w.appliesOn(yesterday) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w ScheduleWindow) appliesOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, name := range w.Days {
+		if d, ok := weekdayNames[strings.ToLower(name)]; ok && d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSchedule parses the stored schedule, returning nil when none is set.
+func (t *Target) GetSchedule() *TargetSchedule {
+	if t.Schedule == "" || t.Schedule == "null" {
+		return nil
+	}
+	var schedule TargetSchedule
+	if err := json.Unmarshal([]byte(t.Schedule), &schedule); err != nil {
+		return nil
+	}
+	return &schedule
+}
+
+// IsScheduledAt reports whether the target's schedule allows traffic at the given time.
+func (t *Target) IsScheduledAt(at time.Time, visitorTZ string) bool {
+	schedule := t.GetSchedule()
+	if schedule == nil {
+		return true
+	}
+	return schedule.IsOpen(at, visitorTZ)
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locationCache.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locationCache.Store(name, loc)
+	return loc, nil
+}
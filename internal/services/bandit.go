@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+// DefaultEpsilon is the share of epsilon-greedy traffic spent exploring.
+const DefaultEpsilon = 0.1
+
+// thompsonRounds is how many draws are used to estimate Thompson sampling
+// traffic shares for reporting.
+const thompsonRounds = 1000
+
+// ArmStats is what a bandit has learned about one target.
+type ArmStats struct {
+	TargetID    uint  `json:"target_id"`
+	Clicks      int64 `json:"clicks"`
+	Conversions int64 `json:"conversions"`
+	// ConversionRate is the posterior mean, (conversions+1)/(clicks+2).
+	ConversionRate float64 `json:"conversion_rate"`
+	// LearnedWeight is the percentage of traffic the bandit currently sends
+	// to the target.
+	LearnedWeight float64 `json:"learned_weight"`
+}
+
+// BanditService records clicks and conversions per target and chooses
+// targets with Thompson sampling or epsilon-greedy over them.
+type BanditService struct {
+	redis   *redis.Client
+	Epsilon float64
+}
+
+func NewBanditService(redisClient *redis.Client) *BanditService {
+	return &BanditService{
+		redis:   redisClient,
+		Epsilon: DefaultEpsilon,
+	}
+}
+
+func banditKey(targetID uint) string {
+	return fmt.Sprintf("bandit:target:%d", targetID)
+}
+
+// RecordClick counts a visitor sent to the target by a bandit strategy.
+func (s *BanditService) RecordClick(ctx context.Context, targetID uint) error {
+	return s.redis.HIncrBy(ctx, banditKey(targetID), "clicks", 1).Err()
+}
+
+// RecordConversion counts conversions attributed to the target.
+func (s *BanditService) RecordConversion(ctx context.Context, targetID uint, count int64) error {
+	return s.redis.HIncrBy(ctx, banditKey(targetID), "conversions", count).Err()
+}
+
+// Reset forgets everything learned about the target.
+func (s *BanditService) Reset(ctx context.Context, targetID uint) error {
+	return s.redis.Del(ctx, banditKey(targetID)).Err()
+}
+
+// Arms returns the recorded counts for each target, in order.
+func (s *BanditService) Arms(ctx context.Context, targets []*models.Target) ([]ArmStats, error) {
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(targets))
+	for i, target := range targets {
+		cmds[i] = pipe.HGetAll(ctx, banditKey(target.ID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	arms := make([]ArmStats, len(targets))
+	for i, target := range targets {
+		values := cmds[i].Val()
+		clicks, _ := strconv.ParseInt(values["clicks"], 10, 64)
+		conversions, _ := strconv.ParseInt(values["conversions"], 10, 64)
+		if conversions > clicks {
+			// Late postbacks can arrive after counters were reset
+			clicks = conversions
+		}
+		arms[i] = ArmStats{
+			TargetID:       target.ID,
+			Clicks:         clicks,
+			Conversions:    conversions,
+			ConversionRate: float64(conversions+1) / float64(clicks+2),
+		}
+	}
+	return arms, nil
+}
+
+// Choose returns the index of the target to send the visitor to. Targets
+// whose weight is zero are never chosen while another target is eligible.
+func (s *BanditService) Choose(strategy string, arms []ArmStats, weights []int) int {
+	candidates := positiveWeights(weights)
+
+	switch strategy {
+	case StrategyThompson:
+		return thompsonChoice(arms, candidates)
+	default:
+		if rand.Float64() < s.Epsilon {
+			return weightedIndex(weights)
+		}
+		best := bestArms(arms, candidates)
+		return best[rand.Intn(len(best))]
+	}
+}
+
+// LearnedWeights reports the counts for each target along with the share
+// of traffic the strategy currently sends to it.
+func (s *BanditService) LearnedWeights(ctx context.Context, strategy string, targets []*models.Target, weights []int) ([]ArmStats, error) {
+	arms, err := s.Arms(ctx, targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(arms) == 0 {
+		return arms, nil
+	}
+
+	candidates := positiveWeights(weights)
+	shares := make([]float64, len(arms))
+
+	switch strategy {
+	case StrategyThompson:
+		for round := 0; round < thompsonRounds; round++ {
+			shares[thompsonChoice(arms, candidates)]++
+		}
+		for i := range shares {
+			shares[i] /= thompsonRounds
+		}
+	default:
+		total := 0
+		for _, i := range candidates {
+			total += weights[i]
+		}
+		for _, i := range candidates {
+			if total > 0 {
+				shares[i] += s.Epsilon * float64(weights[i]) / float64(total)
+			} else {
+				shares[i] += s.Epsilon / float64(len(candidates))
+			}
+		}
+		best := bestArms(arms, candidates)
+		for _, i := range best {
+			shares[i] += (1 - s.Epsilon) / float64(len(best))
+		}
+	}
+
+	for i := range arms {
+		arms[i].LearnedWeight = math.Round(shares[i]*10000) / 100
+	}
+	return arms, nil
+}
+
+// BanditSelector chooses targets with a BanditService. The click is counted
+// by Record, once the visitor is sent to the target.
+type BanditSelector struct {
+	bandit   *BanditService
+	strategy string
+}
+
+func NewBanditSelector(bandit *BanditService, strategy string) *BanditSelector {
+	return &BanditSelector{bandit: bandit, strategy: strategy}
+}
+
+func (s *BanditSelector) Select(ctx context.Context, req *SelectionRequest) (*models.Target, error) {
+	if len(req.Targets) == 0 {
+		return nil, errors.New("no eligible targets")
+	}
+
+	arms, err := s.bandit.Arms(ctx, req.Targets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bandit stats: %w", err)
+	}
+
+	return req.Targets[s.bandit.Choose(s.strategy, arms, req.Weights)], nil
+}
+
+// Record counts the click for the target.
+func (s *BanditSelector) Record(ctx context.Context, link *models.Link, visitor *Visitor, target *models.Target) error {
+	return s.bandit.RecordClick(ctx, target.ID)
+}
+
+// positiveWeights returns the indexes of targets with a positive weight, or
+// every index when none has one.
+func positiveWeights(weights []int) []int {
+	var candidates []int
+	for i, weight := range weights {
+		if weight > 0 {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		for i := range weights {
+			candidates = append(candidates, i)
+		}
+	}
+	return candidates
+}
+
+func weightedIndex(weights []int) int {
+	total := 0
+	for _, weight := range weights {
+		if weight > 0 {
+			total += weight
+		}
+	}
+	if total <= 0 {
+		return rand.Intn(len(weights))
+	}
+
+	r := rand.Intn(total)
+	for i, weight := range weights {
+		if weight <= 0 {
+			continue
+		}
+		r -= weight
+		if r < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+func bestArms(arms []ArmStats, candidates []int) []int {
+	var best []int
+	bestRate := -1.0
+	for _, i := range candidates {
+		switch rate := arms[i].ConversionRate; {
+		case rate > bestRate:
+			best, bestRate = []int{i}, rate
+		case rate == bestRate:
+			best = append(best, i)
+		}
+	}
+	return best
+}
+
+func thompsonChoice(arms []ArmStats, candidates []int) int {
+	best, bestSample := candidates[0], -1.0
+	for _, i := range candidates {
+		sample := sampleBeta(float64(arms[i].Conversions+1), float64(arms[i].Clicks-arms[i].Conversions+1))
+		if sample > bestSample {
+			best, bestSample = i, sample
+		}
+	}
+	return best
+}
+
+// sampleBeta draws from Beta(a, b) using two gamma draws.
+func sampleBeta(a, b float64) float64 {
+	x := sampleGamma(a)
+	y := sampleGamma(b)
+	return x / (x + y)
+}
+
+// sampleGamma draws from Gamma(shape, 1) with the Marsaglia-Tsang method.
+func sampleGamma(shape float64) float64 {
+	if shape < 1 {
+		return sampleGamma(shape+1) * math.Pow(rand.Float64(), 1/shape)
+	}
+
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rand.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rand.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
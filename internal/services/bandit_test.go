@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+func TestBanditService_Arms(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	bandit := NewBanditService(client)
+	ctx := context.Background()
+	targets := []*models.Target{{ID: 1}, {ID: 2}}
+
+	for i := 0; i < 8; i++ {
+		require.NoError(t, bandit.RecordClick(ctx, 1))
+	}
+	require.NoError(t, bandit.RecordConversion(ctx, 1, 3))
+
+	arms, err := bandit.Arms(ctx, targets)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), arms[0].Clicks)
+	assert.Equal(t, int64(3), arms[0].Conversions)
+	assert.InDelta(t, 0.4, arms[0].ConversionRate, 0.001)
+	assert.Equal(t, int64(0), arms[1].Clicks)
+	assert.InDelta(t, 0.5, arms[1].ConversionRate, 0.001)
+}
+
+func TestBanditSelector_Thompson(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	bandit := NewBanditService(client)
+	ctx := context.Background()
+	targets := []*models.Target{{ID: 1, Weight: 50}, {ID: 2, Weight: 50}, {ID: 3, Weight: 0}}
+
+	// Target 2 converts far better than target 1
+	client.HSet(ctx, banditKey(1), "clicks", 1000, "conversions", 10)
+	client.HSet(ctx, banditKey(2), "clicks", 1000, "conversions", 200)
+	client.HSet(ctx, banditKey(3), "clicks", 1000, "conversions", 900)
+
+	selector := NewBanditSelector(bandit, StrategyThompson)
+	counts := map[uint]int{}
+	for i := 0; i < 100; i++ {
+		target, err := selector.Select(ctx, selectionRequest("1.1.1.1", targets))
+		require.NoError(t, err)
+		counts[target.ID]++
+	}
+	assert.Greater(t, counts[2], 95)
+	assert.Zero(t, counts[3], "zero weight targets are never chosen")
+
+	// Clicks are only counted for the targets visitors are sent to
+	arms, err := bandit.Arms(ctx, targets[1:2])
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), arms[0].Clicks)
+
+	req := selectionRequest("1.1.1.1", targets)
+	require.NoError(t, selector.Record(ctx, req.Link, req.Visitor, targets[1]))
+	arms, err = bandit.Arms(ctx, targets[1:2])
+	require.NoError(t, err)
+	assert.Equal(t, int64(1001), arms[0].Clicks)
+}
+
+func TestBanditService_LearnedWeights(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	bandit := NewBanditService(client)
+	ctx := context.Background()
+	targets := []*models.Target{{ID: 1}, {ID: 2}}
+	weights := []int{50, 50}
+
+	client.HSet(ctx, banditKey(1), "clicks", 100, "conversions", 1)
+	client.HSet(ctx, banditKey(2), "clicks", 100, "conversions", 30)
+
+	arms, err := bandit.LearnedWeights(ctx, StrategyEpsilonGreedy, targets, weights)
+	require.NoError(t, err)
+	assert.InDelta(t, 5, arms[0].LearnedWeight, 0.01)
+	assert.InDelta(t, 95, arms[1].LearnedWeight, 0.01)
+
+	arms, err = bandit.LearnedWeights(ctx, StrategyThompson, targets, weights)
+	require.NoError(t, err)
+	assert.Greater(t, arms[1].LearnedWeight, 99.0)
+}
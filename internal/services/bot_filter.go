@@ -0,0 +1,112 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/raoxb/smart_redirect/internal/config"
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/pkg/iprange"
+	"github.com/raoxb/smart_redirect/pkg/useragent"
+)
+
+// BotVerdict is the classification of a visitor. Reason is one of the
+// models.BotReason* signals and empty for humans.
+type BotVerdict struct {
+	Bot    bool
+	Reason string
+}
+
+// BotFilter classifies redirect visitors as humans or bots from their
+// User-Agent, their headers and their IP.
+type BotFilter struct {
+	config      config.BotFilterConfig
+	datacenters *iprange.Table[struct{}]
+}
+
+// NewBotFilter creates a filter, loading the datacenter ranges file when
+// one is configured.
+func NewBotFilter(cfg config.BotFilterConfig) (*BotFilter, error) {
+	if cfg.DefaultAction == "" {
+		cfg.DefaultAction = models.BotAllow
+	}
+	if !models.IsValidBotAction(cfg.DefaultAction) {
+		return nil, fmt.Errorf("unknown bot action %q", cfg.DefaultAction)
+	}
+
+	filter := &BotFilter{
+		config:      cfg,
+		datacenters: &iprange.Table[struct{}]{},
+	}
+	if cfg.DatacenterRangesFile != "" {
+		prefixes, err := iprange.LoadFile(cfg.DatacenterRangesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load datacenter ranges: %w", err)
+		}
+		for _, prefix := range prefixes {
+			filter.datacenters.Insert(prefix, struct{}{})
+		}
+	}
+	return filter, nil
+}
+
+// ActionFor returns the bot action of the link.
+func (f *BotFilter) ActionFor(link *models.Link) string {
+	return link.BotActionOr(f.config.DefaultAction)
+}
+
+// Classify returns the verdict for a visitor. Signals are checked from the
+// most to the least specific, and the first one found is the reason.
+func (f *BotFilter) Classify(ip string, header http.Header) BotVerdict {
+	if !f.config.Enabled {
+		return BotVerdict{}
+	}
+
+	ua := header.Get("User-Agent")
+	switch {
+	case useragent.IsBot(ua):
+		return BotVerdict{Bot: true, Reason: models.BotReasonKnownBot}
+	case useragent.IsHeadless(ua):
+		return BotVerdict{Bot: true, Reason: models.BotReasonHeadless}
+	case f.config.CheckHeaders && !hasBrowserHeaders(header):
+		return BotVerdict{Bot: true, Reason: models.BotReasonHeaders}
+	case f.isDatacenter(ip):
+		return BotVerdict{Bot: true, Reason: models.BotReasonDatacenter}
+	}
+	return BotVerdict{}
+}
+
+// hasBrowserHeaders reports whether the request carries the headers every
+// browser sends on a navigation, with a browser-like User-Agent.
+func hasBrowserHeaders(header http.Header) bool {
+	ua := header.Get("User-Agent")
+	if !strings.HasPrefix(ua, "Mozilla/") {
+		return false
+	}
+	return header.Get("Accept") != "" && header.Get("Accept-Language") != ""
+}
+
+func (f *BotFilter) isDatacenter(ip string) bool {
+	if f.datacenters.Len() == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	return f.datacenters.Contains(addr)
+}
+
+// Verdict returns the AccessLog verdict of a visitor redirected after
+// classification; flagged is whether the hit was kept off the caps.
+func (v BotVerdict) Verdict(flagged bool) string {
+	switch {
+	case !v.Bot:
+		return models.BotVerdictHuman
+	case flagged:
+		return models.BotVerdictFlagged
+	}
+	return models.BotVerdictBot
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raoxb/smart_redirect/internal/config"
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+func browserHeader(ua string) http.Header {
+	header := http.Header{}
+	header.Set("User-Agent", ua)
+	header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	header.Set("Accept-Language", "en-US,en;q=0.9")
+	return header
+}
+
+func TestBotFilter_Classify(t *testing.T) {
+	ranges := filepath.Join(t.TempDir(), "datacenters.txt")
+	require.NoError(t, os.WriteFile(ranges, []byte("# cloud\n203.0.113.0/24\n2001:db8::/32\n"), 0o644))
+
+	cfg := config.DefaultBotFilter()
+	cfg.DatacenterRangesFile = ranges
+	filter, err := NewBotFilter(cfg)
+	require.NoError(t, err)
+
+	chrome := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	noLanguage := browserHeader(chrome)
+	noLanguage.Del("Accept-Language")
+
+	tests := []struct {
+		name   string
+		ip     string
+		header http.Header
+		want   BotVerdict
+	}{
+		{"browser", "198.51.100.1", browserHeader(chrome), BotVerdict{}},
+		{"crawler", "198.51.100.1", browserHeader("Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"), BotVerdict{Bot: true, Reason: models.BotReasonKnownBot}},
+		{"curl", "198.51.100.1", http.Header{"User-Agent": {"curl/8.4.0"}}, BotVerdict{Bot: true, Reason: models.BotReasonKnownBot}},
+		{"headless", "198.51.100.1", browserHeader("Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36"), BotVerdict{Bot: true, Reason: models.BotReasonHeadless}},
+		{"missing language", "198.51.100.1", noLanguage, BotVerdict{Bot: true, Reason: models.BotReasonHeaders}},
+		{"no user agent", "198.51.100.1", http.Header{}, BotVerdict{Bot: true, Reason: models.BotReasonHeaders}},
+		{"datacenter v4", "203.0.113.9", browserHeader(chrome), BotVerdict{Bot: true, Reason: models.BotReasonDatacenter}},
+		{"datacenter v6", "2001:db8::1", browserHeader(chrome), BotVerdict{Bot: true, Reason: models.BotReasonDatacenter}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, filter.Classify(tt.ip, tt.header))
+		})
+	}
+}
+
+func TestBotFilter_Config(t *testing.T) {
+	cfg := config.DefaultBotFilter()
+	cfg.Enabled = false
+	filter, err := NewBotFilter(cfg)
+	require.NoError(t, err)
+	assert.False(t, filter.Classify("203.0.113.9", http.Header{}).Bot)
+
+	cfg = config.DefaultBotFilter()
+	cfg.CheckHeaders = false
+	filter, err = NewBotFilter(cfg)
+	require.NoError(t, err)
+	assert.False(t, filter.Classify("203.0.113.9", http.Header{}).Bot)
+
+	cfg.DefaultAction = models.BotFlag
+	filter, err = NewBotFilter(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, models.BotFlag, filter.ActionFor(&models.Link{}))
+	assert.Equal(t, models.BotBlock, filter.ActionFor(&models.Link{BotAction: models.BotBlock}))
+
+	cfg.DefaultAction = "drop"
+	_, err = NewBotFilter(cfg)
+	assert.Error(t, err)
+
+	cfg = config.DefaultBotFilter()
+	cfg.DatacenterRangesFile = filepath.Join(t.TempDir(), "missing.txt")
+	_, err = NewBotFilter(cfg)
+	assert.Error(t, err)
+}
+
+func TestBotVerdict_Verdict(t *testing.T) {
+	bot := BotVerdict{Bot: true, Reason: models.BotReasonKnownBot}
+	assert.Equal(t, models.BotVerdictHuman, BotVerdict{}.Verdict(false))
+	assert.Equal(t, models.BotVerdictBot, bot.Verdict(false))
+	assert.Equal(t, models.BotVerdictFlagged, bot.Verdict(true))
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+// capArchivePeriods is how many finished periods of each periodic cap are
+// copied on every run. Counters of a period can still change briefly after
+// it ends, when a reservation is released, so recent periods are copied
+// again; a day of hourly periods also covers an archiver that was down.
+const capArchivePeriods = 24
+
+// CapArchiver copies the counters of finished cap periods from Redis to
+// the database, where CapService reads them once the counters expire or
+// are lost.
+type CapArchiver struct {
+	db       *gorm.DB
+	caps     *CapService
+	interval time.Duration
+}
+
+func NewCapArchiver(db *gorm.DB, redis *redis.Client) *CapArchiver {
+	return &CapArchiver{
+		db:       db,
+		caps:     NewCapService(db, redis),
+		interval: 5 * time.Minute,
+	}
+}
+
+// Start archives the finished periods on every tick until ctx is cancelled.
+func (a *CapArchiver) Start(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.Run(ctx); err != nil {
+				log.Printf("cap archive: %v", err)
+			}
+		}
+	}
+}
+
+// Run archives the latest finished periods of every periodic link and
+// target cap still counted in Redis.
+func (a *CapArchiver) Run(ctx context.Context) error {
+	periodic := []string{models.CapHourly, models.CapDaily, models.CapWeekly}
+	var links []models.Link
+	err := a.db.Preload("Targets").
+		Where("cap_period IN ? OR id IN (?)", periodic,
+			a.db.Model(&models.Target{}).Select("link_id").Where("cap_period IN ?", periodic)).
+		Find(&links).Error
+	if err != nil {
+		return fmt.Errorf("failed to find periodic caps: %w", err)
+	}
+
+	var usages []models.CapPeriodUsage
+	for i := range links {
+		link := &links[i]
+		if models.IsPeriodicCap(link.CapPeriod) {
+			owner := capOwner{scope: models.CapScopeLink, id: link.ID, base: linkCapBase(link)}
+			found, err := a.finishedUsage(ctx, owner, link.CapPeriod, link.CapTimezone)
+			if err != nil {
+				return err
+			}
+			usages = append(usages, found...)
+		}
+		for j := range link.Targets {
+			target := &link.Targets[j]
+			if !models.IsPeriodicCap(target.CapPeriod) {
+				continue
+			}
+			owner := capOwner{scope: models.CapScopeTarget, id: target.ID, base: targetCapBase(target)}
+			found, err := a.finishedUsage(ctx, owner, target.CapPeriod, target.CapTimezoneFor(link))
+			if err != nil {
+				return err
+			}
+			usages = append(usages, found...)
+		}
+	}
+
+	if len(usages) == 0 {
+		return nil
+	}
+	err = a.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "owner_id"}, {Name: "cap_period"}, {Name: "period"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hits", "updated_at"}),
+	}).CreateInBatches(usages, 500).Error
+	if err != nil {
+		return fmt.Errorf("failed to archive cap usage: %w", err)
+	}
+	return nil
+}
+
+// finishedUsage returns the hits of the owner's latest finished periods
+// that are still in Redis.
+func (a *CapArchiver) finishedUsage(ctx context.Context, owner capOwner, period string, tz string) ([]models.CapPeriodUsage, error) {
+	labels := make([]string, capArchivePeriods)
+	keys := make([]string, capArchivePeriods)
+	start := models.CapPeriodStart(period, tz, a.caps.now())
+	for i := range keys {
+		start = models.PreviousCapPeriod(period, start)
+		labels[i] = models.CapPeriodLabel(period, start)
+		keys[i] = newCapCounter(owner.base, period, start, 0).key
+	}
+
+	values, err := a.caps.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cap counters of %s %d: %w", owner.scope, owner.id, err)
+	}
+
+	var usages []models.CapPeriodUsage
+	for i, value := range values {
+		if hits, ok := parseCount(value); ok {
+			usages = append(usages, models.CapPeriodUsage{
+				Scope:     owner.scope,
+				OwnerID:   owner.id,
+				CapPeriod: period,
+				Period:    labels[i],
+				Hits:      hits,
+			})
+		}
+	}
+	return usages, nil
+}
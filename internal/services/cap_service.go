@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+var (
+	// ErrLinkCapReached is returned when a link has no hits left.
+	ErrLinkCapReached = errors.New("link cap reached")
+	// ErrTargetCapReached is returned when a target has no hits left.
+	ErrTargetCapReached = errors.New("target cap reached")
+	// ErrLinkPaced is returned when a link has used the part of its cap
+	// opened so far by its pacing.
+	ErrLinkPaced = errors.New("link cap over pace")
+	// ErrTargetPaced is ErrLinkPaced for a target.
+	ErrTargetPaced = errors.New("target cap over pace")
+)
+
+// reserveCapScript checks the link and target counters and increments both
+// only if neither cap is reached. A negative cap in ARGV[1] or ARGV[2] is
+// no cap, and 0 a cap with no hits open yet. Missing counters start from
+// ARGV[3] and ARGV[4], and expire after ARGV[5] and ARGV[6] milliseconds
+// unless 0. It returns 0 on success, 1 when the link cap is reached and 2
+// when the target cap is reached.
+var reserveCapScript = redis.NewScript(`
+for i = 1, 2 do
+	local ttl = tonumber(ARGV[4 + i])
+	if ttl > 0 then
+		redis.call('SET', KEYS[i], ARGV[2 + i], 'NX', 'PX', ttl)
+	else
+		redis.call('SET', KEYS[i], ARGV[2 + i], 'NX')
+	end
+end
+local linkCap = tonumber(ARGV[1])
+local targetCap = tonumber(ARGV[2])
+if linkCap >= 0 and tonumber(redis.call('GET', KEYS[1])) >= linkCap then
+	return 1
+end
+if targetCap >= 0 and tonumber(redis.call('GET', KEYS[2])) >= targetCap then
+	return 2
+end
+redis.call('INCR', KEYS[1])
+redis.call('INCR', KEYS[2])
+return 0
+`)
+
+// releaseCapScript gives back a reserved hit without going below zero.
+var releaseCapScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if tonumber(redis.call('GET', key) or '0') > 0 then
+		redis.call('DECR', key)
+	end
+end
+return 0
+`)
+
+// CapService keeps live hit counters for link and target caps in Redis.
+// A redirect reserves a hit on both counters before it is sent and releases
+// it if the redirect fails, so concurrent requests cannot overshoot a cap.
+// Periodic caps use one counter per period, so they start over on their
+// own. Earlier periods stay in Redis until they expire and are archived to
+// the database by CapArchiver.
+type CapService struct {
+	db    *gorm.DB
+	redis *redis.Client
+	now   func() time.Time
+}
+
+// NewCapService creates the service. db may be nil, in which case earlier
+// periods are only read from Redis.
+func NewCapService(db *gorm.DB, redis *redis.Client) *CapService {
+	return &CapService{db: db, redis: redis, now: time.Now}
+}
+
+// CapReservation is a hit counted against a link and one of its targets.
+type CapReservation struct {
+	caps      *CapService
+	linkKey   string
+	targetKey string
+}
+
+// capCounter is the counter of one period of a cap.
+type capCounter struct {
+	key  string
+	seed int // initial value, the recorded hits for lifetime caps
+	ttl  time.Duration
+}
+
+func newCapCounter(base string, period string, start time.Time, recordedHits int) capCounter {
+	if !models.IsPeriodicCap(period) {
+		return capCounter{key: base, seed: recordedHits}
+	}
+	return capCounter{
+		key: base + ":" + models.CapPeriodLabel(period, start),
+		ttl: models.CapRetention(period),
+	}
+}
+
+func linkCapBase(link *models.Link) string {
+	return fmt.Sprintf("global_cap:link:%d", link.ID)
+}
+
+func targetCapBase(target *models.Target) string {
+	return fmt.Sprintf("global_cap:target:%d", target.ID)
+}
+
+func (c *CapService) linkCounter(link *models.Link, at time.Time) capCounter {
+	start := models.CapPeriodStart(link.CapPeriod, link.CapTimezone, at)
+	return newCapCounter(linkCapBase(link), link.CapPeriod, start, link.CurrentHits)
+}
+
+func (c *CapService) targetCounter(link *models.Link, target *models.Target, at time.Time) capCounter {
+	tz := target.CapTimezoneFor(link)
+	start := models.CapPeriodStart(target.CapPeriod, tz, at)
+	return newCapCounter(targetCapBase(target), target.CapPeriod, start, target.CurrentHits)
+}
+
+// Reserve counts a hit against the current period of the link's TotalCap
+// and the target's Cap. It returns ErrLinkCapReached or
+// ErrTargetCapReached, without counting anything, when either has no hits
+// left, and ErrLinkPaced or ErrTargetPaced when either is paced and has
+// used the part of its cap opened so far.
+func (c *CapService) Reserve(ctx context.Context, link *models.Link, target *models.Target) (*CapReservation, error) {
+	now := c.now()
+	linkCounter := c.linkCounter(link, now)
+	targetCounter := c.targetCounter(link, target, now)
+	linkCap := scriptCap(link.TotalCap, link.PacedTotalCap(now))
+	targetCap := scriptCap(target.Cap, target.PacedCap(link, now))
+	reservation := &CapReservation{
+		caps:      c,
+		linkKey:   linkCounter.key,
+		targetKey: targetCounter.key,
+	}
+
+	result, err := reserveCapScript.Run(ctx, c.redis,
+		[]string{linkCounter.key, targetCounter.key},
+		linkCap, targetCap, linkCounter.seed, targetCounter.seed,
+		linkCounter.ttl.Milliseconds(), targetCounter.ttl.Milliseconds(),
+	).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve cap: %w", err)
+	}
+
+	switch {
+	case result == 1 && linkCap < link.TotalCap:
+		return nil, ErrLinkPaced
+	case result == 1:
+		return nil, ErrLinkCapReached
+	case result == 2 && targetCap < target.Cap:
+		return nil, ErrTargetPaced
+	case result == 2:
+		return nil, ErrTargetCapReached
+	}
+	return reservation, nil
+}
+
+// scriptCap is the cap passed to reserveCapScript: the paced allowance of
+// a cap, which can be 0 early in a period, or -1 when there is no cap.
+func scriptCap(cap int, paced int) int {
+	if cap <= 0 {
+		return -1
+	}
+	return paced
+}
+
+// Release gives the reserved hit back to the link and the target.
+func (r *CapReservation) Release(ctx context.Context) error {
+	return releaseCapScript.Run(ctx, r.caps.redis, []string{r.linkKey, r.targetKey}).Err()
+}
+
+// LinkHits returns the live hit count of the link's current cap period.
+// Lifetime caps without a counter yet use the link's recorded hits.
+func (c *CapService) LinkHits(ctx context.Context, link *models.Link) (int, error) {
+	counter := c.linkCounter(link, c.now())
+	hits, err := c.redis.Get(ctx, counter.key).Int()
+	if err == redis.Nil {
+		return counter.seed, nil
+	}
+	if err != nil {
+		return counter.seed, fmt.Errorf("failed to get link hits: %w", err)
+	}
+	return hits, nil
+}
+
+// TargetHits returns the live hit count of the current cap period of each
+// of the link's targets, by ID. Lifetime caps without a counter yet use the
+// target's recorded hits.
+func (c *CapService) TargetHits(ctx context.Context, link *models.Link) (map[uint]int, error) {
+	hits := make(map[uint]int, len(link.Targets))
+	if len(link.Targets) == 0 {
+		return hits, nil
+	}
+
+	now := c.now()
+	keys := make([]string, len(link.Targets))
+	for i := range link.Targets {
+		counter := c.targetCounter(link, &link.Targets[i], now)
+		keys[i] = counter.key
+		hits[link.Targets[i].ID] = counter.seed
+	}
+
+	values, err := c.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return hits, fmt.Errorf("failed to get target hits: %w", err)
+	}
+	for i, value := range values {
+		if n, ok := parseCount(value); ok {
+			hits[link.Targets[i].ID] = n
+		}
+	}
+	return hits, nil
+}
+
+// FillPeriodHits sets the PeriodHits of the link and its targets to the
+// live hit counts of their current cap periods.
+func (c *CapService) FillPeriodHits(ctx context.Context, link *models.Link) error {
+	hits, err := c.LinkHits(ctx, link)
+	if err != nil {
+		return err
+	}
+	link.PeriodHits = hits
+
+	targetHits, err := c.TargetHits(ctx, link)
+	if err != nil {
+		return err
+	}
+	for i := range link.Targets {
+		link.Targets[i].PeriodHits = targetHits[link.Targets[i].ID]
+	}
+	return nil
+}
+
+// Now returns the time caps are counted at.
+func (c *CapService) Now() time.Time {
+	return c.now()
+}
+
+// CapUsage is the number of hits counted in one cap period.
+type CapUsage struct {
+	// Period is the start of the period, see models.CapPeriodLabel. It is
+	// empty for lifetime caps.
+	Period string `json:"period"`
+	Hits   int    `json:"hits"`
+}
+
+// CapHistory is the consumption of a cap over its latest periods.
+type CapHistory struct {
+	Cap       int        `json:"cap"`
+	CapPeriod string     `json:"cap_period"`
+	Timezone  string     `json:"timezone"`
+	Periods   []CapUsage `json:"periods"`
+}
+
+// LinkHistory returns the consumption of the link's cap over its current
+// and previous periods, newest first. Lifetime caps have a single period.
+// Previous periods no longer in Redis are read from the archive.
+func (c *CapService) LinkHistory(ctx context.Context, link *models.Link, periods int) (*CapHistory, error) {
+	owner := capOwner{scope: models.CapScopeLink, id: link.ID, base: linkCapBase(link)}
+	return c.history(ctx, owner, link.TotalCap, link.CapPeriod, link.CapTimezone, link.CurrentHits, periods)
+}
+
+// TargetHistory is LinkHistory for one of the link's targets.
+func (c *CapService) TargetHistory(ctx context.Context, link *models.Link, target *models.Target, periods int) (*CapHistory, error) {
+	owner := capOwner{scope: models.CapScopeTarget, id: target.ID, base: targetCapBase(target)}
+	return c.history(ctx, owner, target.Cap, target.CapPeriod, target.CapTimezoneFor(link), target.CurrentHits, periods)
+}
+
+// capOwner is the link or target a cap belongs to.
+type capOwner struct {
+	scope string // models.CapScopeLink or models.CapScopeTarget
+	id    uint
+	base  string // key of its counters
+}
+
+func (c *CapService) history(ctx context.Context, owner capOwner, cap int, period string, tz string, recordedHits int, periods int) (*CapHistory, error) {
+	history := &CapHistory{Cap: cap, CapPeriod: period, Timezone: tz}
+	if !models.IsPeriodicCap(period) || periods < 1 {
+		periods = 1
+	}
+
+	counters := make([]capCounter, periods)
+	labels := make([]string, periods)
+	keys := make([]string, periods)
+	start := models.CapPeriodStart(period, tz, c.now())
+	for i := range counters {
+		labels[i] = models.CapPeriodLabel(period, start)
+		counters[i] = newCapCounter(owner.base, period, start, recordedHits)
+		keys[i] = counters[i].key
+		start = models.PreviousCapPeriod(period, start)
+	}
+
+	values, err := c.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cap history: %w", err)
+	}
+
+	var missing []string
+	for i, value := range values {
+		usage := CapUsage{Period: labels[i], Hits: counters[i].seed}
+		if n, ok := parseCount(value); ok {
+			usage.Hits = n
+		} else if i > 0 {
+			missing = append(missing, labels[i])
+		}
+		history.Periods = append(history.Periods, usage)
+	}
+
+	if len(missing) > 0 && c.db != nil {
+		archived, err := c.archivedHits(owner, period, missing)
+		if err != nil {
+			return nil, err
+		}
+		for i := range history.Periods {
+			if hits, ok := archived[history.Periods[i].Period]; ok {
+				history.Periods[i].Hits = hits
+			}
+		}
+	}
+	return history, nil
+}
+
+// archivedHits returns the archived hits of the owner's periods, by label.
+func (c *CapService) archivedHits(owner capOwner, period string, labels []string) (map[string]int, error) {
+	var usages []models.CapPeriodUsage
+	err := c.db.Where("scope = ? AND owner_id = ? AND cap_period = ? AND period IN ?", owner.scope, owner.id, period, labels).
+		Find(&usages).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get archived cap usage: %w", err)
+	}
+
+	hits := make(map[string]int, len(usages))
+	for _, usage := range usages {
+		hits[usage.Period] = usage.Hits
+	}
+	return hits, nil
+}
+
+func parseCount(value interface{}) (int, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/pkg/geoip"
+)
+
+func TestCapService_Reserve(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	caps := NewCapService(nil, client)
+	ctx := context.Background()
+
+	t.Run("Target cap", func(t *testing.T) {
+		link := &models.Link{ID: 1}
+		target := &models.Target{ID: 1, Cap: 3, CurrentHits: 1}
+
+		for i := 0; i < 2; i++ {
+			_, err := caps.Reserve(ctx, link, target)
+			require.NoError(t, err)
+		}
+		_, err := caps.Reserve(ctx, link, target)
+		assert.ErrorIs(t, err, ErrTargetCapReached)
+
+		// A failed reservation counts nothing
+		hits, err := caps.LinkHits(ctx, link)
+		require.NoError(t, err)
+		assert.Equal(t, 2, hits)
+	})
+
+	t.Run("Link cap", func(t *testing.T) {
+		link := &models.Link{ID: 2, TotalCap: 2}
+		first := &models.Target{ID: 2}
+		second := &models.Target{ID: 3}
+
+		_, err := caps.Reserve(ctx, link, first)
+		require.NoError(t, err)
+		reservation, err := caps.Reserve(ctx, link, second)
+		require.NoError(t, err)
+		_, err = caps.Reserve(ctx, link, first)
+		assert.ErrorIs(t, err, ErrLinkCapReached)
+
+		require.NoError(t, reservation.Release(ctx))
+		_, err = caps.Reserve(ctx, link, first)
+		assert.NoError(t, err)
+
+		link.Targets = []models.Target{*first, *second, {ID: 99, CurrentHits: 5}}
+		hits, err := caps.TargetHits(ctx, link)
+		require.NoError(t, err)
+		assert.Equal(t, map[uint]int{2: 2, 3: 0, 99: 5}, hits)
+	})
+
+	t.Run("Concurrent reservations do not overshoot", func(t *testing.T) {
+		link := &models.Link{ID: 3, TotalCap: 100}
+		target := &models.Target{ID: 4, Cap: 10}
+
+		var reserved int64
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := caps.Reserve(ctx, link, target); err == nil {
+					atomic.AddInt64(&reserved, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int64(10), reserved)
+	})
+}
+
+func TestCapService_Periods(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	caps := NewCapService(nil, client)
+	ctx := context.Background()
+	lagos, _ := time.LoadLocation("Africa/Lagos")
+	now := time.Date(2024, 3, 6, 23, 30, 0, 0, lagos) // Wednesday
+	caps.now = func() time.Time { return now }
+
+	link := &models.Link{ID: 1, TotalCap: 2, CapPeriod: models.CapDaily, CapTimezone: "Africa/Lagos", CurrentHits: 500}
+	target := &models.Target{ID: 1, Cap: 3, CapPeriod: models.CapWeekly, CurrentHits: 500}
+
+	for i := 0; i < 2; i++ {
+		_, err := caps.Reserve(ctx, link, target)
+		require.NoError(t, err)
+	}
+	_, err := caps.Reserve(ctx, link, target)
+	assert.ErrorIs(t, err, ErrLinkCapReached)
+
+	// The link's day starts over at midnight in Lagos, the target's week
+	// (in the link's zone) does not
+	now = now.Add(time.Hour)
+	_, err = caps.Reserve(ctx, link, target)
+	require.NoError(t, err)
+	_, err = caps.Reserve(ctx, link, target)
+	assert.ErrorIs(t, err, ErrTargetCapReached)
+
+	history, err := caps.LinkHistory(ctx, link, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []CapUsage{
+		{Period: "2024-03-07", Hits: 1},
+		{Period: "2024-03-06", Hits: 2},
+		{Period: "2024-03-05", Hits: 0},
+	}, history.Periods)
+
+	history, err = caps.TargetHistory(ctx, link, target, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Africa/Lagos", history.Timezone)
+	assert.Equal(t, []CapUsage{
+		{Period: "2024-03-04", Hits: 3},
+		{Period: "2024-02-26", Hits: 0},
+	}, history.Periods)
+
+	ttl := client.PTTL(ctx, "global_cap:link:1:2024-03-06").Val()
+	assert.True(t, ttl > 0 && ttl <= models.CapRetention(models.CapDaily))
+}
+
+func TestCapService_HourlyPeriodsWhenClocksGoBack(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	caps := NewCapService(nil, client)
+	ctx := context.Background()
+	// New York goes from 01:59 EDT back to 01:00 EST at 06:00 UTC
+	now := time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC)
+	caps.now = func() time.Time { return now }
+
+	link := &models.Link{ID: 1, TotalCap: 1, CapPeriod: models.CapHourly, CapTimezone: "America/New_York"}
+	target := &models.Target{ID: 1}
+
+	_, err := caps.Reserve(ctx, link, target)
+	require.NoError(t, err)
+	_, err = caps.Reserve(ctx, link, target)
+	assert.ErrorIs(t, err, ErrLinkCapReached)
+
+	// The repeated 01:00 is a new period
+	now = now.Add(time.Hour)
+	_, err = caps.Reserve(ctx, link, target)
+	require.NoError(t, err)
+
+	history, err := caps.LinkHistory(ctx, link, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []CapUsage{
+		{Period: "2024-11-03T01-05:00", Hits: 1},
+		{Period: "2024-11-03T01-04:00", Hits: 1},
+		{Period: "2024-11-03T00-04:00", Hits: 0},
+	}, history.Periods)
+}
+
+func TestCapService_Pacing(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	caps := NewCapService(nil, client)
+	ctx := context.Background()
+	now := time.Date(2024, 3, 6, 6, 0, 0, 0, time.UTC)
+	caps.now = func() time.Time { return now }
+
+	link := &models.Link{ID: 1, TotalCap: 40, CapPeriod: models.CapDaily, CapPacing: models.PacingEven}
+	target := &models.Target{ID: 1}
+
+	// A quarter of the day has passed
+	for i := 0; i < 10; i++ {
+		_, err := caps.Reserve(ctx, link, target)
+		require.NoError(t, err)
+	}
+	_, err := caps.Reserve(ctx, link, target)
+	assert.ErrorIs(t, err, ErrLinkPaced)
+
+	now = now.Add(3 * time.Hour)
+	_, err = caps.Reserve(ctx, link, target)
+	assert.NoError(t, err)
+
+	unpaced := &models.Link{ID: 2}
+	paced := &models.Target{ID: 2, Cap: 24, CapPeriod: models.CapDaily, CapPacing: models.PacingEven}
+	for i := 0; i < 9; i++ {
+		_, err := caps.Reserve(ctx, unpaced, paced)
+		require.NoError(t, err)
+	}
+	_, err = caps.Reserve(ctx, unpaced, paced)
+	assert.ErrorIs(t, err, ErrTargetPaced)
+}
+
+func TestCapService_PacingWithNoShareOpen(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	caps := NewCapService(nil, client)
+	ctx := context.Background()
+	now := time.Date(2024, 3, 6, 0, 30, 0, 0, time.UTC)
+	caps.now = func() time.Time { return now }
+
+	// The curve gives the first hours of the day no share
+	curve := `[0,0,0,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1]`
+	link := &models.Link{ID: 1, TotalCap: 100, CapPeriod: models.CapDaily, CapPacing: models.PacingCurve, CapPacingCurve: curve}
+	target := &models.Target{ID: 1}
+	require.Equal(t, 0, link.PacedTotalCap(now))
+
+	_, err := caps.Reserve(ctx, link, target)
+	assert.ErrorIs(t, err, ErrLinkPaced)
+
+	unpaced := &models.Link{ID: 2}
+	paced := &models.Target{ID: 2, Cap: 100, CapPeriod: models.CapDaily, CapPacing: models.PacingCurve, CapPacingCurve: curve}
+	_, err = caps.Reserve(ctx, unpaced, paced)
+	assert.ErrorIs(t, err, ErrTargetPaced)
+
+	now = time.Date(2024, 3, 6, 3, 30, 0, 0, time.UTC)
+	_, err = caps.Reserve(ctx, link, target)
+	assert.NoError(t, err)
+	_, err = caps.Reserve(ctx, unpaced, paced)
+	assert.NoError(t, err)
+}
+
+func TestLinkService_ReserveTarget(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	service := NewLinkService(nil, client)
+	link := &models.Link{
+		ID:                1,
+		TotalCap:          3,
+		SelectionStrategy: StrategyWeighted,
+		Targets: []models.Target{
+			{ID: 1, Weight: 1, Cap: 1, IsActive: true},
+			{ID: 2, Weight: 1, Cap: 1, IsActive: true},
+		},
+	}
+	visitor := &Visitor{IP: "1.2.3.4", Location: &geoip.Location{CountryCode: "US"}}
+
+	// The cached link never sees the hits, the live counters do
+	seen := map[uint]bool{}
+	for i := 0; i < 2; i++ {
+		target, reservation, err := service.ReserveTarget(link, visitor)
+		require.NoError(t, err)
+		require.NotNil(t, reservation)
+		seen[target.ID] = true
+	}
+	assert.Equal(t, map[uint]bool{1: true, 2: true}, seen)
+
+	_, _, err := service.ReserveTarget(link, visitor)
+	assert.Error(t, err)
+
+	link.Targets = append(link.Targets, models.Target{ID: 3, Weight: 1, IsActive: true})
+	_, _, err = service.ReserveTarget(link, visitor)
+	require.NoError(t, err)
+
+	_, _, err = service.ReserveTarget(link, visitor)
+	assert.ErrorIs(t, err, ErrLinkCapReached)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+var (
+	// ErrUnknownClick is returned for postbacks whose click ID was never issued.
+	ErrUnknownClick = errors.New("unknown click id")
+	// ErrInvalidConversionStatus is returned for unknown postback statuses.
+	ErrInvalidConversionStatus = errors.New("invalid conversion status")
+)
+
+// Postback is a conversion reported by a network for a click ID. Network
+// is the network the postback was authenticated for; the click must be on
+// one of its links.
+type Postback struct {
+	Network       string
+	ClickID       string
+	TransactionID string
+	Payout        float64
+	Status        string
+	IP            string
+}
+
+type ConversionService struct {
+	db     *gorm.DB
+	bandit *BanditService
+}
+
+func NewConversionService(db *gorm.DB, redis *redis.Client) *ConversionService {
+	return &ConversionService{
+		db:     db,
+		bandit: NewBanditService(redis),
+	}
+}
+
+// RecordPostback stores the conversion for a postback, or updates it when
+// the network reports the same click and transaction again, for example to
+// approve a pending conversion. Approved conversions feed the bandit
+// selection strategies. Clicks on other networks' links are unknown.
+func (s *ConversionService) RecordPostback(ctx context.Context, postback *Postback) (*models.Conversion, error) {
+	status := postback.Status
+	if status == "" {
+		status = models.ConversionApproved
+	}
+	if !models.IsValidConversionStatus(status) {
+		return nil, ErrInvalidConversionStatus
+	}
+	
+	var accessLog models.AccessLog
+	err := s.db.Joins("JOIN links ON links.id = access_logs.link_id").
+		Where("access_logs.click_id = ? AND links.network = ?", postback.ClickID, postback.Network).
+		First(&accessLog).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownClick
+		}
+		return nil, err
+	}
+	
+	conversion := models.Conversion{
+		ClickID:       postback.ClickID,
+		TransactionID: postback.TransactionID,
+		AccessLogID:   accessLog.ID,
+		LinkID:        accessLog.LinkID,
+		TargetID:      accessLog.TargetID,
+		Payout:        postback.Payout,
+		Status:        status,
+		IP:            postback.IP,
+	}
+	
+	// The row is inserted, or locked when it exists, so that concurrent
+	// postbacks for the same conversion see each other's status and the
+	// bandit is updated once per transition.
+	previous := ""
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "click_id"}, {Name: "transaction_id"}},
+			DoNothing: true,
+		}).Create(&conversion)
+		if result.Error != nil || result.RowsAffected == 1 {
+			return result.Error
+		}
+		
+		var existing models.Conversion
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("click_id = ? AND transaction_id = ?", postback.ClickID, postback.TransactionID).
+			First(&existing).Error; err != nil {
+			return err
+		}
+		previous = existing.Status
+		
+		existing.Payout = conversion.Payout
+		existing.Status = conversion.Status
+		existing.IP = conversion.IP
+		conversion = existing
+		return tx.Save(&conversion).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	wasApproved := previous == models.ConversionApproved
+	isApproved := status == models.ConversionApproved
+	switch {
+	case conversion.TargetID == nil:
+		// Clicks sent down the fallback chain have no target to learn about
+	case isApproved && !wasApproved:
+		_ = s.bandit.RecordConversion(ctx, *conversion.TargetID, 1)
+	case wasApproved && !isApproved:
+		_ = s.bandit.RecordConversion(ctx, *conversion.TargetID, -1)
+	}
+	
+	return &conversion, nil
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+const countryGroupsCacheKey = "country_groups"
+
+var (
+	countryCodePattern      = regexp.MustCompile(`^[A-Z]{2}$`)
+	countryGroupNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{2,49}$`)
+)
+
+type CountryGroupService struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+// NewCountryGroupService creates the service. redis may be nil, in which
+// case groups are always read from the database.
+func NewCountryGroupService(db *gorm.DB, redis *redis.Client) *CountryGroupService {
+	return &CountryGroupService{
+		db:    db,
+		redis: redis,
+	}
+}
+
+// IsValidCountryGroupName reports whether name can be used for a group. Names
+// are at least three characters so they never collide with a country code.
+func IsValidCountryGroupName(name string) bool {
+	return countryGroupNamePattern.MatchString(name)
+}
+
+func (s *CountryGroupService) ListGroups() ([]models.CountryGroup, error) {
+	var groups []models.CountryGroup
+	if err := s.db.Order("name").Find(&groups).Error; err != nil {
+		return nil, fmt.Errorf("failed to list country groups: %w", err)
+	}
+	return groups, nil
+}
+
+func (s *CountryGroupService) GetGroup(name string) (*models.CountryGroup, error) {
+	var group models.CountryGroup
+	err := s.db.Where("name = ?", strings.ToUpper(name)).First(&group).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get country group: %w", err)
+	}
+	return &group, nil
+}
+
+// SaveGroup validates and creates or updates a group.
+func (s *CountryGroupService) SaveGroup(group *models.CountryGroup, countries []string) error {
+	group.Name = strings.ToUpper(strings.TrimSpace(group.Name))
+	if !IsValidCountryGroupName(group.Name) {
+		return fmt.Errorf("invalid group name %q", group.Name)
+	}
+	if group.Name == "ALL" {
+		return errors.New("ALL is reserved")
+	}
+	if len(countries) == 0 {
+		return errors.New("a group needs at least one country")
+	}
+
+	codes := make([]string, 0, len(countries))
+	for _, code := range countries {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !countryCodePattern.MatchString(code) {
+			return fmt.Errorf("invalid country code %q", code)
+		}
+		codes = append(codes, code)
+	}
+	data, _ := json.Marshal(codes)
+	group.Countries = string(data)
+
+	if err := s.db.Save(group).Error; err != nil {
+		return fmt.Errorf("failed to save country group: %w", err)
+	}
+
+	s.invalidate()
+	return nil
+}
+
+func (s *CountryGroupService) DeleteGroup(name string) (bool, error) {
+	result := s.db.Where("name = ?", strings.ToUpper(name)).Delete(&models.CountryGroup{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete country group: %w", result.Error)
+	}
+
+	s.invalidate()
+	return result.RowsAffected > 0, nil
+}
+
+// Groups returns every group's countries keyed by group name.
+func (s *CountryGroupService) Groups() (map[string][]string, error) {
+	ctx := context.Background()
+
+	if s.redis != nil {
+		cached, err := s.redis.Get(ctx, countryGroupsCacheKey).Result()
+		if err == nil {
+			var groups map[string][]string
+			if err := json.Unmarshal([]byte(cached), &groups); err == nil {
+				return groups, nil
+			}
+		}
+	}
+
+	list, err := s.ListGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]string, len(list))
+	for _, group := range list {
+		groups[group.Name] = group.CountryList()
+	}
+
+	if s.redis != nil {
+		if data, err := json.Marshal(groups); err == nil {
+			s.redis.Set(ctx, countryGroupsCacheKey, data, 10*time.Minute)
+		}
+	}
+
+	return groups, nil
+}
+
+// ValidateCountries checks that every entry is a country code, ALL or a known group.
+func (s *CountryGroupService) ValidateCountries(entries []string) error {
+	var groups map[string][]string
+	for _, entry := range entries {
+		entry = strings.ToUpper(strings.TrimSpace(entry))
+		if entry == "ALL" || countryCodePattern.MatchString(entry) {
+			continue
+		}
+
+		if groups == nil {
+			var err error
+			if groups, err = s.Groups(); err != nil {
+				return err
+			}
+		}
+		if _, ok := groups[entry]; !ok {
+			return fmt.Errorf("unknown country or country group %q", entry)
+		}
+	}
+	return nil
+}
+
+// Expand replaces group names with their countries. Country codes and ALL
+// are kept as they are. Names that cannot be resolved, because the group
+// does not exist or the groups could not be loaded, are left out and
+// reported in the error; callers decide whether that fails open or closed.
+func (s *CountryGroupService) Expand(entries []string) ([]string, error) {
+	var groups map[string][]string
+	var groupsErr error
+	var unresolved []string
+	result := make([]string, 0, len(entries))
+	seen := make(map[string]bool)
+
+	add := func(code string) {
+		if !seen[code] {
+			seen[code] = true
+			result = append(result, code)
+		}
+	}
+
+	for _, entry := range entries {
+		entry = strings.ToUpper(strings.TrimSpace(entry))
+		if entry == "ALL" || countryCodePattern.MatchString(entry) {
+			add(entry)
+			continue
+		}
+
+		if groups == nil && groupsErr == nil {
+			groups, groupsErr = s.Groups()
+		}
+		codes, ok := groups[entry]
+		if !ok {
+			unresolved = append(unresolved, entry)
+			continue
+		}
+		for _, code := range codes {
+			add(code)
+		}
+	}
+
+	switch {
+	case len(unresolved) == 0:
+		return result, nil
+	case groupsErr != nil:
+		return result, groupsErr
+	}
+	return result, fmt.Errorf("unknown country groups %s", strings.Join(unresolved, ", "))
+}
+
+// CountryGroupReference is something using a country group by name.
+type CountryGroupReference struct {
+	Kind string `json:"kind"` // target, link (fallbacks) or template
+	ID   uint   `json:"id"`
+}
+
+// References lists the targets (countries, exclusions and weight
+// overrides), link fallback chains and templates using the group. A group
+// must not be renamed or deleted while it is referenced.
+func (s *CountryGroupService) References(name string) ([]CountryGroupReference, error) {
+	name = strings.ToUpper(name)
+	// Names are stored quoted in JSON; the match is confirmed by parsing.
+	// targets.countries and link_templates.target_config are JSONB in
+	// Postgres, which has no UPPER or LIKE for jsonb, so every column is
+	// cast to text first
+	like := "%" + strconv.Quote(name) + "%"
+	var refs []CountryGroupReference
+
+	var targets []models.Target
+	err := s.db.Select("id", "countries", "excluded_countries", "country_weights").
+		Where("UPPER(CAST(countries AS TEXT)) LIKE ? OR UPPER(CAST(excluded_countries AS TEXT)) LIKE ? OR UPPER(CAST(country_weights AS TEXT)) LIKE ?", like, like, like).
+		Find(&targets).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find targets using country group: %w", err)
+	}
+	for _, target := range targets {
+		entries := append(models.ParseStringList(target.Countries), models.ParseStringList(target.ExcludedCountries)...)
+		for key := range target.GetCountryWeights() {
+			entries = append(entries, key)
+		}
+		if containsFold(entries, name) {
+			refs = append(refs, CountryGroupReference{Kind: "target", ID: target.ID})
+		}
+	}
+
+	var links []models.Link
+	if err := s.db.Select("id", "fallbacks").Where("UPPER(CAST(fallbacks AS TEXT)) LIKE ?", like).Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("failed to find links using country group: %w", err)
+	}
+	for _, link := range links {
+		for _, fallback := range link.GetFallbacks() {
+			if containsFold(fallback.Countries, name) {
+				refs = append(refs, CountryGroupReference{Kind: "link", ID: link.ID})
+				break
+			}
+		}
+	}
+
+	// Templates are stored by the api package; only their target config
+	// matters here
+	var templates []struct {
+		ID           uint
+		TargetConfig string
+	}
+	err = s.db.Table("link_templates").Select("id", "target_config").
+		Where("UPPER(CAST(target_config AS TEXT)) LIKE ?", like).Find(&templates).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find templates using country group: %w", err)
+	}
+	for _, template := range templates {
+		var targets []struct {
+			Countries         []string       `json:"countries"`
+			ExcludedCountries []string       `json:"excluded_countries"`
+			CountryWeights    map[string]int `json:"country_weights"`
+		}
+		if err := json.Unmarshal([]byte(template.TargetConfig), &targets); err != nil {
+			continue
+		}
+		for _, target := range targets {
+			entries := append(target.Countries, target.ExcludedCountries...)
+			for key := range target.CountryWeights {
+				entries = append(entries, key)
+			}
+			if containsFold(entries, name) {
+				refs = append(refs, CountryGroupReference{Kind: "template", ID: template.ID})
+				break
+			}
+		}
+	}
+
+	return refs, nil
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CountryGroupService) invalidate() {
+	if s.redis != nil {
+		s.redis.Del(context.Background(), countryGroupsCacheKey)
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+var (
+	// ErrNoEligibleTarget is returned when no target can take the visitor.
+	ErrNoEligibleTarget = errors.New("no targets available")
+	// ErrGeoMismatch is returned when no target can take the visitor and at
+	// least one was ruled out only by the visitor's location.
+	ErrGeoMismatch = errors.New("no targets available for this country")
+)
+
+// FallbackReason maps a target selection or reservation error to the
+// reason used to pick a fallback.
+func FallbackReason(err error) string {
+	switch {
+	case errors.Is(err, ErrLinkCapReached), errors.Is(err, ErrLinkPaced):
+		return models.FallbackCapReached
+	case errors.Is(err, ErrGeoMismatch):
+		return models.FallbackGeoMismatch
+	}
+	return models.FallbackNoTarget
+}
+
+// FallbackURL walks the link's fallback chain and returns the URL of the
+// first entry matching the reason and the visitor's country, expanding
+// country groups; a group that cannot be resolved matches no one.
+// BackupURL ends the chain and matches everything. It returns an empty
+// string when nothing matches.
+func (s *LinkService) FallbackURL(link *models.Link, reason string, country string) string {
+	for _, fallback := range link.GetFallbacks() {
+		if len(fallback.Reasons) > 0 && !matchesAny(fallback.Reasons, reason) {
+			continue
+		}
+		if len(fallback.Countries) == 0 {
+			return fallback.URL
+		}
+		if countries, _ := s.countryGroups.Expand(fallback.Countries); !matchesAny(countries, country) {
+			continue
+		}
+		return fallback.URL
+	}
+	return link.BackupURL
+}
+
+func matchesAny(list []string, value string) bool {
+	for _, item := range list {
+		if item == "ALL" || strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
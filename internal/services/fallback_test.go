@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/pkg/geoip"
+)
+
+func TestLinkService_FallbackURL(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	service := NewLinkService(nil, client)
+	link := &models.Link{
+		BackupURL: "https://backup.example.com",
+		Fallbacks: `[
+			{"url": "https://capped-us.example.com", "countries": ["US"], "reasons": ["cap_reached"]},
+			{"url": "https://capped.example.com", "reasons": ["cap_reached"]},
+			{"url": "https://de.example.com", "countries": ["DE"]}
+		]`,
+	}
+
+	assert.Equal(t, "https://capped-us.example.com", service.FallbackURL(link, models.FallbackCapReached, "US"))
+	assert.Equal(t, "https://capped.example.com", service.FallbackURL(link, models.FallbackCapReached, "DE"))
+	assert.Equal(t, "https://de.example.com", service.FallbackURL(link, models.FallbackRateLimited, "DE"))
+	assert.Equal(t, "https://backup.example.com", service.FallbackURL(link, models.FallbackNoTarget, "FR"))
+
+	link.BackupURL = ""
+	assert.Equal(t, "", service.FallbackURL(link, models.FallbackNoTarget, "FR"))
+}
+
+func TestLinkService_SelectTargetReasons(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	service := NewLinkService(nil, client)
+	link := &models.Link{
+		Targets: []models.Target{
+			{ID: 1, Weight: 1, IsActive: true, Countries: `["US"]`},
+			{ID: 2, Weight: 1, IsActive: false},
+		},
+	}
+	visitor := &Visitor{IP: "1.2.3.4", Location: &geoip.Location{CountryCode: "FR"}}
+
+	_, err := service.SelectTargetFor(link, visitor)
+	require.ErrorIs(t, err, ErrGeoMismatch)
+	assert.Equal(t, models.FallbackGeoMismatch, FallbackReason(err))
+
+	link.Targets[0].IsActive = false
+	_, err = service.SelectTargetFor(link, visitor)
+	require.ErrorIs(t, err, ErrNoEligibleTarget)
+	assert.Equal(t, models.FallbackNoTarget, FallbackReason(err))
+
+	assert.Equal(t, models.FallbackCapReached, FallbackReason(ErrLinkPaced))
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/pkg/geoip"
+)
+
+var regionCodePattern = regexp.MustCompile(`^[A-Z]{2}-[A-Z0-9]{1,3}$`)
+
+// IsValidRegionCode reports whether code is an ISO 3166-2 style code such as "NG-LA".
+func IsValidRegionCode(code string) bool {
+	return regionCodePattern.MatchString(strings.ToUpper(code))
+}
+
+// IsValidCity accepts a city name, optionally scoped to a country as "NG:Lagos".
+func IsValidCity(city string) bool {
+	country, name := splitCity(city)
+	if country != "" && len(country) != 2 {
+		return false
+	}
+	return strings.TrimSpace(name) != ""
+}
+
+// matchesRegionAndCity applies the target's region and city allow and deny lists.
+func matchesRegionAndCity(target *models.Target, location *geoip.Location) bool {
+	if location == nil {
+		location = &geoip.Location{}
+	}
+
+	region := ""
+	if location.CountryCode != "" && location.RegionCode != "" {
+		region = location.CountryCode + "-" + location.RegionCode
+	}
+
+	if containsEntry(target.ExcludedRegions, func(entry string) bool {
+		return strings.EqualFold(entry, region)
+	}) {
+		return false
+	}
+	if !allowedBy(target.Regions, func(entry string) bool {
+		return strings.EqualFold(entry, region)
+	}) {
+		return false
+	}
+
+	cityMatches := func(entry string) bool {
+		return cityMatches(entry, location)
+	}
+	if containsEntry(target.ExcludedCities, cityMatches) {
+		return false
+	}
+	return allowedBy(target.Cities, cityMatches)
+}
+
+func cityMatches(entry string, location *geoip.Location) bool {
+	if location.City == "" {
+		return false
+	}
+	country, name := splitCity(entry)
+	if country != "" && !strings.EqualFold(country, location.CountryCode) {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(name), location.City)
+}
+
+func splitCity(entry string) (country string, name string) {
+	if i := strings.Index(entry, ":"); i >= 0 {
+		return strings.TrimSpace(entry[:i]), entry[i+1:]
+	}
+	return "", entry
+}
+
+// allowedBy reports whether an allowlist stored as a JSON array permits a
+// visitor. An empty list allows everyone.
+func allowedBy(raw string, match func(string) bool) bool {
+	list := models.ParseStringList(raw)
+	if len(list) == 0 {
+		return true
+	}
+	for _, entry := range list {
+		if match(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsEntry reports whether any entry of a JSON array matches.
+func containsEntry(raw string, match func(string) bool) bool {
+	for _, entry := range models.ParseStringList(raw) {
+		if match(entry) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/pkg/geoip"
+)
+
+func TestMatchesRegionAndCity(t *testing.T) {
+	lagos := &geoip.Location{CountryCode: "NG", RegionCode: "LA", City: "Lagos"}
+	abuja := &geoip.Location{CountryCode: "NG", RegionCode: "FC", City: "Abuja"}
+	lagosPT := &geoip.Location{CountryCode: "PT", RegionCode: "08", City: "Lagos"}
+
+	t.Run("No rules", func(t *testing.T) {
+		assert.True(t, matchesRegionAndCity(&models.Target{}, lagos))
+		assert.True(t, matchesRegionAndCity(&models.Target{}, nil))
+	})
+
+	t.Run("Region allowlist", func(t *testing.T) {
+		target := &models.Target{Regions: `["NG-LA"]`}
+		assert.True(t, matchesRegionAndCity(target, lagos))
+		assert.False(t, matchesRegionAndCity(target, abuja))
+		assert.False(t, matchesRegionAndCity(target, &geoip.Location{CountryCode: "NG"}))
+	})
+
+	t.Run("Region denylist", func(t *testing.T) {
+		target := &models.Target{ExcludedRegions: `["NG-LA"]`}
+		assert.False(t, matchesRegionAndCity(target, lagos))
+		assert.True(t, matchesRegionAndCity(target, abuja))
+	})
+
+	t.Run("City scoped to country", func(t *testing.T) {
+		target := &models.Target{Cities: `["NG:Lagos"]`}
+		assert.True(t, matchesRegionAndCity(target, lagos))
+		assert.False(t, matchesRegionAndCity(target, lagosPT))
+
+		target = &models.Target{ExcludedCities: `["lagos"]`}
+		assert.False(t, matchesRegionAndCity(target, lagos))
+		assert.False(t, matchesRegionAndCity(target, lagosPT))
+		assert.True(t, matchesRegionAndCity(target, abuja))
+	})
+}
@@ -70,6 +70,68 @@ func (s *IPMemoryService) GetUnusedTarget(ctx context.Context, clientIP string,
 	return selectedTarget, nil
 }
 
+// GetUnusedTargetWeighted works like GetUnusedTarget but, instead of taking
+// the first unvisited target in list order, picks among the unvisited (or,
+// once all are visited, the least visited) targets by weight. Targets with
+// no weight are never chosen, unless no target has any. The choice is not
+// remembered; call MarkVisited once the visitor is sent to the target.
+func (s *IPMemoryService) GetUnusedTargetWeighted(ctx context.Context, clientIP string, linkID string, eligibleTargets []*models.Target, weights []int) (*models.Target, error) {
+	if len(eligibleTargets) == 0 {
+		return nil, fmt.Errorf("no eligible targets")
+	}
+
+	eligibleTargets, weights = withPositiveWeights(eligibleTargets, weights)
+
+	memoryKey := fmt.Sprintf("ip_memory:%s:%s", clientIP, linkID)
+
+	visitedTargets, err := s.getVisitHistory(ctx, memoryKey)
+	if err != nil {
+		// On error, fall back to plain weighted selection
+		return selectWeightedRandom(eligibleTargets, weights), nil
+	}
+
+	minVisits := int(^uint(0) >> 1) // Max int
+	for _, target := range eligibleTargets {
+		if visits := visitedTargets[fmt.Sprintf("%d", target.ID)]; visits < minVisits {
+			minVisits = visits
+		}
+	}
+
+	var candidates []*models.Target
+	var candidateWeights []int
+	for i, target := range eligibleTargets {
+		if visitedTargets[fmt.Sprintf("%d", target.ID)] == minVisits {
+			candidates = append(candidates, target)
+			candidateWeights = append(candidateWeights, weights[i])
+		}
+	}
+
+	return selectWeightedRandom(candidates, candidateWeights), nil
+}
+
+// MarkVisited remembers that the IP has been sent to the target of the link.
+func (s *IPMemoryService) MarkVisited(ctx context.Context, clientIP string, linkID string, targetID uint) error {
+	memoryKey := fmt.Sprintf("ip_memory:%s:%s", clientIP, linkID)
+	return s.markTargetVisited(ctx, memoryKey, targetID)
+}
+
+// withPositiveWeights drops the targets whose weight is not positive, or
+// returns all of them when none has a weight.
+func withPositiveWeights(targets []*models.Target, weights []int) ([]*models.Target, []int) {
+	var kept []*models.Target
+	var keptWeights []int
+	for i, target := range targets {
+		if weights[i] > 0 {
+			kept = append(kept, target)
+			keptWeights = append(keptWeights, weights[i])
+		}
+	}
+	if len(kept) == 0 {
+		return targets, weights
+	}
+	return kept, keptWeights
+}
+
 // getVisitHistory retrieves the visit count for each target
 func (s *IPMemoryService) getVisitHistory(ctx context.Context, key string) (map[string]int, error) {
 	data, err := s.redisClient.Get(ctx, key).Result()
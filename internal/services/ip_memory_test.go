@@ -3,7 +3,6 @@ package services
 import (
 	"context"
 	"testing"
-	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
@@ -144,4 +143,54 @@ func TestIPMemoryService_GetIPStats(t *testing.T) {
 
 	links := stats["links"].([]map[string]interface{})
 	assert.Len(t, links, 2)
-}
\ No newline at end of file
+}
+
+func TestIPMemoryService_GetUnusedTargetWeighted(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	service := NewIPMemoryService(client)
+	ctx := context.Background()
+
+	targets := []*models.Target{{ID: 1}, {ID: 2}, {ID: 3}}
+	weights := []int{0, 100, 0}
+
+	// Targets without weight get no traffic, even once the others are visited
+	for i := 0; i < 5; i++ {
+		target, err := service.GetUnusedTargetWeighted(ctx, "192.168.1.1", "abc123", targets, weights)
+		require.NoError(t, err)
+		require.NoError(t, service.MarkVisited(ctx, "192.168.1.1", "abc123", target.ID))
+		assert.Equal(t, uint(2), target.ID)
+	}
+
+	// Unvisited targets first among those with weight
+	weights = []int{50, 50, 0}
+	seen := map[uint]bool{}
+	for i := 0; i < 2; i++ {
+		target, err := service.GetUnusedTargetWeighted(ctx, "192.168.1.2", "abc123", targets, weights)
+		require.NoError(t, err)
+		require.NoError(t, service.MarkVisited(ctx, "192.168.1.2", "abc123", target.ID))
+		seen[target.ID] = true
+	}
+	assert.Equal(t, map[uint]bool{1: true, 2: true}, seen)
+
+	// Without any weight, all targets are rotated through
+	weights = []int{0, 0, 0}
+	seen = map[uint]bool{}
+	for i := 0; i < 3; i++ {
+		target, err := service.GetUnusedTargetWeighted(ctx, "192.168.1.3", "abc123", targets, weights)
+		require.NoError(t, err)
+		require.NoError(t, service.MarkVisited(ctx, "192.168.1.3", "abc123", target.ID))
+		seen[target.ID] = true
+	}
+	assert.Len(t, seen, 3)
+
+	// A choice is only remembered once marked
+	weights = []int{50, 50, 0}
+	first, err := service.GetUnusedTargetWeighted(ctx, "192.168.1.4", "abc123", targets[:1], weights[:1])
+	require.NoError(t, err)
+	history, err := service.getVisitHistory(ctx, "ip_memory:192.168.1.4:abc123")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+	assert.Equal(t, uint(1), first.ID)
+}
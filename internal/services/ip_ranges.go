@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/pkg/iprange"
+)
+
+// ipRangesVersionKey is bumped on every change so that other instances
+// reload their lists.
+const ipRangesVersionKey = "ip_ranges:version"
+
+// ErrInvalidIPRange is returned, wrapped with the reason, for entries or
+// uploads that cannot be saved as given.
+var ErrInvalidIPRange = errors.New("invalid ip range")
+
+// IPRangeService keeps the CIDR block and allow lists in memory for prefix
+// lookups. The database holds the lists; every instance reloads them when
+// another one changes them, and when an entry expires.
+type IPRangeService struct {
+	db       *gorm.DB
+	redis    *redis.Client
+	interval time.Duration
+	now      func() time.Time
+	lists    atomic.Pointer[ipRangeLists]
+}
+
+// ipRangeLists is an immutable snapshot of the lists.
+type ipRangeLists struct {
+	block   iprange.Table[*models.IPRange]
+	allow   iprange.Table[*models.IPRange]
+	version int64
+	// nextExpiry is the earliest expiry in the snapshot, zero if none.
+	nextExpiry time.Time
+}
+
+func NewIPRangeService(db *gorm.DB, redis *redis.Client) *IPRangeService {
+	s := &IPRangeService{
+		db:       db,
+		redis:    redis,
+		interval: 10 * time.Second,
+		now:      time.Now,
+	}
+	s.lists.Store(&ipRangeLists{})
+	return s
+}
+
+// Start keeps the lists up to date until ctx is cancelled.
+func (s *IPRangeService) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.refresh(ctx); err != nil {
+				log.Printf("ip ranges: %v", err)
+			}
+		}
+	}
+}
+
+// refresh reloads the lists when they changed elsewhere or an entry expired.
+func (s *IPRangeService) refresh(ctx context.Context) error {
+	lists := s.lists.Load()
+	version, err := s.version(ctx)
+	if err != nil {
+		return err
+	}
+	expired := !lists.nextExpiry.IsZero() && !s.now().Before(lists.nextExpiry)
+	if version == lists.version && !expired {
+		return nil
+	}
+	return s.Reload(ctx)
+}
+
+// Reload reads the unexpired entries and swaps them in.
+func (s *IPRangeService) Reload(ctx context.Context) error {
+	version, err := s.version(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	var entries []*models.IPRange
+	if err := s.db.WithContext(ctx).Where("expires_at IS NULL OR expires_at > ?", now).Find(&entries).Error; err != nil {
+		return fmt.Errorf("failed to load ip ranges: %w", err)
+	}
+
+	lists := &ipRangeLists{version: version}
+	for _, entry := range entries {
+		prefix, err := iprange.ParsePrefix(entry.CIDR)
+		if err != nil {
+			continue
+		}
+		if entry.List == models.IPRangeAllow {
+			lists.allow.Insert(prefix, entry)
+		} else {
+			lists.block.Insert(prefix, entry)
+		}
+		if entry.ExpiresAt != nil && (lists.nextExpiry.IsZero() || entry.ExpiresAt.Before(lists.nextExpiry)) {
+			lists.nextExpiry = *entry.ExpiresAt
+		}
+	}
+	s.lists.Store(lists)
+	return nil
+}
+
+func (s *IPRangeService) version(ctx context.Context) (int64, error) {
+	version, err := s.redis.Get(ctx, ipRangesVersionKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read ip ranges version: %w", err)
+	}
+	return version, nil
+}
+
+// changed tells every instance to reload, this one right away.
+func (s *IPRangeService) changed(ctx context.Context) error {
+	if err := s.redis.Incr(ctx, ipRangesVersionKey).Err(); err != nil {
+		return fmt.Errorf("failed to publish ip ranges change: %w", err)
+	}
+	return s.Reload(ctx)
+}
+
+// Match returns the most specific unexpired entry containing ip, looking
+// at the allow list first as it takes precedence. IPv4-mapped IPv6
+// addresses match IPv4 entries.
+func (s *IPRangeService) Match(ip string) *models.IPRange {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap().WithZone("")
+
+	lists := s.lists.Load()
+	now := s.now()
+	if entry, ok := lists.allow.Lookup(addr); ok && !entry.IsExpiredAt(now) {
+		return entry
+	}
+	if entry, ok := lists.block.Lookup(addr); ok && !entry.IsExpiredAt(now) {
+		return entry
+	}
+	return nil
+}
+
+// IsBlocked reports whether ip is on the block list and not allowlisted,
+// with the entry that matched.
+func (s *IPRangeService) IsBlocked(ip string) (bool, *models.IPRange) {
+	entry := s.Match(ip)
+	if entry == nil || entry.List != models.IPRangeBlock {
+		return false, entry
+	}
+	return true, entry
+}
+
+// List returns the entries of a list, or of both when list is empty,
+// optionally restricted to a source.
+func (s *IPRangeService) List(list string, source string) ([]models.IPRange, error) {
+	query := s.db.Order("list, cidr")
+	if list != "" {
+		query = query.Where("list = ?", list)
+	}
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+
+	var entries []models.IPRange
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to list ip ranges: %w", err)
+	}
+	return entries, nil
+}
+
+// Save validates and adds entries. An entry whose CIDR is already on the
+// same list replaces it.
+func (s *IPRangeService) Save(ctx context.Context, entries []models.IPRange) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	entries, err := normalizeIPRanges(entries)
+	if err != nil {
+		return err
+	}
+	if err := upsertIPRanges(s.db.WithContext(ctx), entries); err != nil {
+		return err
+	}
+	return s.changed(ctx)
+}
+
+// Import adds the CIDRs read from r, one per line, to a list under the
+// given source, reason and expiry. With replace, the entries of the source
+// on that list that are not in r are removed.
+func (s *IPRangeService) Import(ctx context.Context, r io.Reader, template models.IPRange, replace bool) (int, error) {
+	prefixes, err := iprange.ReadPrefixes(r)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIPRange, err)
+	}
+	if replace && template.Source == "" {
+		return 0, fmt.Errorf("%w: replacing a list requires a source", ErrInvalidIPRange)
+	}
+
+	entries := make([]models.IPRange, len(prefixes))
+	for i, prefix := range prefixes {
+		entries[i] = template
+		entries[i].CIDR = prefix.String()
+	}
+	if entries, err = normalizeIPRanges(entries); err != nil {
+		return 0, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if replace {
+			err := tx.Where("list = ? AND source = ?", template.List, template.Source).Delete(&models.IPRange{}).Error
+			if err != nil {
+				return fmt.Errorf("failed to replace ip ranges: %w", err)
+			}
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return upsertIPRanges(tx, entries)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), s.changed(ctx)
+}
+
+// Delete removes an entry.
+func (s *IPRangeService) Delete(ctx context.Context, id uint) error {
+	result := s.db.WithContext(ctx).Delete(&models.IPRange{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete ip range: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return s.changed(ctx)
+}
+
+// normalizeIPRanges checks the lists and stores each CIDR in canonical
+// form, a single address as a full-length prefix. Of entries repeating a
+// CIDR on the same list, the last one is kept.
+func normalizeIPRanges(entries []models.IPRange) ([]models.IPRange, error) {
+	seen := make(map[string]int, len(entries))
+	normalized := make([]models.IPRange, 0, len(entries))
+	for _, entry := range entries {
+		if !models.IsValidIPRangeList(entry.List) {
+			return nil, fmt.Errorf("%w: unknown list %q", ErrInvalidIPRange, entry.List)
+		}
+		prefix, err := iprange.ParsePrefix(entry.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidIPRange, err)
+		}
+		entry.CIDR = prefix.String()
+
+		key := entry.List + " " + entry.CIDR
+		if i, ok := seen[key]; ok {
+			normalized[i] = entry
+			continue
+		}
+		seen[key] = len(normalized)
+		normalized = append(normalized, entry)
+	}
+	return normalized, nil
+}
+
+func upsertIPRanges(db *gorm.DB, entries []models.IPRange) error {
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cidr"}, {Name: "list"}},
+		DoUpdates: clause.AssignmentColumns([]string{"source", "reason", "expires_at", "updated_at"}),
+	}).CreateInBatches(entries, 500).Error
+	if err != nil {
+		return fmt.Errorf("failed to save ip ranges: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var languageTagPattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// ParseAcceptLanguage returns the language tags of an Accept-Language
+// header, lowercased and ordered by preference. Wildcards and tags with
+// q=0 are dropped.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 || !IsValidLanguageTag(tag) {
+			continue
+		}
+
+		tags = append(tags, weighted{tag: tag, q: q})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
+
+// IsValidLanguageTag reports whether tag looks like a BCP 47 tag such as "pt" or "pt-BR".
+func IsValidLanguageTag(tag string) bool {
+	return languageTagPattern.MatchString(strings.ToLower(tag))
+}
+
+// languageRank returns the position in languages, the visitor's tags in
+// order of preference, of the first tag in the target's JSON allowlist. A
+// bare language such as "pt" also matches regional variants such as
+// "pt-br". It returns -1 and true for targets without an allowlist, and
+// false when no tag matches.
+func languageRank(raw string, languages []string) (int, bool) {
+	if raw == "" || raw == "[]" || raw == "null" {
+		return -1, true
+	}
+
+	var allowed []string
+	if err := json.Unmarshal([]byte(raw), &allowed); err != nil || len(allowed) == 0 {
+		return -1, true
+	}
+
+	for rank, language := range languages {
+		language = strings.ToLower(language)
+		for _, item := range allowed {
+			item = strings.ToLower(item)
+			if language == item || strings.HasPrefix(language, item+"-") {
+				return rank, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(t, []string{"pt-br", "pt", "en-us", "en"},
+		ParseAcceptLanguage("pt-BR,pt;q=0.9,en-US;q=0.8,en;q=0.7"))
+
+	// Ordered by quality, wildcards and q=0 dropped
+	assert.Equal(t, []string{"es", "en"},
+		ParseAcceptLanguage("en;q=0.5, *;q=0.1, es, fr;q=0"))
+
+	assert.Empty(t, ParseAcceptLanguage(""))
+	assert.Empty(t, ParseAcceptLanguage("not a language!"))
+}
+
+func TestLanguageRank(t *testing.T) {
+	rank := func(raw string, languages ...string) int {
+		rank, ok := languageRank(raw, languages)
+		if !ok {
+			return -2
+		}
+		return rank
+	}
+
+	assert.Equal(t, -1, rank("", "pt-br"))
+	assert.Equal(t, 0, rank(`["pt"]`, "pt-br"))
+	assert.Equal(t, 0, rank(`["PT-BR"]`, "pt-br"))
+	assert.Equal(t, -2, rank(`["pt-br"]`, "pt-pt"))
+	assert.Equal(t, -2, rank(`["es"]`, "pt"))
+	assert.Equal(t, -2, rank(`["es"]`))
+
+	// Every tag is compared, in order of preference
+	assert.Equal(t, 1, rank(`["pt"]`, "es-mx", "pt"))
+	assert.Equal(t, 0, rank(`["pt", "es"]`, "es-mx", "pt"))
+}
+
+func TestProcessParametersFor_Lang(t *testing.T) {
+	service := &LinkService{}
+	target := &models.Target{
+		ParamMapping: `{"{lang}":"hl"}`,
+		StaticParams: `{"locale":"{lang}_lp"}`,
+	}
+	visitor := &Visitor{Languages: []string{"pt-br", "pt"}}
+
+	result, err := service.ProcessParametersFor(target, map[string]string{"kw": "x"}, visitor)
+	assert.NoError(t, err)
+	assert.Equal(t, "pt-br", result["hl"])
+	assert.Equal(t, "pt-br_lp", result["locale"])
+	assert.Equal(t, "x", result["kw"])
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/raoxb/smart_redirect/internal/config"
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+var (
+	// ErrLinkIDTaken is returned when a requested custom link ID is in use.
+	ErrLinkIDTaken = errors.New("link ID is already taken")
+	// ErrReservedLinkID is returned when a requested custom link ID is a
+	// reserved word.
+	ErrReservedLinkID = errors.New("link ID is reserved")
+)
+
+// maxLinkIDAttempts bounds the retries of a generated ID that collides.
+const maxLinkIDAttempts = 8
+
+var customLinkIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{2,31}$`)
+
+// reservedLinkIDs are words that custom link IDs may not use, in any case,
+// because they name routes or would read as them.
+var reservedLinkIDs = map[string]bool{
+	"admin":     true,
+	"api":       true,
+	"assets":    true,
+	"auth":      true,
+	"health":    true,
+	"login":     true,
+	"logout":    true,
+	"metrics":   true,
+	"null":      true,
+	"postback":  true,
+	"preview":   true,
+	"qr":        true,
+	"register":  true,
+	"static":    true,
+	"stats":     true,
+	"undefined": true,
+	"v1":        true,
+	"www":       true,
+}
+
+// ValidateCustomLinkID checks a requested link ID: 3 to 32 letters, digits,
+// '-' or '_', starting with a letter or digit, and not a reserved word.
+func ValidateCustomLinkID(id string) error {
+	if !customLinkIDPattern.MatchString(id) {
+		return fmt.Errorf("link ID must be 3 to 32 letters, digits, '-' or '_' and start with a letter or digit")
+	}
+	if reservedLinkIDs[strings.ToLower(id)] {
+		return ErrReservedLinkID
+	}
+	return nil
+}
+
+// LinkIDGenerator inserts links under a unique LinkID: the requested
+// custom one, or one generated in the format of the link's business unit.
+type LinkIDGenerator struct {
+	db     *gorm.DB
+	config config.LinkIDConfig
+}
+
+func NewLinkIDGenerator(db *gorm.DB, cfg config.LinkIDConfig) *LinkIDGenerator {
+	return &LinkIDGenerator{db: db, config: cfg}
+}
+
+// Create inserts the link. A LinkID set on the link is a custom ID and is
+// validated; it fails with ErrLinkIDTaken when in use. Otherwise IDs are
+// generated until one is free, so concurrent inserts racing for the same
+// ID retry instead of failing.
+func (g *LinkIDGenerator) Create(link *models.Link) error {
+	if link.LinkID != "" {
+		if err := ValidateCustomLinkID(link.LinkID); err != nil {
+			return err
+		}
+		if g.exists(link.LinkID) {
+			return ErrLinkIDTaken
+		}
+		if err := g.db.Create(link).Error; err != nil {
+			if g.exists(link.LinkID) {
+				return ErrLinkIDTaken
+			}
+			return fmt.Errorf("failed to create link: %w", err)
+		}
+		return nil
+	}
+
+	format := g.config.FormatFor(link.BusinessUnit)
+	var err error
+	for attempt := 0; attempt < maxLinkIDAttempts; attempt++ {
+		link.LinkID, err = generateLinkID(format)
+		if err != nil {
+			return err
+		}
+		if g.exists(link.LinkID) {
+			continue
+		}
+		if err = g.db.Create(link).Error; err == nil {
+			return nil
+		}
+		if !g.exists(link.LinkID) {
+			link.LinkID = ""
+			return fmt.Errorf("failed to create link: %w", err)
+		}
+	}
+	link.LinkID = ""
+	return fmt.Errorf("failed to create link: no free link ID after %d attempts", maxLinkIDAttempts)
+}
+
+// exists reports whether the ID is in use, deleted links included since
+// they keep their unique index entry.
+func (g *LinkIDGenerator) exists(linkID string) bool {
+	var count int64
+	g.db.Unscoped().Model(&models.Link{}).Where("link_id = ?", linkID).Count(&count)
+	return count > 0
+}
+
+// generateLinkID draws an ID from the format's alphabet with crypto/rand.
+func generateLinkID(format config.LinkIDFormat) (string, error) {
+	alphabet := []rune(format.Alphabet)
+	max := big.NewInt(int64(len(alphabet)))
+
+	id := make([]rune, format.Length)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate link ID: %w", err)
+		}
+		id[i] = alphabet[n.Int64()]
+	}
+	return string(id), nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+// LinkScheduler drops the cached links when their flight or one of their
+// targets' starts or ends, so that a boundary is seen everywhere within one
+// interval, and deactivates links and targets whose flight ended. Redirects
+// check the flight dates themselves, so IsActive is left alone when a
+// flight starts and a link or target switched off by hand stays off.
+type LinkScheduler struct {
+	db       *gorm.DB
+	redis    *redis.Client
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewLinkScheduler(db *gorm.DB, redis *redis.Client) *LinkScheduler {
+	return &LinkScheduler{
+		db:       db,
+		redis:    redis,
+		interval: time.Minute,
+		now:      time.Now,
+	}
+}
+
+// Start applies the boundaries crossed since the previous tick until ctx
+// is cancelled. Only boundaries crossed while running are applied.
+func (s *LinkScheduler) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	last := s.now().Add(-s.interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := s.now()
+			if err := s.Run(ctx, last, now); err != nil {
+				log.Printf("link scheduler: %v", err)
+				continue
+			}
+			last = now
+		}
+	}
+}
+
+// Run applies the flight boundaries in (from, to].
+func (s *LinkScheduler) Run(ctx context.Context, from time.Time, to time.Time) error {
+	linkIDs := make(map[uint]bool)
+
+	for _, boundary := range []struct {
+		column     string
+		deactivate bool
+	}{
+		{"starts_at", false},
+		{"expires_at", true},
+	} {
+		var ids []uint
+		err := s.db.Model(&models.Link{}).
+			Where(boundary.column+" > ? AND "+boundary.column+" <= ?", from, to).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return fmt.Errorf("failed to find links at %s: %w", boundary.column, err)
+		}
+		if boundary.deactivate && len(ids) > 0 {
+			if err := s.db.Model(&models.Link{}).Where("id IN ?", ids).Update("is_active", false).Error; err != nil {
+				return fmt.Errorf("failed to update links at %s: %w", boundary.column, err)
+			}
+		}
+		for _, id := range ids {
+			linkIDs[id] = true
+		}
+
+		var targets []models.Target
+		err = s.db.Select("id", "link_id").
+			Where(boundary.column+" > ? AND "+boundary.column+" <= ?", from, to).
+			Find(&targets).Error
+		if err != nil {
+			return fmt.Errorf("failed to find targets at %s: %w", boundary.column, err)
+		}
+		targetIDs := make([]uint, len(targets))
+		for i, target := range targets {
+			targetIDs[i] = target.ID
+			linkIDs[target.LinkID] = true
+		}
+		if boundary.deactivate && len(targetIDs) > 0 {
+			if err := s.db.Model(&models.Target{}).Where("id IN ?", targetIDs).Update("is_active", false).Error; err != nil {
+				return fmt.Errorf("failed to update targets at %s: %w", boundary.column, err)
+			}
+		}
+	}
+
+	return s.invalidate(ctx, linkIDs)
+}
+
+// invalidate drops the cached copies of the links.
+func (s *LinkScheduler) invalidate(ctx context.Context, linkIDs map[uint]bool) error {
+	if len(linkIDs) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(linkIDs))
+	for id := range linkIDs {
+		ids = append(ids, id)
+	}
+
+	var keys []string
+	if err := s.db.Unscoped().Model(&models.Link{}).Where("id IN ?", ids).Pluck("link_id", &keys).Error; err != nil {
+		return fmt.Errorf("failed to find links to invalidate: %w", err)
+	}
+	for i, key := range keys {
+		keys[i] = fmt.Sprintf("link:%s", key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.redis.Del(ctx, keys...).Err()
+}
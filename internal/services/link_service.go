@@ -6,56 +6,112 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"net/url"
+	"sort"
 	"strings"
 	"time"
 	
 	"github.com/redis/go-redis/v9"
-	"github.com/google/uuid"
 	"gorm.io/gorm"
 	
+	"github.com/raoxb/smart_redirect/internal/config"
 	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/pkg/geoip"
 )
 
 type LinkService struct {
-	db       *gorm.DB
-	redis    *redis.Client
-	ipMemory *IPMemoryService
+	db            *gorm.DB
+	redis         *redis.Client
+	ipMemory      *IPMemoryService
+	countryGroups *CountryGroupService
+	bandit        *BanditService
+	caps          *CapService
+	linkIDs       *LinkIDGenerator
+	selectors     map[string]TargetSelector
 }
 
 func NewLinkService(db *gorm.DB, redis *redis.Client) *LinkService {
+	ipMemory := NewIPMemoryService(redis)
+	bandit := NewBanditService(redis)
+	
 	return &LinkService{
-		db:       db,
-		redis:    redis,
-		ipMemory: NewIPMemoryService(redis),
+		db:            db,
+		redis:         redis,
+		ipMemory:      ipMemory,
+		countryGroups: NewCountryGroupService(db, redis),
+		bandit:        bandit,
+		caps:          NewCapService(db, redis),
+		linkIDs:       NewLinkIDGenerator(db, config.DefaultLinkIDs()),
+		selectors: map[string]TargetSelector{
+			StrategyWeighted:      WeightedSelector{},
+			StrategyIPMemory:      NewIPMemorySelector(ipMemory),
+			StrategyRoundRobin:    NewRoundRobinSelector(redis),
+			StrategySticky:        StickySelector{},
+			StrategyPriority:      PrioritySelector{},
+			StrategyThompson:      NewBanditSelector(bandit, StrategyThompson),
+			StrategyEpsilonGreedy: NewBanditSelector(bandit, StrategyEpsilonGreedy),
+		},
 	}
 }
 
+// RegisterSelector adds or replaces the selector used for a strategy name.
+func (s *LinkService) RegisterSelector(strategy string, selector TargetSelector) {
+	s.selectors[strategy] = selector
+}
+
+// Bandit returns the service holding per-target click and conversion counts.
+func (s *LinkService) Bandit() *BanditService {
+	return s.bandit
+}
+
+// Caps returns the service holding live link and target cap counters.
+func (s *LinkService) Caps() *CapService {
+	return s.caps
+}
+
+// CountryGroups returns the service used to expand country group names.
+func (s *LinkService) CountryGroups() *CountryGroupService {
+	return s.countryGroups
+}
+
+// SetLinkIDConfig sets the format of generated link IDs.
+func (s *LinkService) SetLinkIDConfig(cfg config.LinkIDConfig) {
+	s.linkIDs = NewLinkIDGenerator(s.db, cfg)
+}
+
+// CreateLink inserts the link under its custom LinkID, or a generated one
+// when it has none, and caches it. See LinkIDGenerator.Create.
 func (s *LinkService) CreateLink(link *models.Link) error {
-	if link.LinkID == "" {
-		link.LinkID = generateLinkID()
-	}
-	
-	if err := s.db.Create(link).Error; err != nil {
-		return fmt.Errorf("failed to create link: %w", err)
+	if err := s.linkIDs.Create(link); err != nil {
+		return err
 	}
 	
 	return s.cacheLink(link)
 }
 
+// GetLinkByID returns an active link whose flight has started, or nil. A
+// link past its ExpiresAt is returned even after the schedule job has
+// deactivated it, so that its expiry action can be applied.
 func (s *LinkService) GetLinkByID(linkID string) (*models.Link, error) {
 	ctx := context.Background()
 	cacheKey := fmt.Sprintf("link:%s", linkID)
+	now := time.Now()
 	
 	cached, err := s.redis.Get(ctx, cacheKey).Result()
 	if err == nil {
 		var link models.Link
 		if err := json.Unmarshal([]byte(cached), &link); err == nil {
+			if !link.HasStartedAt(now) {
+				return nil, nil
+			}
 			return &link, nil
 		}
 	}
 	
 	var link models.Link
-	err = s.db.Preload("Targets").Where("link_id = ? AND is_active = ?", linkID, true).First(&link).Error
+	err = s.db.Preload("Targets").
+		Where("link_id = ? AND (is_active = ? OR expires_at <= ?)", linkID, true, now).
+		First(&link).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -65,15 +121,39 @@ func (s *LinkService) GetLinkByID(linkID string) (*models.Link, error) {
 	
 	_ = s.cacheLink(&link)
 	
+	if !link.HasStartedAt(now) {
+		return nil, nil
+	}
 	return &link, nil
 }
 
 func (s *LinkService) SelectTarget(link *models.Link, ip string, country string) (*models.Target, error) {
+	return s.SelectTargetFor(link, &Visitor{
+		IP:       ip,
+		Location: &geoip.Location{IP: ip, CountryCode: country},
+	})
+}
+
+// SelectTargetFor picks a target for the visitor among the link's targets
+// that are active, under cap, in flight and schedule and allowed for the visitor's
+// location, language, device, OS and browser. Caps are checked against the
+// live counters of the CapService rather than the link's cached hits, and
+// paced caps against the part opened so far, so over-pace traffic goes to
+// the other targets. It returns ErrGeoMismatch when a target was ruled out
+// only by the visitor's location and ErrNoEligibleTarget otherwise.
+func (s *LinkService) SelectTargetFor(link *models.Link, visitor *Visitor) (*models.Target, error) {
 	if len(link.Targets) == 0 {
-		return nil, errors.New("no targets available")
+		return nil, ErrNoEligibleTarget
 	}
 	
+	hits := s.targetHits(link)
+	now := s.capTime()
 	eligibleTargets := make([]*models.Target, 0)
+	languageRanks := make([]int, 0)
+	bestLanguage := -1
+	country := visitor.CountryCode()
+	visitTime := visitor.VisitTime()
+	geoMismatch := false
 	
 	for i := range link.Targets {
 		target := &link.Targets[i]
@@ -81,48 +161,155 @@ func (s *LinkService) SelectTarget(link *models.Link, ip string, country string)
 			continue
 		}
 		
-		if target.Cap > 0 && target.CurrentHits >= target.Cap {
+		if target.Cap > 0 && hits[target.ID] >= target.PacedCap(link, now) {
 			continue
 		}
 		
-		if target.Countries != "" && target.Countries != "[]" {
-			var allowedCountries []string
-			if err := json.Unmarshal([]byte(target.Countries), &allowedCountries); err == nil && len(allowedCountries) > 0 {
-				allowed := false
-				for _, allowedCountry := range allowedCountries {
-					if strings.EqualFold(allowedCountry, country) || strings.EqualFold(allowedCountry, "ALL") {
-						allowed = true
-						break
-					}
-				}
-				if !allowed {
-					continue
-				}
-			}
+		if !target.IsInFlightAt(visitTime) || !target.IsScheduledAt(visitTime, visitor.TimeZone()) {
+			continue
+		}
+		
+		if !matchesList(target.DeviceTypes, visitor.Agent.DeviceType) ||
+			!matchesList(target.OperatingSystems, visitor.Agent.OS) ||
+			!matchesList(target.Browsers, visitor.Agent.Browser) {
+			continue
+		}
+		
+		rank, ok := languageRank(target.Languages, visitor.Languages)
+		if !ok {
+			continue
+		}
+		
+		if !s.matchesCountry(target, country) || !matchesRegionAndCity(target, visitor.Location) {
+			geoMismatch = true
+			continue
 		}
 		
 		eligibleTargets = append(eligibleTargets, target)
+		languageRanks = append(languageRanks, rank)
+		if rank >= 0 && (bestLanguage < 0 || rank < bestLanguage) {
+			bestLanguage = rank
+		}
+	}
+	
+	// Targets for a less preferred language only get the visitor when no
+	// target is for a more preferred one. Targets without a language
+	// allowlist are kept
+	if bestLanguage >= 0 {
+		preferred := eligibleTargets[:0]
+		for i, target := range eligibleTargets {
+			if languageRanks[i] <= bestLanguage {
+				preferred = append(preferred, target)
+			}
+		}
+		eligibleTargets = preferred
 	}
 	
 	if len(eligibleTargets) == 0 {
-		return nil, errors.New("no targets available for this country")
+		if geoMismatch {
+			return nil, ErrGeoMismatch
+		}
+		return nil, ErrNoEligibleTarget
 	}
 	
-	// Use IP memory service to select target
-	ctx := context.Background()
-	selected, err := s.ipMemory.GetUnusedTarget(ctx, ip, link.LinkID, eligibleTargets)
-	if err != nil {
+	weights := make([]int, len(eligibleTargets))
+	for i, t := range eligibleTargets {
+		weights[i] = s.EffectiveWeight(t, country)
+	}
+	
+	req := &SelectionRequest{
+		Link:    link,
+		Visitor: visitor,
+		Targets: eligibleTargets,
+		Weights: weights,
+	}
+	
+	selected, err := s.selectorFor(link).Select(context.Background(), req)
+	if err != nil || selected == nil {
 		// Fallback to weighted random selection
-		totalWeight := 0
-		for _, t := range eligibleTargets {
-			totalWeight += t.Weight
-		}
-		selected = selectWeightedRandom(eligibleTargets, totalWeight)
+		selected = selectWeightedRandom(eligibleTargets, weights)
 	}
 	
 	return selected, nil
 }
 
+// ReserveTarget selects a target for the visitor and reserves a hit against
+// the link's and the target's caps. The caller releases the reservation if
+// the redirect fails. A target that reaches its cap between selection and
+// reservation, or goes over pace, is skipped and another one selected.
+func (s *LinkService) ReserveTarget(link *models.Link, visitor *Visitor) (*models.Target, *CapReservation, error) {
+	ctx := context.Background()
+	
+	if link.TotalCap > 0 {
+		if hits, err := s.caps.LinkHits(ctx, link); err == nil {
+			if hits >= link.TotalCap {
+				return nil, nil, ErrLinkCapReached
+			}
+			if hits >= link.PacedTotalCap(s.caps.Now()) {
+				return nil, nil, ErrLinkPaced
+			}
+		}
+	}
+	
+	for attempt := 0; attempt < len(link.Targets); attempt++ {
+		target, err := s.SelectTargetFor(link, visitor)
+		if err != nil {
+			return nil, nil, err
+		}
+		
+		reservation, err := s.caps.Reserve(ctx, link, target)
+		if errors.Is(err, ErrTargetCapReached) || errors.Is(err, ErrTargetPaced) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return target, reservation, nil
+	}
+	
+	return nil, nil, ErrNoEligibleTarget
+}
+
+// targetHits returns the live hit count of each of the link's targets,
+// falling back to the recorded hits without a CapService.
+func (s *LinkService) targetHits(link *models.Link) map[uint]int {
+	if s.caps == nil {
+		hits := make(map[uint]int, len(link.Targets))
+		for _, target := range link.Targets {
+			hits[target.ID] = target.CurrentHits
+		}
+		return hits
+	}
+	hits, _ := s.caps.TargetHits(context.Background(), link)
+	return hits
+}
+
+// capTime returns the time caps are counted at.
+func (s *LinkService) capTime() time.Time {
+	if s.caps == nil {
+		return time.Now()
+	}
+	return s.caps.Now()
+}
+
+// RecordSelection lets the link's selection strategy remember that the
+// visitor was sent to target, e.g. in IP memory or the round robin. It is
+// called once the redirect is certain, so that targets selected and then
+// skipped while reserving leave no trace.
+func (s *LinkService) RecordSelection(ctx context.Context, link *models.Link, visitor *Visitor, target *models.Target) error {
+	if recorder, ok := s.selectorFor(link).(SelectionRecorder); ok {
+		return recorder.Record(ctx, link, visitor, target)
+	}
+	return nil
+}
+
+func (s *LinkService) selectorFor(link *models.Link) TargetSelector {
+	if selector, ok := s.selectors[link.SelectionStrategy]; ok {
+		return selector
+	}
+	return s.selectors[DefaultStrategy]
+}
+
 func (s *LinkService) IncrementHits(linkID uint, targetID uint) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Model(&models.Link{}).Where("id = ?", linkID).
@@ -140,21 +327,75 @@ func (s *LinkService) IncrementHits(linkID uint, targetID uint) error {
 }
 
 func (s *LinkService) ProcessParameters(target *models.Target, originalParams map[string]string) (map[string]string, error) {
-	result := make(map[string]string)
-	
+	return s.ProcessParametersFor(target, originalParams, nil)
+}
+
+// ProcessParametersFor applies the target's passthrough policy,
+// ParamMapping, StaticParams and transforms, filling in values that depend
+// on the visitor. Macros such as {lang} or {click_id} are expanded in
+// StaticParams values and can be used as a ParamMapping source key.
+func (s *LinkService) ProcessParametersFor(target *models.Target, originalParams map[string]string, visitor *Visitor) (map[string]string, error) {
+	params := make(url.Values, len(originalParams))
 	for k, v := range originalParams {
-		result[k] = v
+		params.Set(k, v)
 	}
 	
+	processed := processParameters(target, params, NewMacros(nil, visitor, params))
+	
+	result := make(map[string]string, len(processed))
+	for k := range processed {
+		result[k] = processed.Get(k)
+	}
+	return result, nil
+}
+
+// BuildTargetURL returns the URL a visitor is redirected to: the target URL
+// with its macros expanded, and the processed parameters merged into its
+// query according to the target's MergePolicy. Repeated parameters are kept.
+func (s *LinkService) BuildTargetURL(link *models.Link, target *models.Target, originalParams url.Values, visitor *Visitor) (string, error) {
+	macros := NewMacros(link, visitor, originalParams)
+	
+	expanded, err := macros.ExpandURL(target.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid target URL: %w", err)
+	}
+	targetURL, err := url.Parse(expanded)
+	if err != nil {
+		return "", fmt.Errorf("invalid target URL: %w", err)
+	}
+	
+	query := targetURL.Query()
+	mergeParams(query, processParameters(target, originalParams, macros), target.MergePolicy)
+	targetURL.RawQuery = query.Encode()
+	
+	return targetURL.String(), nil
+}
+
+func processParameters(target *models.Target, originalParams url.Values, macros *Macros) url.Values {
+	result := make(url.Values)
+	
+	for k, values := range originalParams {
+		if target.PassesThrough(k) {
+			result[k] = append([]string(nil), values...)
+		}
+	}
+	
+	// Mapped params are renamed even when the passthrough policy would drop them
 	if target.ParamMapping != "" {
 		var mapping map[string]string
 		if err := json.Unmarshal([]byte(target.ParamMapping), &mapping); err == nil {
 			for oldKey, newKey := range mapping {
-				if val, exists := result[oldKey]; exists {
-					result[newKey] = val
+				if IsValidMacro(oldKey) {
+					if value, _ := macros.Lookup(oldKey); value != "" {
+						result.Set(newKey, value)
+					}
+					continue
+				}
+				if values, exists := originalParams[oldKey]; exists {
 					if oldKey != newKey {
 						delete(result, oldKey)
 					}
+					result[newKey] = append([]string(nil), values...)
 				}
 			}
 		}
@@ -164,12 +405,120 @@ func (s *LinkService) ProcessParameters(target *models.Target, originalParams ma
 		var staticParams map[string]string
 		if err := json.Unmarshal([]byte(target.StaticParams), &staticParams); err == nil {
 			for k, v := range staticParams {
-				result[k] = v
+				result.Set(k, macros.Expand(v, nil))
 			}
 		}
 	}
 	
-	return result, nil
+	if transforms := target.GetTransforms(); len(transforms) > 0 {
+		country, _ := macros.Lookup("{country}")
+		network, _ := macros.Lookup("{network}")
+		result = models.ApplyTransforms(transforms, result, models.TransformContext{
+			Country: country,
+			Network: network,
+		})
+	}
+	
+	return result
+}
+
+// mergeParams adds params to a target URL's query, resolving collisions
+// with the given merge policy.
+func mergeParams(query url.Values, params url.Values, policy string) {
+	for k, values := range params {
+		switch policy {
+		case models.MergeKeep:
+			if _, exists := query[k]; !exists {
+				query[k] = values
+			}
+		case models.MergeAppend:
+			query[k] = append(query[k], values...)
+		default:
+			query[k] = values
+		}
+	}
+}
+
+// matchesCountry applies the target's country allowlist and exclusions,
+// expanding country group names. "ALL" matches every country. Both fail
+// closed: an exclusion naming a group that cannot be resolved excludes
+// everyone, and such a group in the allowlist matches no one.
+func (s *LinkService) matchesCountry(target *models.Target, country string) bool {
+	excluded, err := s.countryGroups.Expand(models.ParseStringList(target.ExcludedCountries))
+	if err != nil {
+		return false
+	}
+	for _, code := range excluded {
+		if code == "ALL" || strings.EqualFold(code, country) {
+			return false
+		}
+	}
+	
+	allowed := models.ParseStringList(target.Countries)
+	if len(allowed) == 0 {
+		return true
+	}
+	codes, _ := s.countryGroups.Expand(allowed)
+	for _, code := range codes {
+		if code == "ALL" || strings.EqualFold(code, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveWeight returns the target's weight for a visitor country: an
+// override for the country itself wins, then an override for a country
+// group containing it (groups are tried in name order), then Weight.
+func (s *LinkService) EffectiveWeight(target *models.Target, country string) int {
+	overrides := target.GetCountryWeights()
+	if len(overrides) == 0 {
+		return target.Weight
+	}
+	
+	country = strings.ToUpper(country)
+	if weight, ok := overrides[country]; ok {
+		return weight
+	}
+	
+	groupNames := make([]string, 0, len(overrides))
+	for name := range overrides {
+		if len(name) > 2 {
+			groupNames = append(groupNames, name)
+		}
+	}
+	sort.Strings(groupNames)
+	
+	for _, name := range groupNames {
+		codes, _ := s.countryGroups.Expand([]string{name})
+		for _, code := range codes {
+			if code == country {
+				return overrides[name]
+			}
+		}
+	}
+	
+	return target.Weight
+}
+
+// matchesList reports whether value is in the JSON array stored in raw.
+// An empty or unset list matches everything.
+func matchesList(raw string, value string) bool {
+	if raw == "" || raw == "[]" || raw == "null" {
+		return true
+	}
+	
+	var allowed []string
+	if err := json.Unmarshal([]byte(raw), &allowed); err != nil || len(allowed) == 0 {
+		return true
+	}
+	
+	for _, item := range allowed {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *LinkService) cacheLink(link *models.Link) error {
@@ -182,19 +531,29 @@ func (s *LinkService) cacheLink(link *models.Link) error {
 	return s.redis.Set(ctx, fmt.Sprintf("link:%s", link.LinkID), data, 1*time.Hour).Err()
 }
 
-func generateLinkID() string {
-	id := uuid.New().String()
-	return strings.ReplaceAll(id[:6], "-", "")
-}
-
-func selectWeightedRandom(targets []*models.Target, totalWeight int) *models.Target {
+// selectWeightedRandom picks a target with probability proportional to
+// weights[i]. When no target has a positive weight it picks uniformly.
+func selectWeightedRandom(targets []*models.Target, weights []int) *models.Target {
 	if len(targets) == 1 {
 		return targets[0]
 	}
 	
+	totalWeight := 0
+	for _, w := range weights {
+		if w > 0 {
+			totalWeight += w
+		}
+	}
+	if totalWeight <= 0 {
+		return targets[rand.Intn(len(targets))]
+	}
+	
 	r := rand.Intn(totalWeight)
-	for _, target := range targets {
-		r -= target.Weight
+	for i, target := range targets {
+		if weights[i] <= 0 {
+			continue
+		}
+		r -= weights[i]
 		if r < 0 {
 			return target
 		}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+// ParamMacroPrefix starts a macro that expands to an incoming query
+// parameter, as in "{param:kw}".
+const ParamMacroPrefix = "param:"
+
+// MacroNames lists the macros that expand to a value of the visit. Any
+// incoming query parameter is also available as {param:<name>}.
+var MacroNames = []string{
+	"click_id",
+	"country",
+	"ip",
+	"network",
+	"link_id",
+	"bu",
+	"timestamp",
+	"lang",
+}
+
+var macroPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// FindMacros returns the macros used in s, including unknown ones, in the
+// order they appear.
+func FindMacros(s string) []string {
+	return macroPattern.FindAllString(s, -1)
+}
+
+// IsValidMacro reports whether macro, written with its braces, is known.
+func IsValidMacro(macro string) bool {
+	name := strings.TrimSuffix(strings.TrimPrefix(macro, "{"), "}")
+	if strings.HasPrefix(name, ParamMacroPrefix) {
+		return len(name) > len(ParamMacroPrefix)
+	}
+	for _, known := range MacroNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateMacros returns an error naming the first unknown macro in s.
+func ValidateMacros(s string) error {
+	for _, macro := range FindMacros(s) {
+		if !IsValidMacro(macro) {
+			return fmt.Errorf("unknown macro %s", macro)
+		}
+	}
+	return nil
+}
+
+// ValidateURLMacros checks a target URL: its macros must be known, and
+// may only appear in the path, query or fragment. A macro in the scheme or
+// host would let a visitor choose where the redirect goes.
+func ValidateURLMacros(rawURL string) error {
+	if err := ValidateMacros(rawURL); err != nil {
+		return err
+	}
+	if origin, _ := splitOrigin(rawURL); len(FindMacros(origin)) > 0 {
+		return fmt.Errorf("macros are only allowed in the path and query")
+	}
+	return nil
+}
+
+// splitOrigin splits a URL before its path, query or fragment, so that the
+// first part holds the scheme, user info, host and port.
+func splitOrigin(rawURL string) (string, string) {
+	start := 0
+	if i := strings.Index(rawURL, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	if i := strings.IndexAny(rawURL[start:], "/?#"); i >= 0 {
+		return rawURL[:start+i], rawURL[start+i:]
+	}
+	return rawURL, ""
+}
+
+// Macros holds the values macros expand to for one visit.
+type Macros struct {
+	values map[string]string
+	params url.Values
+}
+
+// NewMacros collects macro values from the link, the visitor and the
+// incoming query parameters; {param:name} uses the first value of a
+// repeated parameter. link may be nil, in which case {network} falls
+// back to the "network" parameter only and {link_id} and {bu} are empty.
+func NewMacros(link *models.Link, visitor *Visitor, params url.Values) *Macros {
+	values := map[string]string{
+		"click_id":  visitor.Click(),
+		"lang":      visitor.Language(),
+		"network":   params.Get("network"),
+		"timestamp": strconv.FormatInt(visitor.VisitTime().Unix(), 10),
+	}
+	if visitor != nil {
+		values["ip"] = visitor.IP
+		values["country"] = visitor.CountryCode()
+	}
+	if link != nil {
+		values["link_id"] = link.LinkID
+		values["bu"] = link.BusinessUnit
+		if values["network"] == "" {
+			values["network"] = link.Network
+		}
+	}
+
+	return &Macros{values: values, params: params}
+}
+
+// Lookup returns the value of a macro written with its braces.
+func (m *Macros) Lookup(macro string) (string, bool) {
+	name := strings.TrimSuffix(strings.TrimPrefix(macro, "{"), "}")
+	if strings.HasPrefix(name, ParamMacroPrefix) {
+		values, ok := m.params[strings.TrimPrefix(name, ParamMacroPrefix)]
+		if !ok || len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	}
+	value, ok := m.values[name]
+	return value, ok
+}
+
+// Expand replaces the known macros in s, passing each value through escape
+// when it is not nil. Unknown macros are left as they are.
+func (m *Macros) Expand(s string, escape func(string) string) string {
+	return macroPattern.ReplaceAllStringFunc(s, func(macro string) string {
+		if !IsValidMacro(macro) {
+			return macro
+		}
+		value, _ := m.Lookup(macro)
+		if escape != nil {
+			value = escape(value)
+		}
+		return value
+	})
+}
+
+// ExpandURL replaces the macros in a target URL, escaping values for the
+// part of the URL they appear in: path segment escaping before the query,
+// query escaping after it. Macros are never expanded in the scheme or host,
+// and an expansion that changes the host is an error.
+func (m *Macros) ExpandURL(rawURL string) (string, error) {
+	origin, rest := splitOrigin(rawURL)
+	if len(FindMacros(origin)) > 0 {
+		return "", fmt.Errorf("macros are only allowed in the path and query")
+	}
+
+	path := rest
+	query := ""
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		path, query = rest[:i], rest[i:]
+	}
+	expanded := origin + m.Expand(path, url.PathEscape) + m.Expand(query, url.QueryEscape)
+
+	want, err := url.Parse(origin)
+	if err != nil {
+		return "", err
+	}
+	got, err := url.Parse(expanded)
+	if err != nil {
+		return "", err
+	}
+	if got.Scheme != want.Scheme || got.User.String() != want.User.String() || got.Host != want.Host {
+		return "", fmt.Errorf("macro expansion changed the host to %q", got.Host)
+	}
+	return expanded, nil
+}
@@ -173,18 +173,21 @@ func (s *MonitorService) checkLinkCapacities(ctx context.Context) {
 	var links []models.Link
 	s.db.Where("is_active = ? AND total_cap > 0", true).Find(&links)
 	
+	caps := NewCapService(s.db, s.redis)
 	for _, link := range links {
-		usagePercent := float64(link.CurrentHits) / float64(link.TotalCap)
+		// Periodic caps are compared with the current period only
+		hits, _ := caps.LinkHits(ctx, &link)
+		usagePercent := float64(hits) / float64(link.TotalCap)
 		if usagePercent > s.alertConfig.LinkCapThreshold {
 			s.createAlert(ctx, &Alert{
 				Type:  "link_cap",
 				Level: "warning",
 				Title: fmt.Sprintf("Link %s Approaching Cap", link.LinkID),
 				Message: fmt.Sprintf("Link has used %.1f%% of its cap (%d/%d)", 
-					usagePercent*100, link.CurrentHits, link.TotalCap),
+					usagePercent*100, hits, link.TotalCap),
 				Details: map[string]interface{}{
 					"link_id":      link.LinkID,
-					"current_hits": link.CurrentHits,
+					"current_hits": hits,
 					"total_cap":    link.TotalCap,
 					"usage_percent": usagePercent * 100,
 				},
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/raoxb/smart_redirect/internal/config"
+	"github.com/raoxb/smart_redirect/pkg/iprange"
+)
+
+// ErrPostbackUnauthorized is returned for postbacks that do not carry the
+// network's secret, come from outside its allowed IPs, or name a network
+// that is not configured.
+var ErrPostbackUnauthorized = errors.New("postback not authorized")
+
+type postbackNetwork struct {
+	secret  string
+	allowed *iprange.Table[struct{}]
+}
+
+// PostbackAuth checks postbacks against the per network secrets and IP
+// allowlists of the configuration.
+type PostbackAuth struct {
+	networks map[string]postbackNetwork
+}
+
+// NewPostbackAuth builds the checks for each configured network. A network
+// with neither a secret nor allowed IPs is a configuration error.
+func NewPostbackAuth(cfg config.PostbackConfig) (*PostbackAuth, error) {
+	auth := &PostbackAuth{networks: make(map[string]postbackNetwork, len(cfg.Networks))}
+	for name, network := range cfg.Networks {
+		if network.Secret == "" && len(network.AllowedIPs) == 0 {
+			return nil, fmt.Errorf("postback network %s: secret or allowed_ips is required", name)
+		}
+		allowed := &iprange.Table[struct{}]{}
+		for _, entry := range network.AllowedIPs {
+			prefix, err := iprange.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("postback network %s: %w", name, err)
+			}
+			allowed.Insert(prefix, struct{}{})
+		}
+		auth.networks[name] = postbackNetwork{secret: network.Secret, allowed: allowed}
+	}
+	return auth, nil
+}
+
+// Verify returns ErrPostbackUnauthorized unless a postback for network,
+// carrying token and sent from ip, passes the network's checks.
+func (a *PostbackAuth) Verify(network, token, ip string) error {
+	checks, ok := a.networks[network]
+	if !ok || network == "" {
+		return ErrPostbackUnauthorized
+	}
+	if checks.secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(checks.secret)) != 1 {
+		return ErrPostbackUnauthorized
+	}
+	if checks.allowed.Len() > 0 {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !checks.allowed.Contains(addr) {
+			return ErrPostbackUnauthorized
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Rate limit algorithms that can be chosen per limit.
+const (
+	// AlgorithmFixedWindow counts every hit, rejected ones included, in a
+	// window that starts with the first hit.
+	AlgorithmFixedWindow = "fixed_window"
+	// AlgorithmSlidingWindow logs each allowed hit and counts the ones in
+	// the last window.
+	AlgorithmSlidingWindow = "sliding_window"
+	// AlgorithmTokenBucket allows bursts of up to limit hits and refills at
+	// limit per window.
+	AlgorithmTokenBucket = "token_bucket"
+)
+
+// DefaultAlgorithm is used for limits that do not set an algorithm.
+const DefaultAlgorithm = AlgorithmFixedWindow
+
+// RateLimitAlgorithms lists the valid algorithm names.
+var RateLimitAlgorithms = []string{
+	AlgorithmFixedWindow,
+	AlgorithmSlidingWindow,
+	AlgorithmTokenBucket,
+}
+
+// IsValidRateLimitAlgorithm reports whether name is a known algorithm. The
+// empty string selects DefaultAlgorithm.
+func IsValidRateLimitAlgorithm(name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, algorithm := range RateLimitAlgorithms {
+		if algorithm == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitAlgorithm decides whether one more hit on key is allowed when at
+// most limit hits are allowed per window. Implementations update Redis
+// atomically so that concurrent instances share the limit.
+type LimitAlgorithm interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error)
+}
+
+// The scripts read the clock with TIME so that every instance uses the
+// Redis server's time.
+
+var fixedWindowScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if count > tonumber(ARGV[1]) then
+	return 0
+end
+return 1
+`)
+
+var slidingWindowScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local window = tonumber(ARGV[2]) * 1000
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now, now .. ':' .. ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+var tokenBucketScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * capacity / window)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return allowed
+`)
+
+// FixedWindow is the counter used before algorithms could be chosen. Unlike
+// the original counter, the window is not extended by later hits.
+type FixedWindow struct {
+	redis *redis.Client
+}
+
+func NewFixedWindow(redis *redis.Client) *FixedWindow {
+	return &FixedWindow{redis: redis}
+}
+
+func (f *FixedWindow) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	return runLimitScript(ctx, f.redis, fixedWindowScript, key, limit, window)
+}
+
+// SlidingWindowLog keeps the time of each allowed hit in a sorted set.
+// Rejected hits are not logged, so a visitor is released as soon as its
+// oldest hit leaves the window.
+type SlidingWindowLog struct {
+	redis *redis.Client
+}
+
+func NewSlidingWindowLog(redis *redis.Client) *SlidingWindowLog {
+	return &SlidingWindowLog{redis: redis}
+}
+
+func (s *SlidingWindowLog) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	member := strconv.FormatInt(rand.Int63(), 36)
+	return runLimitScript(ctx, s.redis, slidingWindowScript, key+":sw", limit, window, member)
+}
+
+// TokenBucket stores the remaining tokens and the time they were counted
+// in a hash.
+type TokenBucket struct {
+	redis *redis.Client
+}
+
+func NewTokenBucket(redis *redis.Client) *TokenBucket {
+	return &TokenBucket{redis: redis}
+}
+
+func (b *TokenBucket) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	return runLimitScript(ctx, b.redis, tokenBucketScript, key+":tb", limit, window)
+}
+
+func runLimitScript(ctx context.Context, client *redis.Client, script *redis.Script, key string, limit int, window time.Duration, extra ...interface{}) (bool, error) {
+	ms := window.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	args := append([]interface{}{limit, ms}, extra...)
+	allowed, err := script.Run(ctx, client, []string{key}, args...).Int()
+	if err != nil {
+		return false, err
+	}
+	return allowed == 1, nil
+}
@@ -10,47 +10,64 @@ import (
 )
 
 type RateLimiter struct {
-	redis *redis.Client
+	redis      *redis.Client
+	algorithms map[string]LimitAlgorithm
+	ipRanges   *IPRangeService
 }
 
-func NewRateLimiter(redis *redis.Client) *RateLimiter {
+// NewRateLimiter creates a limiter whose IsIPBlocked also checks the CIDR
+// block and allow lists of ipRanges.
+func NewRateLimiter(redis *redis.Client, ipRanges *IPRangeService) *RateLimiter {
 	return &RateLimiter{
-		redis: redis,
+		redis:    redis,
+		ipRanges: ipRanges,
+		algorithms: map[string]LimitAlgorithm{
+			AlgorithmFixedWindow:   NewFixedWindow(redis),
+			AlgorithmSlidingWindow: NewSlidingWindowLog(redis),
+			AlgorithmTokenBucket:   NewTokenBucket(redis),
+		},
 	}
 }
 
+// Allow counts a hit on key with the named algorithm. Unknown names use
+// DefaultAlgorithm.
+func (r *RateLimiter) Allow(algorithm string, key string, limit int, duration time.Duration) (bool, error) {
+	limiter, ok := r.algorithms[algorithm]
+	if !ok {
+		limiter = r.algorithms[DefaultAlgorithm]
+	}
+	return limiter.Allow(context.Background(), key, limit, duration)
+}
+
 func (r *RateLimiter) CheckIPLimit(ip string, limit int, duration time.Duration) (bool, error) {
-	ctx := context.Background()
+	return r.CheckIPLimitWith(DefaultAlgorithm, ip, limit, duration)
+}
+
+// CheckIPLimitWith applies the per-IP limit with the named algorithm.
+func (r *RateLimiter) CheckIPLimitWith(algorithm string, ip string, limit int, duration time.Duration) (bool, error) {
 	key := fmt.Sprintf("rate_limit:ip:%s", ip)
 	
-	pipe := r.redis.Pipeline()
-	incr := pipe.Incr(ctx, key)
-	pipe.Expire(ctx, key, duration)
-	
-	_, err := pipe.Exec(ctx)
+	allowed, err := r.Allow(algorithm, key, limit, duration)
 	if err != nil {
 		return false, fmt.Errorf("failed to check rate limit: %w", err)
 	}
-	
-	count := incr.Val()
-	return count <= int64(limit), nil
+	return allowed, nil
 }
 
 func (r *RateLimiter) CheckIPLinkLimit(ip string, linkID uint, limit int, duration time.Duration) (bool, error) {
-	ctx := context.Background()
+	return r.CheckIPLinkLimitWith(DefaultAlgorithm, ip, linkID, limit, duration)
+}
+
+// CheckIPLinkLimitWith applies the per-IP limit of a link with the named
+// algorithm.
+func (r *RateLimiter) CheckIPLinkLimitWith(algorithm string, ip string, linkID uint, limit int, duration time.Duration) (bool, error) {
 	key := fmt.Sprintf("rate_limit:ip:%s:link:%d", ip, linkID)
 	
-	pipe := r.redis.Pipeline()
-	incr := pipe.Incr(ctx, key)
-	pipe.Expire(ctx, key, duration)
-	
-	_, err := pipe.Exec(ctx)
+	allowed, err := r.Allow(algorithm, key, limit, duration)
 	if err != nil {
 		return false, fmt.Errorf("failed to check IP link limit: %w", err)
 	}
-	
-	count := incr.Val()
-	return count <= int64(limit), nil
+	return allowed, nil
 }
 
 func (r *RateLimiter) CheckGlobalCap(key string, cap int) (bool, error) {
@@ -153,14 +170,28 @@ func (r *RateLimiter) GetIPAccessInfo(ip string) (*IPAccessInfo, error) {
 	return &info, nil
 }
 
+// BlockIP blocks the IP for duration. A duration of 0 or less unblocks it.
 func (r *RateLimiter) BlockIP(ip string, reason string, duration time.Duration) error {
 	ctx := context.Background()
 	key := fmt.Sprintf("blocked_ip:%s", ip)
 	
+	if duration <= 0 {
+		return r.redis.Del(ctx, key).Err()
+	}
 	return r.redis.Set(ctx, key, reason, duration).Err()
 }
 
+// IsIPBlocked reports whether the IP is blocked, by itself or by a CIDR on
+// the block list, with the reason. Allowlisted IPs are never blocked.
 func (r *RateLimiter) IsIPBlocked(ip string) (bool, string) {
+	blocked, entry := r.ipRanges.IsBlocked(ip)
+	if blocked {
+		return true, entry.BlockReason()
+	}
+	if entry != nil {
+		return false, ""
+	}
+	
 	ctx := context.Background()
 	key := fmt.Sprintf("blocked_ip:%s", ip)
 	
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+// Selection strategies that can be set on Link.SelectionStrategy.
+const (
+	StrategyWeighted   = "weighted"
+	StrategyIPMemory   = "ip_memory"
+	StrategyRoundRobin = "round_robin"
+	StrategySticky     = "sticky"
+	StrategyPriority   = "priority"
+	// Bandit strategies learn from recorded conversions, see BanditService.
+	StrategyThompson      = "thompson"
+	StrategyEpsilonGreedy = "epsilon_greedy"
+)
+
+// DefaultStrategy is used for links that do not set a strategy.
+const DefaultStrategy = StrategyIPMemory
+
+// SelectionStrategies lists the valid strategy names.
+var SelectionStrategies = []string{
+	StrategyWeighted,
+	StrategyIPMemory,
+	StrategyRoundRobin,
+	StrategySticky,
+	StrategyPriority,
+	StrategyThompson,
+	StrategyEpsilonGreedy,
+}
+
+// IsValidSelectionStrategy reports whether name is a known strategy. The
+// empty string selects DefaultStrategy.
+func IsValidSelectionStrategy(name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, strategy := range SelectionStrategies {
+		if strategy == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectionRequest is what a TargetSelector chooses from. Targets have
+// already passed every eligibility filter, and Weights holds each target's
+// effective weight for the visitor.
+type SelectionRequest struct {
+	Link    *models.Link
+	Visitor *Visitor
+	Targets []*models.Target
+	Weights []int
+}
+
+// TargetSelector chooses one target among the eligible ones. Select has no
+// side effects: a target it returns may still be skipped, e.g. when its
+// cap is reached before the hit is reserved.
+type TargetSelector interface {
+	Select(ctx context.Context, req *SelectionRequest) (*models.Target, error)
+}
+
+// SelectionRecorder is implemented by selectors that keep state about the
+// visitors they send to each target. Record is called once the visitor is
+// sent to the target, see LinkService.RecordSelection.
+type SelectionRecorder interface {
+	Record(ctx context.Context, link *models.Link, visitor *Visitor, target *models.Target) error
+}
+
+// WeightedSelector picks targets at random in proportion to their weights.
+type WeightedSelector struct{}
+
+func (WeightedSelector) Select(ctx context.Context, req *SelectionRequest) (*models.Target, error) {
+	if len(req.Targets) == 0 {
+		return nil, errors.New("no eligible targets")
+	}
+	return selectWeightedRandom(req.Targets, req.Weights), nil
+}
+
+// IPMemorySelector sends each IP to targets it has not seen yet, choosing
+// among them by weight, and to its least visited targets once it has seen
+// them all.
+type IPMemorySelector struct {
+	ipMemory *IPMemoryService
+}
+
+func NewIPMemorySelector(ipMemory *IPMemoryService) *IPMemorySelector {
+	return &IPMemorySelector{ipMemory: ipMemory}
+}
+
+func (s *IPMemorySelector) Select(ctx context.Context, req *SelectionRequest) (*models.Target, error) {
+	return s.ipMemory.GetUnusedTargetWeighted(ctx, req.Visitor.IP, req.Link.LinkID, req.Targets, req.Weights)
+}
+
+// Record remembers that the visitor's IP has seen the target.
+func (s *IPMemorySelector) Record(ctx context.Context, link *models.Link, visitor *Visitor, target *models.Target) error {
+	return s.ipMemory.MarkVisited(ctx, visitor.IP, link.LinkID, target.ID)
+}
+
+// RoundRobinSelector cycles through the eligible targets in order using a
+// per-link counter shared by every instance through Redis.
+type RoundRobinSelector struct {
+	redis *redis.Client
+}
+
+func NewRoundRobinSelector(redis *redis.Client) *RoundRobinSelector {
+	return &RoundRobinSelector{redis: redis}
+}
+
+func (s *RoundRobinSelector) Select(ctx context.Context, req *SelectionRequest) (*models.Target, error) {
+	if len(req.Targets) == 0 {
+		return nil, errors.New("no eligible targets")
+	}
+
+	n, err := s.redis.Get(ctx, roundRobinKey(req.Link)).Int64()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read round robin: %w", err)
+	}
+
+	return req.Targets[n%int64(len(req.Targets))], nil
+}
+
+// Record moves the link's counter on to the next target.
+func (s *RoundRobinSelector) Record(ctx context.Context, link *models.Link, visitor *Visitor, target *models.Target) error {
+	if err := s.redis.Incr(ctx, roundRobinKey(link)).Err(); err != nil {
+		return fmt.Errorf("failed to advance round robin: %w", err)
+	}
+	return nil
+}
+
+func roundRobinKey(link *models.Link) string {
+	return fmt.Sprintf("round_robin:link:%s", link.LinkID)
+}
+
+// StickySelector always sends an IP to the same target while the eligible
+// set is unchanged, using weighted rendezvous hashing so that adding or
+// removing a target only moves the visitors that have to move.
+type StickySelector struct{}
+
+func (StickySelector) Select(ctx context.Context, req *SelectionRequest) (*models.Target, error) {
+	if len(req.Targets) == 0 {
+		return nil, errors.New("no eligible targets")
+	}
+
+	var best *models.Target
+	bestScore := math.Inf(-1)
+	for i, target := range req.Targets {
+		weight := req.Weights[i]
+		if weight <= 0 {
+			continue
+		}
+
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s|%d", req.Visitor.IP, target.ID)
+		// Map the hash into (0,1) and weight it: score = -w / ln(u)
+		u := (float64(h.Sum64()>>11) + 0.5) / float64(uint64(1)<<53)
+		score := -float64(weight) / math.Log(u)
+		if score > bestScore {
+			best, bestScore = target, score
+		}
+	}
+
+	if best == nil {
+		return req.Targets[0], nil
+	}
+	return best, nil
+}
+
+// PrioritySelector sends traffic to the eligible targets with the lowest
+// Priority value, splitting ties by weight. Higher values only receive
+// traffic once the preferred targets are capped, out of schedule or
+// otherwise ineligible.
+type PrioritySelector struct{}
+
+func (PrioritySelector) Select(ctx context.Context, req *SelectionRequest) (*models.Target, error) {
+	if len(req.Targets) == 0 {
+		return nil, errors.New("no eligible targets")
+	}
+
+	order := make([]int, len(req.Targets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return req.Targets[order[a]].Priority < req.Targets[order[b]].Priority
+	})
+
+	top := req.Targets[order[0]].Priority
+	var targets []*models.Target
+	var weights []int
+	for _, i := range order {
+		if req.Targets[i].Priority != top {
+			break
+		}
+		targets = append(targets, req.Targets[i])
+		weights = append(weights, req.Weights[i])
+	}
+
+	return selectWeightedRandom(targets, weights), nil
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+func selectionRequest(ip string, targets []*models.Target) *SelectionRequest {
+	weights := make([]int, len(targets))
+	for i, t := range targets {
+		weights[i] = t.Weight
+	}
+	return &SelectionRequest{
+		Link:    &models.Link{LinkID: "abc123"},
+		Visitor: &Visitor{IP: ip},
+		Targets: targets,
+		Weights: weights,
+	}
+}
+
+func TestIsValidSelectionStrategy(t *testing.T) {
+	assert.True(t, IsValidSelectionStrategy(""))
+	for _, strategy := range SelectionStrategies {
+		assert.True(t, IsValidSelectionStrategy(strategy))
+	}
+	assert.False(t, IsValidSelectionStrategy("random"))
+}
+
+func TestRoundRobinSelector(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	selector := NewRoundRobinSelector(client)
+	ctx := context.Background()
+	targets := []*models.Target{{ID: 1, Weight: 1}, {ID: 2, Weight: 1}, {ID: 3, Weight: 1}}
+
+	var got []uint
+	for i := 0; i < 6; i++ {
+		req := selectionRequest("1.1.1.1", targets)
+		target, err := selector.Select(ctx, req)
+		require.NoError(t, err)
+		require.NoError(t, selector.Record(ctx, req.Link, req.Visitor, target))
+		got = append(got, target.ID)
+	}
+	assert.Equal(t, []uint{1, 2, 3, 1, 2, 3}, got)
+
+	// Targets selected but not recorded, e.g. skipped on their cap, do not
+	// move the counter on
+	for i := 0; i < 2; i++ {
+		target, err := selector.Select(ctx, selectionRequest("1.1.1.1", targets))
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), target.ID)
+	}
+}
+
+func TestStickySelector(t *testing.T) {
+	ctx := context.Background()
+	targets := []*models.Target{{ID: 1, Weight: 50}, {ID: 2, Weight: 50}, {ID: 3, Weight: 0}}
+
+	first, err := StickySelector{}.Select(ctx, selectionRequest("10.0.0.1", targets))
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		target, err := StickySelector{}.Select(ctx, selectionRequest("10.0.0.1", targets))
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, target.ID)
+	}
+
+	// Zero-weight targets never win, and different IPs spread out
+	seen := make(map[uint]bool)
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7", "10.0.0.8"} {
+		target, err := StickySelector{}.Select(ctx, selectionRequest(ip, targets))
+		require.NoError(t, err)
+		seen[target.ID] = true
+	}
+	assert.False(t, seen[3])
+	assert.Len(t, seen, 2)
+}
+
+func TestPrioritySelector(t *testing.T) {
+	ctx := context.Background()
+	targets := []*models.Target{
+		{ID: 1, Weight: 100, Priority: 2},
+		{ID: 2, Weight: 100, Priority: 1},
+		{ID: 3, Weight: 100, Priority: 3},
+	}
+
+	for i := 0; i < 10; i++ {
+		target, err := PrioritySelector{}.Select(ctx, selectionRequest("1.1.1.1", targets))
+		require.NoError(t, err)
+		assert.Equal(t, uint(2), target.ID)
+	}
+
+	// Failover once the preferred target is no longer eligible
+	target, err := PrioritySelector{}.Select(ctx, selectionRequest("1.1.1.1", []*models.Target{targets[0], targets[2]}))
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), target.ID)
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"time"
+
+	"github.com/raoxb/smart_redirect/pkg/geoip"
+	"github.com/raoxb/smart_redirect/pkg/useragent"
+)
+
+// Visitor describes the request a target is being selected for.
+type Visitor struct {
+	IP       string
+	Location *geoip.Location
+	Agent    useragent.Info
+	// Languages are the Accept-Language tags in order of preference.
+	Languages []string
+	// Time is when the visit happened; zero means now.
+	Time time.Time
+	// ClickID identifies the visit in AccessLog and conversion postbacks.
+	ClickID string
+	// Bot is the visitor's bot classification.
+	Bot BotVerdict
+}
+
+// CountryCode returns the visitor's country, or "" when unknown.
+func (v *Visitor) CountryCode() string {
+	if v.Location == nil {
+		return ""
+	}
+	return v.Location.CountryCode
+}
+
+// TimeZone returns the visitor's IANA timezone, or "" when unknown.
+func (v *Visitor) TimeZone() string {
+	if v.Location == nil {
+		return ""
+	}
+	return v.Location.TimeZone
+}
+
+// Language returns the visitor's preferred language tag, or "" when unknown.
+func (v *Visitor) Language() string {
+	if v == nil || len(v.Languages) == 0 {
+		return ""
+	}
+	return v.Languages[0]
+}
+
+// Click returns the visit's click ID, or "" when there is none.
+func (v *Visitor) Click() string {
+	if v == nil {
+		return ""
+	}
+	return v.ClickID
+}
+
+// VisitTime returns the time of the visit.
+func (v *Visitor) VisitTime() time.Time {
+	if v == nil || v.Time.IsZero() {
+		return time.Now()
+	}
+	return v.Time
+}
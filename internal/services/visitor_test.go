@@ -0,0 +1,23 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/raoxb/smart_redirect/internal/models"
+)
+
+func TestProcessParametersFor_ClickID(t *testing.T) {
+	service := &LinkService{}
+	target := &models.Target{
+		ParamMapping: `{"{click_id}":"sub1"}`,
+		StaticParams: `{"aff_sub":"{click_id}"}`,
+	}
+	visitor := &Visitor{ClickID: "c0ffee"}
+
+	result, err := service.ProcessParametersFor(target, nil, visitor)
+	assert.NoError(t, err)
+	assert.Equal(t, "c0ffee", result["sub1"])
+	assert.Equal(t, "c0ffee", result["aff_sub"])
+}
@@ -0,0 +1,2 @@
+-- Dayparting schedules for targets
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS schedule TEXT;
@@ -0,0 +1,11 @@
+-- Device, OS and browser targeting
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS device_types TEXT;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS operating_systems TEXT;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS browsers TEXT;
+
+ALTER TABLE access_logs ADD COLUMN IF NOT EXISTS device_type VARCHAR(20);
+ALTER TABLE access_logs ADD COLUMN IF NOT EXISTS os VARCHAR(20);
+ALTER TABLE access_logs ADD COLUMN IF NOT EXISTS browser VARCHAR(20);
+
+CREATE INDEX IF NOT EXISTS idx_access_logs_device_type ON access_logs(device_type);
+CREATE INDEX IF NOT EXISTS idx_access_logs_os ON access_logs(os);
@@ -0,0 +1,2 @@
+-- Accept-Language targeting
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS languages TEXT;
@@ -0,0 +1,5 @@
+-- Region and city targeting
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS regions TEXT;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS excluded_regions TEXT;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS cities TEXT;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS excluded_cities TEXT;
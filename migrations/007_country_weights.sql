@@ -0,0 +1,2 @@
+-- Per-country weight overrides for targets
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS country_weights TEXT;
@@ -0,0 +1,4 @@
+-- Per-link target selection strategy and target priorities
+ALTER TABLE links ADD COLUMN IF NOT EXISTS selection_strategy VARCHAR(20);
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS selection_strategy VARCHAR(20);
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS priority INTEGER DEFAULT 0;
@@ -0,0 +1,24 @@
+-- Click IDs on access logs and conversions reported by postbacks
+ALTER TABLE access_logs ADD COLUMN IF NOT EXISTS click_id VARCHAR(36);
+CREATE INDEX IF NOT EXISTS idx_access_logs_click_id ON access_logs(click_id);
+
+CREATE TABLE IF NOT EXISTS conversions (
+    id SERIAL PRIMARY KEY,
+    click_id VARCHAR(36) NOT NULL,
+    transaction_id VARCHAR(100) NOT NULL DEFAULT '',
+    access_log_id INTEGER REFERENCES access_logs(id) ON DELETE SET NULL,
+    link_id INTEGER REFERENCES links(id) ON DELETE CASCADE,
+    target_id INTEGER REFERENCES targets(id) ON DELETE SET NULL,
+    payout DECIMAL(12,4) DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'approved',
+    ip VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversion_click_txn ON conversions(click_id, transaction_id);
+CREATE INDEX IF NOT EXISTS idx_conversions_access_log_id ON conversions(access_log_id);
+CREATE INDEX IF NOT EXISTS idx_conversions_link_id ON conversions(link_id);
+CREATE INDEX IF NOT EXISTS idx_conversions_target_id ON conversions(target_id);
+CREATE INDEX IF NOT EXISTS idx_conversions_status ON conversions(status);
+CREATE INDEX IF NOT EXISTS idx_conversions_created_at ON conversions(created_at);
@@ -0,0 +1,2 @@
+-- Ordered parameter transformation pipeline for targets
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS transforms TEXT;
@@ -0,0 +1,4 @@
+-- Passthrough and merge policies for incoming query parameters
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS passthrough_mode VARCHAR(20);
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS passthrough_params TEXT;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS merge_policy VARCHAR(20);
@@ -0,0 +1,9 @@
+-- Per-link overrides of the per-IP rate limit
+ALTER TABLE links ADD COLUMN IF NOT EXISTS rate_limit INTEGER DEFAULT 0;
+ALTER TABLE links ADD COLUMN IF NOT EXISTS rate_limit_window INTEGER DEFAULT 0;
+ALTER TABLE links ADD COLUMN IF NOT EXISTS rate_limit_action VARCHAR(20);
+ALTER TABLE links ADD COLUMN IF NOT EXISTS rate_limit_target_id INTEGER DEFAULT 0;
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS rate_limit INTEGER DEFAULT 0;
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS rate_limit_window INTEGER DEFAULT 0;
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS rate_limit_action VARCHAR(20);
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS rate_limit_target_index INTEGER DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Per-link choice of rate limit algorithm
+ALTER TABLE links ADD COLUMN IF NOT EXISTS rate_limit_algorithm VARCHAR(20);
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS rate_limit_algorithm VARCHAR(20);
@@ -0,0 +1,7 @@
+-- Cap periods and reset timezones for link and target caps
+ALTER TABLE links ADD COLUMN IF NOT EXISTS cap_period VARCHAR(20);
+ALTER TABLE links ADD COLUMN IF NOT EXISTS cap_timezone VARCHAR(50);
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS cap_period VARCHAR(20);
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS cap_timezone VARCHAR(50);
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS cap_period VARCHAR(20);
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS cap_timezone VARCHAR(50);
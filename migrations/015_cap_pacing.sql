@@ -0,0 +1,7 @@
+-- Pacing of periodic link and target caps
+ALTER TABLE links ADD COLUMN IF NOT EXISTS cap_pacing VARCHAR(20);
+ALTER TABLE links ADD COLUMN IF NOT EXISTS cap_pacing_curve TEXT;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS cap_pacing VARCHAR(20);
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS cap_pacing_curve TEXT;
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS cap_pacing VARCHAR(20);
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS cap_pacing_curve TEXT;
@@ -0,0 +1,5 @@
+-- Ordered fallback chains on links and the reason of each fallback hit
+ALTER TABLE links ADD COLUMN IF NOT EXISTS fallbacks TEXT;
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS fallbacks TEXT;
+ALTER TABLE access_logs ADD COLUMN IF NOT EXISTS fallback_reason VARCHAR(20);
+CREATE INDEX IF NOT EXISTS idx_access_logs_fallback_reason ON access_logs(fallback_reason);
@@ -0,0 +1,11 @@
+-- Flight dates of links and targets and what expired links do
+ALTER TABLE links ADD COLUMN IF NOT EXISTS starts_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE links ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE links ADD COLUMN IF NOT EXISTS expiry_action VARCHAR(20);
+ALTER TABLE links ADD COLUMN IF NOT EXISTS expiry_url TEXT;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS starts_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE targets ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_links_starts_at ON links(starts_at);
+CREATE INDEX IF NOT EXISTS idx_links_expires_at ON links(expires_at);
+CREATE INDEX IF NOT EXISTS idx_targets_starts_at ON targets(starts_at);
+CREATE INDEX IF NOT EXISTS idx_targets_expires_at ON targets(expires_at);
@@ -0,0 +1,2 @@
+-- Room for custom link IDs
+ALTER TABLE links ALTER COLUMN link_id TYPE VARCHAR(32);
@@ -0,0 +1,4 @@
+-- Open Graph previews served to link preview crawlers
+ALTER TABLE links ADD COLUMN IF NOT EXISTS preview_title VARCHAR(200);
+ALTER TABLE links ADD COLUMN IF NOT EXISTS preview_description VARCHAR(500);
+ALTER TABLE links ADD COLUMN IF NOT EXISTS preview_image TEXT;
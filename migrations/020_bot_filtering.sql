@@ -0,0 +1,6 @@
+-- Bot actions of links and bot verdicts of access logs
+ALTER TABLE links ADD COLUMN IF NOT EXISTS bot_action VARCHAR(20);
+ALTER TABLE link_templates ADD COLUMN IF NOT EXISTS bot_action VARCHAR(20);
+ALTER TABLE access_logs ADD COLUMN IF NOT EXISTS bot_verdict VARCHAR(20);
+ALTER TABLE access_logs ADD COLUMN IF NOT EXISTS bot_reason VARCHAR(20);
+CREATE INDEX IF NOT EXISTS idx_access_logs_bot_verdict ON access_logs(bot_verdict);
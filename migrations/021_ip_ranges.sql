@@ -0,0 +1,14 @@
+-- CIDR block and allow lists
+CREATE TABLE IF NOT EXISTS ip_ranges (
+    id SERIAL PRIMARY KEY,
+    cidr VARCHAR(50) NOT NULL,
+    list VARCHAR(10) NOT NULL,
+    source VARCHAR(100),
+    reason TEXT,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ip_ranges_cidr_list ON ip_ranges(cidr, list);
+CREATE INDEX IF NOT EXISTS idx_ip_ranges_source ON ip_ranges(source);
+CREATE INDEX IF NOT EXISTS idx_ip_ranges_expires_at ON ip_ranges(expires_at);
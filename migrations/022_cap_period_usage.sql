@@ -0,0 +1,11 @@
+-- Hits counted in finished periods of link and target caps
+CREATE TABLE IF NOT EXISTS cap_period_usages (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(10) NOT NULL,
+    owner_id INTEGER NOT NULL,
+    cap_period VARCHAR(20) NOT NULL,
+    period VARCHAR(20) NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cap_usage_period ON cap_period_usages(scope, owner_id, cap_period, period);
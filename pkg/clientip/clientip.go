@@ -0,0 +1,140 @@
+// Package clientip finds the address of the client behind trusted reverse
+// proxies. Forwarding headers are only believed when the connection comes
+// from a trusted proxy, and are walked from the nearest hop back until an
+// untrusted address is found, so clients cannot spoof their address by
+// sending the headers themselves.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/raoxb/smart_redirect/pkg/iprange"
+)
+
+// Forwarding headers with a known format. Other headers are read as a
+// comma separated list of addresses, like X-Forwarded-For.
+const (
+	HeaderForwarded     = "Forwarded" // RFC 7239
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-Ip"
+)
+
+// Resolver resolves client addresses.
+type Resolver struct {
+	trusted iprange.Table[struct{}]
+	headers []string
+}
+
+// New creates a resolver trusting the given CIDRs or addresses and reading
+// the headers in the given order of priority: the first header present
+// with valid addresses is used.
+func New(trustedProxies []string, headers []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, proxy := range trustedProxies {
+		prefix, err := iprange.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy: %w", err)
+		}
+		r.trusted.Insert(prefix, struct{}{})
+	}
+	for _, header := range headers {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			return nil, fmt.Errorf("empty client IP header name")
+		}
+		r.headers = append(r.headers, http.CanonicalHeaderKey(header))
+	}
+	return r, nil
+}
+
+// IsTrusted reports whether addr is a trusted proxy.
+func (r *Resolver) IsTrusted(addr netip.Addr) bool {
+	return r.trusted.Contains(addr.Unmap())
+}
+
+// FromTrustedProxy reports whether req was received from a trusted proxy,
+// so that its forwarding headers can be believed.
+func (r *Resolver) FromTrustedProxy(req *http.Request) bool {
+	peer, ok := parseHost(req.RemoteAddr)
+	return ok && r.IsTrusted(peer)
+}
+
+// ClientIP returns the address of the client that made the request.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	peer, ok := parseHost(req.RemoteAddr)
+	if !ok {
+		return req.RemoteAddr
+	}
+	if !r.IsTrusted(peer) {
+		return peer.String()
+	}
+
+	for _, header := range r.headers {
+		values := req.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+		var hops []netip.Addr
+		if header == HeaderForwarded {
+			hops, ok = parseForwarded(values)
+		} else {
+			hops, ok = parseAddrList(values)
+		}
+		if !ok || len(hops) == 0 {
+			continue
+		}
+		return r.walk(peer, hops).String()
+	}
+	return peer.String()
+}
+
+// walk follows the hops back from the peer while they are trusted proxies
+// and returns the first untrusted one, or the farthest hop when all are.
+func (r *Resolver) walk(peer netip.Addr, hops []netip.Addr) netip.Addr {
+	addr := peer
+	for i := len(hops) - 1; i >= 0 && r.IsTrusted(addr); i-- {
+		addr = hops[i]
+	}
+	return addr
+}
+
+// parseAddrList reads comma separated addresses. It fails on any invalid
+// entry as the chain cannot be followed past it.
+func parseAddrList(values []string) ([]netip.Addr, bool) {
+	var hops []netip.Addr
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			addr, ok := parseHost(strings.TrimSpace(entry))
+			if !ok {
+				return nil, false
+			}
+			hops = append(hops, addr)
+		}
+	}
+	return hops, true
+}
+
+// parseHost parses an address with or without a port, and IPv6 addresses
+// with or without brackets.
+func parseHost(s string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return normalize(addr), true
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return normalize(addr), true
+}
+
+func normalize(addr netip.Addr) netip.Addr {
+	return addr.Unmap().WithZone("")
+}
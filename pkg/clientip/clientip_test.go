@@ -0,0 +1,190 @@
+package clientip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver_ClientIP(t *testing.T) {
+	resolver, err := New(
+		[]string{"10.0.0.0/8", "2001:db8::/32"},
+		[]string{"Forwarded", "X-Forwarded-For", "X-Real-IP"},
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		remote string
+		header http.Header
+		want   string
+	}{
+		{
+			name:   "untrusted peer headers are ignored",
+			remote: "198.51.100.7:4321",
+			header: http.Header{"X-Forwarded-For": {"1.2.3.4"}, "X-Real-Ip": {"1.2.3.4"}},
+			want:   "198.51.100.7",
+		},
+		{
+			name:   "trusted peer without headers",
+			remote: "10.0.0.2:4321",
+			want:   "10.0.0.2",
+		},
+		{
+			name:   "spoofed entries left of the client are skipped",
+			remote: "10.0.0.2:4321",
+			header: http.Header{"X-Forwarded-For": {"1.2.3.4, 203.0.113.9, 10.0.0.5"}},
+			want:   "203.0.113.9",
+		},
+		{
+			name:   "repeated headers are joined",
+			remote: "10.0.0.2:4321",
+			header: http.Header{"X-Forwarded-For": {"1.2.3.4", "203.0.113.9"}},
+			want:   "203.0.113.9",
+		},
+		{
+			name:   "all hops trusted",
+			remote: "10.0.0.2:4321",
+			header: http.Header{"X-Forwarded-For": {"10.1.1.1, 10.0.0.5"}},
+			want:   "10.1.1.1",
+		},
+		{
+			name:   "Forwarded comes first",
+			remote: "10.0.0.2:4321",
+			header: http.Header{
+				"Forwarded":       {`for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"`},
+				"X-Forwarded-For": {"203.0.113.9"},
+			},
+			want: "192.0.2.60",
+		},
+		{
+			name:   "unknown Forwarded node falls back to the next header",
+			remote: "10.0.0.2:4321",
+			header: http.Header{
+				"Forwarded":       {"for=unknown"},
+				"X-Forwarded-For": {"203.0.113.9"},
+			},
+			want: "203.0.113.9",
+		},
+		{
+			name:   "invalid X-Forwarded-For falls back to X-Real-IP",
+			remote: "10.0.0.2:4321",
+			header: http.Header{"X-Forwarded-For": {"garbage"}, "X-Real-Ip": {"203.0.113.9"}},
+			want:   "203.0.113.9",
+		},
+		{
+			name:   "IPv6 peer and entry with port",
+			remote: "[2001:db8::1]:443",
+			header: http.Header{"X-Forwarded-For": {"[2001:db8:1::5]:1234, 198.51.100.7:5678"}},
+			want:   "198.51.100.7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{RemoteAddr: tt.remote, Header: tt.header}
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			assert.Equal(t, tt.want, resolver.ClientIP(req))
+		})
+	}
+}
+
+func TestResolver_FromTrustedProxy(t *testing.T) {
+	resolver, err := New([]string{"10.0.0.0/8"}, nil)
+	require.NoError(t, err)
+
+	assert.True(t, resolver.FromTrustedProxy(&http.Request{RemoteAddr: "10.0.0.2:4321"}))
+	assert.True(t, resolver.FromTrustedProxy(&http.Request{RemoteAddr: "[::ffff:10.0.0.2]:4321"}))
+	assert.False(t, resolver.FromTrustedProxy(&http.Request{RemoteAddr: "198.51.100.7:4321"}))
+	assert.False(t, resolver.FromTrustedProxy(&http.Request{RemoteAddr: "pipe"}))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New([]string{"10.0.0.0/33"}, nil)
+	assert.Error(t, err)
+
+	_, err = New(nil, []string{" "})
+	assert.Error(t, err)
+}
+
+func TestProxyListener(t *testing.T) {
+	resolver, err := New([]string{"127.0.0.1"}, nil)
+	require.NoError(t, err)
+
+	v2 := append([]byte{}, proxyV2Signature...)
+	v2 = append(v2, 0x21, 0x11, 0, 12)
+	v2 = append(v2, 192, 0, 2, 10, 198, 51, 100, 1)
+	v2 = binary.BigEndian.AppendUint16(v2, 56324)
+	v2 = binary.BigEndian.AppendUint16(v2, 443)
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"v1", []byte("PROXY TCP4 192.0.2.10 198.51.100.1 56324 443\r\n"), "192.0.2.10:56324"},
+		{"v1 IPv6", []byte("PROXY TCP6 2001:db8::10 2001:db8::1 56324 443\r\n"), "[2001:db8::10]:56324"},
+		{"v2", v2, "192.0.2.10:56324"},
+		{"no header", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer l.Close()
+			proxied := resolver.ProxyListener(l)
+
+			client, err := net.Dial("tcp", l.Addr().String())
+			require.NoError(t, err)
+			defer client.Close()
+			_, err = client.Write(append(tt.header, "GET / HTTP/1.1\r\n\r\n"...))
+			require.NoError(t, err)
+
+			conn, err := proxied.Accept()
+			require.NoError(t, err)
+			defer conn.Close()
+
+			want := tt.want
+			if want == "" {
+				want = client.LocalAddr().String()
+			}
+			assert.Equal(t, want, conn.RemoteAddr().String())
+
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			require.NoError(t, err)
+			assert.Equal(t, "GET / HTTP/1.1\r\n", line)
+		})
+	}
+
+	t.Run("untrusted peer", func(t *testing.T) {
+		resolver, err := New(nil, nil)
+		require.NoError(t, err)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+
+		client, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer client.Close()
+		_, err = client.Write([]byte("PROXY TCP4 192.0.2.10 198.51.100.1 56324 443\r\n"))
+		require.NoError(t, err)
+
+		conn, err := resolver.ProxyListener(l).Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		addr, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1", addr.Addr().String())
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "PROXY TCP4 192.0.2.10 198.51.100.1 56324 443\r\n", line)
+	})
+}
@@ -0,0 +1,63 @@
+package clientip
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// parseForwarded reads the "for" parameters of RFC 7239 Forwarded headers,
+// one per forwarded element. It fails on elements without one or with an
+// obfuscated or "unknown" node, as the chain cannot be followed past them.
+func parseForwarded(values []string) ([]netip.Addr, bool) {
+	var hops []netip.Addr
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			if strings.TrimSpace(element) == "" {
+				continue
+			}
+			addr, ok := forwardedFor(element)
+			if !ok {
+				return nil, false
+			}
+			hops = append(hops, addr)
+		}
+	}
+	return hops, true
+}
+
+// forwardedFor returns the address of the "for" pair of an element.
+func forwardedFor(element string) (netip.Addr, bool) {
+	for _, pair := range splitQuoted(element, ';') {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(name), "for") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+		}
+		return parseHost(value)
+	}
+	return netip.Addr{}, false
+}
+
+// splitQuoted splits s on sep outside of quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\' && quoted:
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,176 @@
+package clientip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyV1MaxLength is the longest v1 header, CRLF included.
+const proxyV1MaxLength = 107
+
+// proxyHeaderTimeout bounds the wait for a PROXY protocol header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// ProxyListener wraps a listener to accept the PROXY protocol, versions 1
+// and 2, from trusted proxies: the connection's RemoteAddr becomes the
+// client address the proxy sent. Connections from other peers, and those
+// from trusted peers that send no header, are served as they are.
+func (r *Resolver) ProxyListener(l net.Listener) net.Listener {
+	return &proxyListener{Listener: l, resolver: r}
+}
+
+type proxyListener struct {
+	net.Listener
+	resolver *Resolver
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, resolver: l.resolver}, nil
+}
+
+// proxyConn reads the header lazily, on the first Read or RemoteAddr, so
+// that a slow client does not hold up Accept.
+type proxyConn struct {
+	net.Conn
+	resolver *Resolver
+
+	once   sync.Once
+	reader *bufio.Reader
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	return c.remote
+}
+
+func (c *proxyConn) readHeader() {
+	c.reader = bufio.NewReader(c.Conn)
+	c.remote = c.Conn.RemoteAddr()
+
+	peer, ok := parseHost(c.remote.String())
+	if !ok || !c.resolver.IsTrusted(peer) {
+		return
+	}
+
+	_ = c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	var source net.Addr
+	var err error
+	if prefix, _ := c.reader.Peek(len(proxyV2Signature)); bytes.Equal(prefix, proxyV2Signature) {
+		source, err = readProxyV2(c.reader)
+	} else if bytes.HasPrefix(prefix, proxyV1Prefix) {
+		source, err = readProxyV1(c.reader)
+	}
+	if err != nil {
+		c.err = fmt.Errorf("proxy protocol: %w", err)
+		return
+	}
+	if source != nil {
+		c.remote = source
+	}
+}
+
+// readProxyV1 reads a text header such as
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("invalid v1 header")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("invalid v1 header")
+	}
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, errors.New("invalid v1 source address")
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, errors.New("invalid v1 source port")
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(port))), nil
+}
+
+// readProxyV2 reads a binary header. LOCAL commands and address families
+// other than TCP over IPv4 or IPv6 keep the peer address.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, errors.New("unsupported v2 version")
+	}
+	command, family := header[12]&0x0f, header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if command == 0x0 {
+		return nil, nil
+	}
+	if command != 0x1 {
+		return nil, errors.New("unsupported v2 command")
+	}
+
+	var size int
+	switch family {
+	case 0x11: // TCP over IPv4
+		size = 4
+	case 0x21: // TCP over IPv6
+		size = 16
+	default:
+		return nil, nil
+	}
+	if len(payload) < 2*size+4 {
+		return nil, errors.New("short v2 address block")
+	}
+	addr, _ := netip.AddrFromSlice(payload[:size])
+	port := binary.BigEndian.Uint16(payload[2*size:])
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr.Unmap(), port)), nil
+}
@@ -0,0 +1,165 @@
+// Package iprange looks up IPv4 and IPv6 addresses in sets of CIDR
+// prefixes with a binary trie, so a lookup costs at most one step per bit
+// of the address whatever the number of prefixes.
+package iprange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// Table maps prefixes to values and finds the longest prefix containing an
+// address. The zero value is an empty table. A Table is not safe for
+// concurrent writes; build it, then share it read-only.
+type Table[V any] struct {
+	v4, v6 *node[V]
+	size   int
+}
+
+type node[V any] struct {
+	child [2]*node[V]
+	value V
+	set   bool
+}
+
+// Insert adds the prefix, replacing the value of an equal prefix.
+// IPv4-mapped IPv6 prefixes are stored as IPv4.
+func (t *Table[V]) Insert(prefix netip.Prefix, value V) {
+	prefix = normalize(prefix)
+	root := &t.v6
+	if prefix.Addr().Is4() {
+		root = &t.v4
+	}
+	if *root == nil {
+		*root = &node[V]{}
+	}
+
+	n := *root
+	addr := prefix.Addr().AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		b := bit(addr, i)
+		if n.child[b] == nil {
+			n.child[b] = &node[V]{}
+		}
+		n = n.child[b]
+	}
+	if !n.set {
+		t.size++
+	}
+	n.value = value
+	n.set = true
+}
+
+// Lookup returns the value of the longest prefix containing addr.
+func (t *Table[V]) Lookup(addr netip.Addr) (V, bool) {
+	var value V
+	found := false
+
+	addr = addr.Unmap()
+	n := t.v6
+	if addr.Is4() {
+		n = t.v4
+	}
+	raw := addr.AsSlice()
+	for i := 0; n != nil; i++ {
+		if n.set {
+			value, found = n.value, true
+		}
+		if i == len(raw)*8 {
+			break
+		}
+		n = n.child[bit(raw, i)]
+	}
+	return value, found
+}
+
+// Contains reports whether addr is in any prefix of the table.
+func (t *Table[V]) Contains(addr netip.Addr) bool {
+	_, found := t.Lookup(addr)
+	return found
+}
+
+// Len returns the number of prefixes in the table.
+func (t *Table[V]) Len() int {
+	return t.size
+}
+
+func bit(addr []byte, i int) int {
+	return int(addr[i/8]>>(7-i%8)) & 1
+}
+
+func normalize(prefix netip.Prefix) netip.Prefix {
+	addr := prefix.Addr()
+	bits := prefix.Bits()
+	if addr.Is4In6() {
+		addr = addr.Unmap()
+		bits -= 96
+		if bits < 0 {
+			bits = 0
+		}
+	}
+	return netip.PrefixFrom(addr, bits).Masked()
+}
+
+// ParsePrefix parses a CIDR prefix or a single address, which is taken as
+// a full-length prefix.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", s)
+		}
+		return normalize(prefix), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address %q", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ReadPrefixes reads one prefix or address per line. Blank lines and
+// everything after a '#' are ignored.
+func ReadPrefixes(r io.Reader) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		prefix, err := ParsePrefix(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return prefixes, nil
+}
+
+// LoadFile reads the prefixes of a file in the ReadPrefixes format.
+func LoadFile(path string) ([]netip.Prefix, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	prefixes, err := ReadPrefixes(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return prefixes, nil
+}
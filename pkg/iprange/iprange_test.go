@@ -0,0 +1,87 @@
+package iprange
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTable_Lookup(t *testing.T) {
+	var table Table[string]
+	for prefix, label := range map[string]string{
+		"10.0.0.0/8":         "wide",
+		"10.1.0.0/16":        "narrow",
+		"192.0.2.7":          "single",
+		"2001:db8::/32":      "v6",
+		"::ffff:8.8.8.0/120": "mapped",
+	} {
+		p, err := ParsePrefix(prefix)
+		require.NoError(t, err)
+		table.Insert(p, label)
+	}
+	assert.Equal(t, 5, table.Len())
+
+	tests := []struct {
+		ip    string
+		label string
+		found bool
+	}{
+		{"10.200.0.1", "wide", true},
+		{"10.1.2.3", "narrow", true},
+		{"192.0.2.7", "single", true},
+		{"192.0.2.8", "", false},
+		{"2001:db8:1::1", "v6", true},
+		{"2001:db9::1", "", false},
+		{"8.8.8.8", "mapped", true},
+		{"::ffff:10.1.0.1", "narrow", true},
+		{"11.0.0.1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			label, found := table.Lookup(netip.MustParseAddr(tt.ip))
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.label, label)
+		})
+	}
+}
+
+func TestTable_InsertReplaces(t *testing.T) {
+	var table Table[int]
+	table.Insert(netip.MustParsePrefix("10.0.0.0/8"), 1)
+	table.Insert(netip.MustParsePrefix("10.1.2.3/8"), 2)
+
+	value, found := table.Lookup(netip.MustParseAddr("10.9.9.9"))
+	assert.True(t, found)
+	assert.Equal(t, 2, value)
+	assert.Equal(t, 1, table.Len())
+}
+
+func TestTable_DefaultRoute(t *testing.T) {
+	var table Table[bool]
+	table.Insert(netip.MustParsePrefix("0.0.0.0/0"), true)
+
+	assert.True(t, table.Contains(netip.MustParseAddr("203.0.113.1")))
+	assert.False(t, table.Contains(netip.MustParseAddr("2001:db8::1")))
+}
+
+func TestReadPrefixes(t *testing.T) {
+	prefixes, err := ReadPrefixes(strings.NewReader(`
+# cloud ranges
+3.0.0.0/9
+2600:1f00::/24   # aws v6
+
+198.51.100.1
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("3.0.0.0/9"),
+		netip.MustParsePrefix("2600:1f00::/24"),
+		netip.MustParsePrefix("198.51.100.1/32"),
+	}, prefixes)
+
+	_, err = ReadPrefixes(strings.NewReader("10.0.0.0/8\nnot-an-ip\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
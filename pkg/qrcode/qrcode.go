@@ -0,0 +1,175 @@
+// Package qrcode renders QR codes as PNG or SVG with a configurable size,
+// error correction level, margin and colours.
+package qrcode
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	qr "github.com/skip2/go-qrcode"
+)
+
+// Error correction levels, from the least to the most robust.
+const (
+	LevelLow      = "L" // about 7% of the code can be restored
+	LevelMedium   = "M" // about 15%
+	LevelQuartile = "Q" // about 25%
+	LevelHigh     = "H" // about 30%
+)
+
+var levels = map[string]qr.RecoveryLevel{
+	LevelLow:      qr.Low,
+	LevelMedium:   qr.Medium,
+	LevelQuartile: qr.High,
+	LevelHigh:     qr.Highest,
+}
+
+// Limits of the options.
+const (
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+// Options controls how a code is rendered.
+type Options struct {
+	// Size is the width and height in pixels.
+	Size int
+	// Level is one of the Level* constants.
+	Level string
+	// Margin is the quiet zone around the code, in modules. Scanners
+	// expect at least 4.
+	Margin     int
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+// DefaultOptions returns a 256 pixel black on white code with medium error
+// correction and the standard margin.
+func DefaultOptions() Options {
+	return Options{
+		Size:       256,
+		Level:      LevelMedium,
+		Margin:     4,
+		Foreground: color.RGBA{A: 255},
+		Background: color.RGBA{R: 255, G: 255, B: 255, A: 255},
+	}
+}
+
+// Validate checks the options.
+func (o Options) Validate() error {
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("size must be between %d and %d", MinSize, MaxSize)
+	}
+	if _, ok := levels[o.Level]; !ok {
+		return fmt.Errorf("unknown error correction level %q", o.Level)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("margin must be between 0 and %d", MaxMargin)
+	}
+	return nil
+}
+
+// ParseColor parses a hex colour as "rrggbb" or "rrggbbaa", with or
+// without a leading '#'.
+func ParseColor(s string) (color.RGBA, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || (len(raw) != 3 && len(raw) != 4) {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+	c := color.RGBA{R: raw[0], G: raw[1], B: raw[2], A: 255}
+	if len(raw) == 4 {
+		c.A = raw[3]
+	}
+	return c, nil
+}
+
+// modules encodes the content and returns its modules, margin included.
+func modules(content string, o Options) ([][]bool, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	code, err := qr.New(content, levels[o.Level])
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	n := len(bitmap) + 2*o.Margin
+	result := make([][]bool, n)
+	for y := range result {
+		result[y] = make([]bool, n)
+	}
+	for y, row := range bitmap {
+		copy(result[y+o.Margin][o.Margin:], row)
+	}
+	return result, nil
+}
+
+// PNG renders the content as a PNG image of Size by Size pixels.
+func PNG(content string, o Options) ([]byte, error) {
+	grid, err := modules(content, o)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(grid)
+	img := image.NewPaletted(image.Rect(0, 0, o.Size, o.Size), color.Palette{o.Background, o.Foreground})
+	for y := 0; y < o.Size; y++ {
+		row := grid[y*n/o.Size]
+		for x := 0; x < o.Size; x++ {
+			if row[x*n/o.Size] {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the content as an SVG document of Size by Size pixels, with
+// one unit per module so that it scales without blurring.
+func SVG(content string, o Options) ([]byte, error) {
+	grid, err := modules(content, o)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(grid)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, o.Size, o.Size, n, n)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" %s/>`, n, n, svgFill(o.Background))
+	fmt.Fprintf(&buf, `<path %s d="`, svgFill(o.Foreground))
+	for y, row := range grid {
+		for x := 0; x < n; x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < n && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes(), nil
+}
+
+func svgFill(c color.RGBA) string {
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A < 255 {
+		fill += fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/255)
+	}
+	return fill
+}
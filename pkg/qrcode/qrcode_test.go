@@ -0,0 +1,88 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPNG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Size = 300
+	opts.Foreground = color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+
+	data, err := PNG("https://go.example.com/v1/bu01/abc123?network=mi", opts)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	assert.Equal(t, 300, img.Bounds().Dy())
+
+	// The margin is background, the finder pattern after it foreground
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, [3]uint32{0xffff, 0xffff, 0xffff}, [3]uint32{r, g, b})
+	found := false
+	for x := 0; x < 150 && !found; x++ {
+		r, g, b, _ := img.At(x, x).RGBA()
+		found = r>>8 == 0x11 && g>>8 == 0x22 && b>>8 == 0x33
+	}
+	assert.True(t, found, "foreground colour not drawn")
+}
+
+func TestSVG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Background = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x80}
+
+	data, err := SVG("https://go.example.com/v1/bu01/abc123?network=mi", opts)
+	require.NoError(t, err)
+
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, "<?xml") || strings.HasPrefix(svg, "<svg"))
+	assert.Contains(t, svg, `viewBox="0 0 `)
+	assert.Contains(t, svg, `width="256"`)
+	assert.Contains(t, svg, `fill-opacity`)
+	assert.Contains(t, svg, "<path")
+}
+
+func TestOptionsValidate(t *testing.T) {
+	assert.NoError(t, DefaultOptions().Validate())
+
+	tests := []struct {
+		name   string
+		modify func(o *Options)
+	}{
+		{"too small", func(o *Options) { o.Size = MinSize - 1 }},
+		{"too large", func(o *Options) { o.Size = MaxSize + 1 }},
+		{"unknown level", func(o *Options) { o.Level = "X" }},
+		{"negative margin", func(o *Options) { o.Margin = -1 }},
+		{"margin too large", func(o *Options) { o.Margin = MaxMargin + 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(&opts)
+			assert.Error(t, opts.Validate())
+		})
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	c, err := ParseColor("#ff8000")
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0xff, G: 0x80, B: 0x00, A: 0xff}, c)
+
+	c, err = ParseColor("00000080")
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{A: 0x80}, c)
+
+	for _, bad := range []string{"", "fff", "#gg0000", "ff00ff0"} {
+		_, err := ParseColor(bad)
+		assert.Error(t, err, bad)
+	}
+}
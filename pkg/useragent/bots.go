@@ -0,0 +1,84 @@
+package useragent
+
+import "strings"
+
+// previewBots are tokens of the crawlers messaging apps and social networks
+// send to build link previews, in lower case.
+var previewBots = []string{
+	"facebookexternalhit",
+	"facebot",
+	"whatsapp",
+	"telegrambot",
+	"twitterbot",
+	"slackbot-linkexpanding",
+	"slack-imgproxy",
+	"linkedinbot",
+	"discordbot",
+	"skypeuripreview",
+	"pinterestbot",
+	"redditbot",
+	"applebot",
+	"vkshare",
+	"embedly",
+	"iframely",
+	"bitlybot",
+	"google-pagerenderer",
+	"microsoftpreview",
+	"bingpreview",
+}
+
+// IsPreviewBot reports whether the User-Agent belongs to a link preview
+// crawler, such as those of Facebook, WhatsApp or Telegram.
+func IsPreviewBot(ua string) bool {
+	return containsToken(ua, previewBots)
+}
+
+// knownBots are tokens of crawlers, monitors and HTTP libraries, in lower
+// case. Generic words such as "bot" alone are avoided as they appear in
+// device names.
+var knownBots = []string{
+	"googlebot", "adsbot-google", "mediapartners-google", "bingbot", "yandexbot",
+	"baiduspider", "duckduckbot", "sogou", "exabot", "ahrefsbot", "semrushbot",
+	"mj12bot", "dotbot", "petalbot", "bytespider", "gptbot", "ccbot", "claudebot",
+	"amazonbot", "uptimerobot", "pingdom", "statuscake", "site24x7",
+	"crawler", "spider", "scrapy", "bot/", "bot;", "+http",
+	"curl/", "wget/", "python-requests", "python-urllib", "aiohttp", "httpx",
+	"go-http-client", "java/", "apache-httpclient", "okhttp/", "libwww-perl",
+	"node-fetch", "axios/", "got (", "postmanruntime", "insomnia",
+}
+
+// headlessBrowsers are tokens of automated and headless browsers, in lower
+// case.
+var headlessBrowsers = []string{
+	"headlesschrome",
+	"phantomjs",
+	"slimerjs",
+	"selenium",
+	"webdriver",
+	"puppeteer",
+	"playwright",
+	"electron/",
+	"splash",
+}
+
+// IsBot reports whether the User-Agent belongs to a known crawler, monitor
+// or HTTP library. Preview crawlers are bots too.
+func IsBot(ua string) bool {
+	return IsPreviewBot(ua) || containsToken(ua, knownBots)
+}
+
+// IsHeadless reports whether the User-Agent belongs to a headless or
+// automated browser.
+func IsHeadless(ua string) bool {
+	return containsToken(ua, headlessBrowsers)
+}
+
+func containsToken(ua string, tokens []string) bool {
+	ua = strings.ToLower(ua)
+	for _, token := range tokens {
+		if strings.Contains(ua, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package useragent
+
+import (
+	"strings"
+)
+
+// Device classes
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+)
+
+// Operating systems
+const (
+	OSAndroid  = "android"
+	OSIOS      = "ios"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+)
+
+// Browser families
+const (
+	BrowserChrome    = "chrome"
+	BrowserSafari    = "safari"
+	BrowserFirefox   = "firefox"
+	BrowserEdge      = "edge"
+	BrowserOpera     = "opera"
+	BrowserSamsung   = "samsung"
+	BrowserUC        = "ucbrowser"
+	BrowserYandex    = "yandex"
+	BrowserIE        = "ie"
+	BrowserFacebook  = "facebook"
+	BrowserInstagram = "instagram"
+)
+
+// Unknown is reported for any attribute that cannot be recognised.
+const Unknown = "unknown"
+
+// Info is the parsed form of a User-Agent header.
+type Info struct {
+	DeviceType string `json:"device_type"`
+	OS         string `json:"os"`
+	Browser    string `json:"browser"`
+}
+
+var (
+	deviceTypes = []string{DeviceMobile, DeviceTablet, DeviceDesktop}
+	osNames     = []string{OSAndroid, OSIOS, OSWindows, OSMacOS, OSLinux, OSChromeOS}
+	browsers    = []string{
+		BrowserChrome, BrowserSafari, BrowserFirefox, BrowserEdge, BrowserOpera, BrowserSamsung,
+		BrowserUC, BrowserYandex, BrowserIE, BrowserFacebook, BrowserInstagram,
+	}
+)
+
+// Parse classifies a User-Agent string. It only looks for well known
+// tokens, which is enough for targeting and keeps the lookup cheap.
+func Parse(ua string) Info {
+	if strings.TrimSpace(ua) == "" {
+		return Info{DeviceType: Unknown, OS: Unknown, Browser: Unknown}
+	}
+
+	return Info{
+		DeviceType: parseDevice(ua),
+		OS:         parseOS(ua),
+		Browser:    parseBrowser(ua),
+	}
+}
+
+func parseDevice(ua string) string {
+	switch {
+	case containsAny(ua, "iPad", "Tablet", "Kindle", "Silk/", "PlayBook"):
+		return DeviceTablet
+	case strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile"):
+		return DeviceTablet
+	case containsAny(ua, "Mobi", "iPhone", "iPod", "Windows Phone", "Opera Mini", "BlackBerry", "BB10"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
+
+func parseOS(ua string) string {
+	switch {
+	case strings.Contains(ua, "Android"):
+		return OSAndroid
+	case containsAny(ua, "iPhone", "iPad", "iPod"):
+		// Checked before macOS, iOS agents say "like Mac OS X"
+		return OSIOS
+	case strings.Contains(ua, "Windows"):
+		return OSWindows
+	case containsAny(ua, "Mac OS X", "Macintosh"):
+		return OSMacOS
+	case strings.Contains(ua, "CrOS"):
+		return OSChromeOS
+	case strings.Contains(ua, "Linux"):
+		return OSLinux
+	default:
+		return Unknown
+	}
+}
+
+func parseBrowser(ua string) string {
+	// Order matters: most browsers also claim to be Chrome and/or Safari
+	switch {
+	case containsAny(ua, "FBAN", "FBAV"):
+		return BrowserFacebook
+	case strings.Contains(ua, "Instagram"):
+		return BrowserInstagram
+	case containsAny(ua, "Edg/", "EdgA/", "EdgiOS/", "Edge/"):
+		return BrowserEdge
+	case containsAny(ua, "OPR/", "Opera", "OPiOS/"):
+		return BrowserOpera
+	case strings.Contains(ua, "SamsungBrowser"):
+		return BrowserSamsung
+	case containsAny(ua, "UCBrowser", "UCWEB"):
+		return BrowserUC
+	case strings.Contains(ua, "YaBrowser"):
+		return BrowserYandex
+	case containsAny(ua, "Firefox/", "FxiOS/"):
+		return BrowserFirefox
+	case containsAny(ua, "Chrome/", "CriOS/", "Chromium/"):
+		return BrowserChrome
+	case containsAny(ua, "MSIE ", "Trident/"):
+		return BrowserIE
+	case strings.Contains(ua, "Safari/"):
+		return BrowserSafari
+	default:
+		return Unknown
+	}
+}
+
+// IsDeviceType reports whether name is a supported device class.
+func IsDeviceType(name string) bool {
+	return containsFold(deviceTypes, name)
+}
+
+// IsOS reports whether name is a supported operating system.
+func IsOS(name string) bool {
+	return containsFold(osNames, name)
+}
+
+// IsBrowser reports whether name is a supported browser family.
+func IsBrowser(name string) bool {
+	return containsFold(browsers, name)
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, name string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, name) {
+			return true
+		}
+	}
+	return false
+}
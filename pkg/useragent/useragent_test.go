@@ -0,0 +1,112 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Info
+	}{
+		{
+			name: "Chrome on Android phone",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			want: Info{DeviceType: DeviceMobile, OS: OSAndroid, Browser: BrowserChrome},
+		},
+		{
+			name: "Samsung browser on Android tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 12; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Safari/537.36",
+			want: Info{DeviceType: DeviceTablet, OS: OSAndroid, Browser: BrowserSamsung},
+		},
+		{
+			name: "Safari on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			want: Info{DeviceType: DeviceMobile, OS: OSIOS, Browser: BrowserSafari},
+		},
+		{
+			name: "Chrome on iPad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/119.0.6045.169 Mobile/15E148 Safari/604.1",
+			want: Info{DeviceType: DeviceTablet, OS: OSIOS, Browser: BrowserChrome},
+		},
+		{
+			name: "Edge on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+			want: Info{DeviceType: DeviceDesktop, OS: OSWindows, Browser: BrowserEdge},
+		},
+		{
+			name: "Firefox on macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want: Info{DeviceType: DeviceDesktop, OS: OSMacOS, Browser: BrowserFirefox},
+		},
+		{
+			name: "Facebook in-app browser",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/420.0.0.27.108]",
+			want: Info{DeviceType: DeviceMobile, OS: OSIOS, Browser: BrowserFacebook},
+		},
+		{
+			name: "Empty header",
+			ua:   "",
+			want: Info{DeviceType: Unknown, OS: Unknown, Browser: Unknown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Parse(tt.ua))
+		})
+	}
+}
+
+func TestIsPreviewBot(t *testing.T) {
+	bots := []string{
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+		"WhatsApp/2.23.20.0 A",
+		"TelegramBot (like TwitterBot)",
+		"Twitterbot/1.0",
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+		"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)",
+		"LinkedInBot/1.0 (compatible; Mozilla/5.0; Apache-HttpClient +http://www.linkedin.com)",
+	}
+	for _, ua := range bots {
+		assert.True(t, IsPreviewBot(ua), ua)
+	}
+
+	humans := []string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/420.0.0.27.108]",
+		"",
+	}
+	for _, ua := range humans {
+		assert.False(t, IsPreviewBot(ua), ua)
+	}
+}
+
+func TestIsBot(t *testing.T) {
+	tests := []struct {
+		ua       string
+		bot      bool
+		headless bool
+	}{
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", true, false},
+		{"Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)", true, false},
+		{"curl/8.4.0", true, false},
+		{"python-requests/2.31.0", true, false},
+		{"Go-http-client/1.1", true, false},
+		{"facebookexternalhit/1.1", true, false},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36", false, true},
+		{"Mozilla/5.0 (Unknown; Linux x86_64) AppleWebKit/538.1 (KHTML, like Gecko) PhantomJS/2.1.1 Safari/538.1", false, true},
+		// Cubot is a phone brand, not a bot
+		{"Mozilla/5.0 (Linux; Android 11; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", false, false},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ua, func(t *testing.T) {
+			assert.Equal(t, tt.bot, IsBot(tt.ua))
+			assert.Equal(t, tt.headless, IsHeadless(tt.ua))
+		})
+	}
+}
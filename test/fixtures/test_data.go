@@ -73,10 +73,11 @@ func CreateTestTargets() []models.Target {
 }
 
 func CreateTestAccessLog() *models.AccessLog {
+	targetID := uint(1)
 	return &models.AccessLog{
 		ID:        1,
 		LinkID:    1,
-		TargetID:  1,
+		TargetID:  &targetID,
 		IP:        "192.168.1.1",
 		UserAgent: "Mozilla/5.0 Test Browser",
 		Referer:   "https://google.com",
@@ -11,7 +11,11 @@ import (
 	"github.com/stretchr/testify/require"
 	
 	"github.com/raoxb/smart_redirect/internal/api"
+	"github.com/raoxb/smart_redirect/internal/config"
 	"github.com/raoxb/smart_redirect/internal/middleware"
+	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/pkg/clientip"
+	"github.com/raoxb/smart_redirect/pkg/geoip"
 	"github.com/raoxb/smart_redirect/test/testutil"
 )
 
@@ -23,9 +27,15 @@ func TestRedirectHandler_Integration(t *testing.T) {
 	ts.SeedTestData(t)
 	
 	// Setup routes
-	redirectHandler := api.NewRedirectHandler(ts.DB, ts.Redis)
+	botFilter, err := services.NewBotFilter(config.DefaultBotFilter())
+	require.NoError(t, err)
+	// Requests from httptest come from 192.0.2.1
+	clientIPs, err := clientip.New([]string{"192.0.2.0/24"}, config.DefaultClientIP().Headers)
+	require.NoError(t, err)
+	ipRanges := services.NewIPRangeService(ts.DB, ts.Redis)
+	redirectHandler := api.NewRedirectHandler(ts.DB, ts.Redis, config.DefaultRateLimits(), botFilter, ipRanges, clientIPs, geoip.NewIPAPIProvider(1000))
 	ts.Router.GET("/v1/:bu/:link_id", 
-		middleware.RateLimitMiddleware(ts.Redis, 10, time.Hour),
+		middleware.RateLimitMiddleware(ts.Redis, ipRanges, clientIPs, 10, time.Hour),
 		redirectHandler.HandleRedirect)
 	
 	t.Run("Successful redirect", func(t *testing.T) {
@@ -50,6 +60,16 @@ func TestRedirectHandler_Integration(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 	
+	t.Run("Preview crawler", func(t *testing.T) {
+		w := testutil.MakeRequest(t, ts.Router, "GET", "/v1/bu01/test123?network=mi", nil,
+			map[string]string{"User-Agent": "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)"})
+		
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Contains(t, w.Body.String(), `property="og:title"`)
+		assert.Contains(t, w.Body.String(), "/v1/bu01/test123?network=mi")
+	})
+	
 	t.Run("Rate limiting", func(t *testing.T) {
 		// Make multiple requests to trigger rate limit
 		for i := 0; i < 12; i++ {
@@ -171,7 +191,7 @@ func TestLinkHandler_Integration(t *testing.T) {
 	defer ts.TearDown()
 	
 	// Setup routes
-	linkHandler := api.NewLinkHandler(ts.DB, ts.Redis)
+	linkHandler := api.NewLinkHandler(ts.DB, ts.Redis, config.DefaultLinkIDs())
 	authGroup := ts.Router.Group("/api/v1")
 	authGroup.Use(middleware.AuthMiddleware(ts.JWT))
 	{
@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"testing"
 	
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -21,10 +22,11 @@ import (
 )
 
 type TestSuite struct {
-	DB     *gorm.DB
-	Redis  *redis.Client
-	Router *gin.Engine
-	JWT    *auth.JWTManager
+	DB        *gorm.DB
+	Redis     *redis.Client
+	Miniredis *miniredis.Miniredis
+	Router    *gin.Engine
+	JWT       *auth.JWTManager
 }
 
 func SetupTestSuite(t *testing.T) *TestSuite {
@@ -41,29 +43,37 @@ func SetupTestSuite(t *testing.T) *TestSuite {
 		&models.Target{},
 		&models.LinkPermission{},
 		&models.AccessLog{},
+		&models.CountryGroup{},
+		&models.Conversion{},
+		&models.IPRange{},
+		&models.CapPeriodUsage{},
 		&api.LinkTemplate{},
 	)
 	assert.NoError(t, err)
 	
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	
 	redisClient := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-		DB:   1, // Use different DB for tests
+		Addr: mr.Addr(),
 	})
 	
 	router := gin.New()
 	jwtManager := auth.NewJWTManager("test-secret", 24)
 	
 	return &TestSuite{
-		DB:     db,
-		Redis:  redisClient,
-		Router: router,
-		JWT:    jwtManager,
+		DB:        db,
+		Redis:     redisClient,
+		Miniredis: mr,
+		Router:    router,
+		JWT:       jwtManager,
 	}
 }
 
 func (ts *TestSuite) TearDown() {
 	ts.Redis.FlushDB(context.Background())
 	ts.Redis.Close()
+	ts.Miniredis.Close()
 }
 
 func (ts *TestSuite) CreateTestToken(userID uint, username, role string) string {
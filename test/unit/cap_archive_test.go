@@ -0,0 +1,95 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/test/testutil"
+)
+
+func TestCapArchiver_Run(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	ctx := context.Background()
+	link := &models.Link{LinkID: "arc001", BusinessUnit: "bu01", Network: "mi", IsActive: true, TotalCap: 100, CapPeriod: models.CapDaily, CurrentHits: 900}
+	require.NoError(t, ts.DB.Create(link).Error)
+	target := &models.Target{LinkID: link.ID, URL: "https://target.example.com", Weight: 1, Cap: 10, CapPeriod: models.CapHourly, IsActive: true}
+	require.NoError(t, ts.DB.Create(target).Error)
+	
+	now := time.Now()
+	today := models.CapPeriodStart(models.CapDaily, "", now)
+	yesterday := models.CapPeriodLabel(models.CapDaily, models.PreviousCapPeriod(models.CapDaily, today))
+	lastHour := models.CapPeriodLabel(models.CapHourly, models.PreviousCapPeriod(models.CapHourly, models.CapPeriodStart(models.CapHourly, "", now)))
+	require.NoError(t, ts.Miniredis.Set(fmt.Sprintf("global_cap:link:%d:%s", link.ID, yesterday), "100"))
+	require.NoError(t, ts.Miniredis.Set(fmt.Sprintf("global_cap:target:%d:%s", target.ID, lastHour), "7"))
+	
+	archiver := services.NewCapArchiver(ts.DB, ts.Redis)
+	require.NoError(t, archiver.Run(ctx))
+	
+	var usages []models.CapPeriodUsage
+	require.NoError(t, ts.DB.Order("scope").Find(&usages).Error)
+	require.Len(t, usages, 2)
+	assert.Equal(t, models.CapScopeLink, usages[0].Scope)
+	assert.Equal(t, yesterday, usages[0].Period)
+	assert.Equal(t, 100, usages[0].Hits)
+	assert.Equal(t, models.CapScopeTarget, usages[1].Scope)
+	assert.Equal(t, lastHour, usages[1].Period)
+	assert.Equal(t, 7, usages[1].Hits)
+	
+	// Archiving again updates the rows
+	require.NoError(t, ts.Miniredis.Set(fmt.Sprintf("global_cap:target:%d:%s", target.ID, lastHour), "8"))
+	require.NoError(t, archiver.Run(ctx))
+	var count int64
+	ts.DB.Model(&models.CapPeriodUsage{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+	
+	// Reports read the archive once the counters are gone
+	ts.Miniredis.FlushAll()
+	caps := services.NewCapService(ts.DB, ts.Redis)
+	
+	history, err := caps.LinkHistory(ctx, link, 2)
+	require.NoError(t, err)
+	require.Len(t, history.Periods, 2)
+	assert.Equal(t, 0, history.Periods[0].Hits)
+	assert.Equal(t, services.CapUsage{Period: yesterday, Hits: 100}, history.Periods[1])
+	
+	history, err = caps.TargetHistory(ctx, link, target, 2)
+	require.NoError(t, err)
+	require.Len(t, history.Periods, 2)
+	assert.Equal(t, services.CapUsage{Period: lastHour, Hits: 8}, history.Periods[1])
+}
+
+func TestCapService_FillPeriodHits(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	ctx := context.Background()
+	caps := services.NewCapService(ts.DB, ts.Redis)
+	link := &models.Link{ID: 1, TotalCap: 100, CapPeriod: models.CapDaily, CurrentHits: 900}
+	link.Targets = []models.Target{
+		{ID: 1, Cap: 10, CapPeriod: models.CapHourly, CurrentHits: 400},
+		{ID: 2, CurrentHits: 500},
+	}
+	
+	for i := 0; i < 3; i++ {
+		_, err := caps.Reserve(ctx, link, &link.Targets[0])
+		require.NoError(t, err)
+	}
+	_, err := caps.Reserve(ctx, link, &link.Targets[1])
+	require.NoError(t, err)
+	
+	// Periodic caps report the current period, lifetime caps every hit
+	require.NoError(t, caps.FillPeriodHits(ctx, link))
+	assert.Equal(t, 4, link.PeriodHits)
+	assert.Equal(t, 3, link.Targets[0].PeriodHits)
+	assert.Equal(t, 501, link.Targets[1].PeriodHits)
+	assert.Equal(t, 900, link.CurrentHits)
+}
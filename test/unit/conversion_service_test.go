@@ -0,0 +1,134 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	
+	"github.com/raoxb/smart_redirect/internal/config"
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/test/testutil"
+)
+
+func TestConversionService_RecordPostback(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	conversionService := services.NewConversionService(ts.DB, ts.Redis)
+	ctx := context.Background()
+	
+	link := &models.Link{LinkID: "conv01", BusinessUnit: "bu01", Network: "mi", IsActive: true}
+	require.NoError(t, ts.DB.Create(link).Error)
+	targetID := uint(2)
+	accessLog := &models.AccessLog{LinkID: link.ID, TargetID: &targetID, IP: "1.2.3.4", ClickID: "click-1"}
+	require.NoError(t, ts.DB.Create(accessLog).Error)
+	
+	bandit := services.NewBanditService(ts.Redis)
+	conversions := func() int64 {
+		arms, err := bandit.Arms(ctx, []*models.Target{{ID: 2}})
+		require.NoError(t, err)
+		return arms[0].Conversions
+	}
+	
+	t.Run("Records conversion for click", func(t *testing.T) {
+		conversion, err := conversionService.RecordPostback(ctx, &services.Postback{
+			Network: "mi",
+			ClickID: "click-1",
+			Payout:  1.5,
+			Status:  models.ConversionPending,
+		})
+		require.NoError(t, err)
+		
+		assert.Equal(t, accessLog.ID, conversion.AccessLogID)
+		assert.Equal(t, link.ID, conversion.LinkID)
+		assert.Equal(t, &targetID, conversion.TargetID)
+		assert.Equal(t, models.ConversionPending, conversion.Status)
+		assert.Equal(t, int64(0), conversions())
+	})
+	
+	t.Run("Repeated postback updates the conversion", func(t *testing.T) {
+		conversion, err := conversionService.RecordPostback(ctx, &services.Postback{
+			Network: "mi",
+			ClickID: "click-1",
+			Payout:  2,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, models.ConversionApproved, conversion.Status)
+		assert.Equal(t, 2.0, conversion.Payout)
+		
+		var count int64
+		ts.DB.Model(&models.Conversion{}).Where("click_id = ?", "click-1").Count(&count)
+		assert.Equal(t, int64(1), count)
+		assert.Equal(t, int64(1), conversions())
+	})
+	
+	t.Run("Duplicate approval is counted once", func(t *testing.T) {
+		_, err := conversionService.RecordPostback(ctx, &services.Postback{Network: "mi", ClickID: "click-1", Payout: 2})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), conversions())
+		
+		_, err = conversionService.RecordPostback(ctx, &services.Postback{
+			Network: "mi",
+			ClickID: "click-1",
+			Status:  models.ConversionRejected,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), conversions())
+	})
+	
+	t.Run("Different transaction is a new conversion", func(t *testing.T) {
+		_, err := conversionService.RecordPostback(ctx, &services.Postback{
+			Network:       "mi",
+			ClickID:       "click-1",
+			TransactionID: "tx-2",
+		})
+		require.NoError(t, err)
+		
+		var count int64
+		ts.DB.Model(&models.Conversion{}).Where("click_id = ?", "click-1").Count(&count)
+		assert.Equal(t, int64(2), count)
+	})
+	
+	t.Run("Unknown click", func(t *testing.T) {
+		_, err := conversionService.RecordPostback(ctx, &services.Postback{Network: "mi", ClickID: "missing"})
+		assert.ErrorIs(t, err, services.ErrUnknownClick)
+	})
+	
+	t.Run("Click of another network", func(t *testing.T) {
+		_, err := conversionService.RecordPostback(ctx, &services.Postback{Network: "fb", ClickID: "click-1"})
+		assert.ErrorIs(t, err, services.ErrUnknownClick)
+	})
+	
+	t.Run("Invalid status", func(t *testing.T) {
+		_, err := conversionService.RecordPostback(ctx, &services.Postback{Network: "mi", ClickID: "click-1", Status: "paid"})
+		assert.ErrorIs(t, err, services.ErrInvalidConversionStatus)
+	})
+}
+
+func TestPostbackAuth_Verify(t *testing.T) {
+	auth, err := services.NewPostbackAuth(config.PostbackConfig{Networks: map[string]config.PostbackNetworkConfig{
+		"mi": {Secret: "s3cret"},
+		"fb": {Secret: "other", AllowedIPs: []string{"203.0.113.0/24"}},
+		"tt": {AllowedIPs: []string{"198.51.100.7"}},
+	}})
+	require.NoError(t, err)
+	
+	assert.NoError(t, auth.Verify("mi", "s3cret", "1.2.3.4"))
+	assert.ErrorIs(t, auth.Verify("mi", "wrong", "1.2.3.4"), services.ErrPostbackUnauthorized)
+	assert.ErrorIs(t, auth.Verify("mi", "", "1.2.3.4"), services.ErrPostbackUnauthorized)
+	
+	assert.NoError(t, auth.Verify("fb", "other", "203.0.113.9"))
+	assert.ErrorIs(t, auth.Verify("fb", "other", "1.2.3.4"), services.ErrPostbackUnauthorized)
+	
+	assert.NoError(t, auth.Verify("tt", "", "198.51.100.7"))
+	assert.ErrorIs(t, auth.Verify("tt", "", "198.51.100.8"), services.ErrPostbackUnauthorized)
+	
+	assert.ErrorIs(t, auth.Verify("unknown", "s3cret", "1.2.3.4"), services.ErrPostbackUnauthorized)
+	assert.ErrorIs(t, auth.Verify("", "", "1.2.3.4"), services.ErrPostbackUnauthorized)
+	
+	_, err = services.NewPostbackAuth(config.PostbackConfig{Networks: map[string]config.PostbackNetworkConfig{"mi": {}}})
+	assert.Error(t, err)
+}
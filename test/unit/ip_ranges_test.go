@@ -0,0 +1,190 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	
+	"github.com/raoxb/smart_redirect/internal/api"
+	"github.com/raoxb/smart_redirect/internal/middleware"
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/pkg/clientip"
+	"github.com/raoxb/smart_redirect/test/testutil"
+)
+
+func TestIPRangeService_Lists(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	ctx := context.Background()
+	ipRanges := services.NewIPRangeService(ts.DB, ts.Redis)
+	
+	err := ipRanges.Save(ctx, []models.IPRange{
+		{CIDR: "203.0.113.0/24", List: models.IPRangeBlock, Source: "abuse"},
+		{CIDR: "203.0.113.10", List: models.IPRangeAllow, Source: "office"},
+		{CIDR: "2001:db8::/32", List: models.IPRangeBlock, Reason: "hosting provider"},
+	})
+	require.NoError(t, err)
+	
+	t.Run("Block list", func(t *testing.T) {
+		blocked, entry := ipRanges.IsBlocked("203.0.113.9")
+		assert.True(t, blocked)
+		assert.Equal(t, "listed in abuse", entry.BlockReason())
+		
+		blocked, entry = ipRanges.IsBlocked("2001:db8:ffff::1")
+		assert.True(t, blocked)
+		assert.Equal(t, "hosting provider", entry.BlockReason())
+		
+		blocked, _ = ipRanges.IsBlocked("198.51.100.1")
+		assert.False(t, blocked)
+	})
+	
+	t.Run("IPv4-mapped addresses match IPv4 entries", func(t *testing.T) {
+		blocked, entry := ipRanges.IsBlocked("::ffff:203.0.113.9")
+		assert.True(t, blocked)
+		assert.Equal(t, "listed in abuse", entry.BlockReason())
+		
+		blocked, _ = ipRanges.IsBlocked("::ffff:203.0.113.10")
+		assert.False(t, blocked)
+	})
+	
+	t.Run("Allow list takes precedence", func(t *testing.T) {
+		blocked, entry := ipRanges.IsBlocked("203.0.113.10")
+		assert.False(t, blocked)
+		require.NotNil(t, entry)
+		assert.Equal(t, models.IPRangeAllow, entry.List)
+		assert.Equal(t, "203.0.113.10/32", entry.CIDR)
+	})
+	
+	t.Run("Rate limiter checks the lists", func(t *testing.T) {
+		rateLimiter := services.NewRateLimiter(ts.Redis, ipRanges)
+		
+		blocked, reason := rateLimiter.IsIPBlocked("203.0.113.50")
+		assert.True(t, blocked)
+		assert.Equal(t, "listed in abuse", reason)
+		
+		// Allowlisted IPs are not blocked, even by an exact block
+		require.NoError(t, rateLimiter.BlockIP("203.0.113.10", "rate limit exceeded", time.Hour))
+		blocked, _ = rateLimiter.IsIPBlocked("203.0.113.10")
+		assert.False(t, blocked)
+	})
+	
+	t.Run("Rate limit middleware checks the lists", func(t *testing.T) {
+		clientIPs, err := clientip.New(nil, nil)
+		require.NoError(t, err)
+		router := gin.New()
+		router.GET("/", middleware.RateLimitMiddleware(ts.Redis, ipRanges, clientIPs, 100, time.Hour), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		
+		request := func(remoteAddr string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = remoteAddr
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+		
+		w := request("203.0.113.50:40000")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "listed in abuse")
+		assert.Equal(t, http.StatusNoContent, request("198.51.100.1:40000").Code)
+	})
+	
+	t.Run("Invalid entries", func(t *testing.T) {
+		assert.ErrorIs(t, ipRanges.Save(ctx, []models.IPRange{{CIDR: "10.0.0.0/33", List: models.IPRangeBlock}}), services.ErrInvalidIPRange)
+		assert.ErrorIs(t, ipRanges.Save(ctx, []models.IPRange{{CIDR: "10.0.0.0/8", List: "deny"}}), services.ErrInvalidIPRange)
+	})
+	
+	t.Run("Other instances reload", func(t *testing.T) {
+		other := services.NewIPRangeService(ts.DB, ts.Redis)
+		require.NoError(t, other.Reload(ctx))
+		blocked, _ := other.IsBlocked("203.0.113.9")
+		assert.True(t, blocked)
+		
+		entries, err := ipRanges.List(models.IPRangeBlock, "abuse")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.NoError(t, ipRanges.Delete(ctx, entries[0].ID))
+		
+		require.NoError(t, other.Reload(ctx))
+		blocked, _ = other.IsBlocked("203.0.113.9")
+		assert.False(t, blocked)
+	})
+}
+
+func TestIPRangeService_Import(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	ctx := context.Background()
+	ipRanges := services.NewIPRangeService(ts.DB, ts.Redis)
+	template := models.IPRange{List: models.IPRangeBlock, Source: "datacenters.txt"}
+	
+	count, err := ipRanges.Import(ctx, strings.NewReader("# cloud\n3.0.0.0/9\n3.0.0.0/9\n2600:1f00::/24\n"), template, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	
+	blocked, _ := ipRanges.IsBlocked("3.1.2.3")
+	assert.True(t, blocked)
+	
+	// Replacing drops the entries of the source missing from the new file
+	count, err = ipRanges.Import(ctx, strings.NewReader("35.180.0.0/16\n"), template, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	
+	blocked, _ = ipRanges.IsBlocked("3.1.2.3")
+	assert.False(t, blocked)
+	blocked, _ = ipRanges.IsBlocked("35.180.1.1")
+	assert.True(t, blocked)
+	
+	_, err = ipRanges.Import(ctx, strings.NewReader("not-a-cidr\n"), template, false)
+	assert.ErrorIs(t, err, services.ErrInvalidIPRange)
+	
+	t.Run("Expired entries", func(t *testing.T) {
+		expired := time.Now().Add(-time.Minute)
+		require.NoError(t, ts.DB.Create(&models.IPRange{CIDR: "192.0.2.0/24", List: models.IPRangeBlock, ExpiresAt: &expired}).Error)
+		require.NoError(t, ipRanges.Reload(ctx))
+		
+		blocked, _ := ipRanges.IsBlocked("192.0.2.1")
+		assert.False(t, blocked)
+	})
+}
+
+func TestIPRangeHandler_CreateIPRangesErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	sqlDB, err := ts.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	
+	handler := api.NewIPRangeHandler(services.NewIPRangeService(ts.DB, ts.Redis))
+	ts.Router.POST("/ip-ranges", handler.CreateIPRanges)
+	
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/ip-ranges", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.Router.ServeHTTP(w, req)
+		return w
+	}
+	
+	w := create(`{"cidrs": ["10.0.0.0/33"], "list": "block"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "10.0.0.0/33")
+	
+	// Storage failures are not the client's fault and do not leak details
+	require.NoError(t, ts.DB.Migrator().DropTable(&models.IPRange{}))
+	w = create(`{"cidrs": ["10.0.0.0/8"], "list": "block"}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error": "failed to save ip ranges"}`, w.Body.String())
+}
@@ -0,0 +1,70 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	
+	"github.com/raoxb/smart_redirect/internal/api"
+	"github.com/raoxb/smart_redirect/internal/config"
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/test/testutil"
+)
+
+func TestLinkHandler_RecordConversionsPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	handler := api.NewLinkHandler(ts.DB, ts.Redis, config.DefaultLinkIDs())
+	// Stand in for AuthMiddleware with the user given in the headers
+	ts.Router.POST("/targets/:target_id/conversions", func(c *gin.Context) {
+		var userID uint
+		fmt.Sscan(c.GetHeader("X-User-ID"), &userID)
+		c.Set("user_id", userID)
+		c.Set("role", c.GetHeader("X-Role"))
+	}, handler.RecordConversions)
+	
+	link := &models.Link{LinkID: "cv0001", BusinessUnit: "bu01", Network: "mi", IsActive: true}
+	require.NoError(t, ts.DB.Create(link).Error)
+	target := &models.Target{LinkID: link.ID, URL: "https://offer.example.com/", Weight: 100, IsActive: true}
+	require.NoError(t, ts.DB.Create(target).Error)
+	require.NoError(t, ts.DB.Create(&models.LinkPermission{UserID: 2, LinkID: link.ID, CanEdit: true}).Error)
+	require.NoError(t, ts.DB.Create(&models.LinkPermission{UserID: 3, LinkID: link.ID}).Error)
+	
+	record := func(userID uint, role string) int {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/targets/%d/conversions", target.ID), strings.NewReader(`{"count": 2}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", fmt.Sprint(userID))
+		req.Header.Set("X-Role", role)
+		w := httptest.NewRecorder()
+		ts.Router.ServeHTTP(w, req)
+		return w.Code
+	}
+	conversions := func() string {
+		return ts.Redis.HGet(context.Background(), fmt.Sprintf("bandit:target:%d", target.ID), "conversions").Val()
+	}
+	
+	t.Run("other users are refused", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, record(4, "user"))
+		assert.Equal(t, http.StatusForbidden, record(3, "user"))
+		assert.Empty(t, conversions())
+	})
+	
+	t.Run("users allowed to edit the link", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, record(2, "user"))
+		assert.Equal(t, "2", conversions())
+	})
+	
+	t.Run("admins", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, record(1, "admin"))
+		assert.Equal(t, "4", conversions())
+	})
+}
@@ -0,0 +1,71 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+	
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/test/testutil"
+)
+
+func TestLinkScheduler_Run(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	ctx := context.Background()
+	linkService := services.NewLinkService(ts.DB, ts.Redis)
+	scheduler := services.NewLinkScheduler(ts.DB, ts.Redis)
+	
+	now := time.Now()
+	startsAt := now.Add(time.Minute)
+	expiresAt := now.Add(2 * time.Minute)
+	link := &models.Link{
+		BusinessUnit: "bu01",
+		Network:      "mi",
+		IsActive:     true,
+		StartsAt:     &startsAt,
+		ExpiresAt:    &expiresAt,
+	}
+	require.NoError(t, linkService.CreateLink(link))
+	target := &models.Target{LinkID: link.ID, URL: "https://target.example.com", Weight: 1, IsActive: true, ExpiresAt: &startsAt}
+	require.NoError(t, ts.DB.Create(target).Error)
+	// Switched off by hand before its flight starts
+	paused := &models.Target{LinkID: link.ID, URL: "https://paused.example.com", Weight: 1, StartsAt: &startsAt}
+	require.NoError(t, ts.DB.Create(paused).Error)
+	require.NoError(t, ts.DB.Model(paused).Update("is_active", false).Error)
+	
+	t.Run("Not started", func(t *testing.T) {
+		found, err := linkService.GetLinkByID(link.LinkID)
+		require.NoError(t, err)
+		assert.Nil(t, found)
+	})
+	
+	t.Run("Target expires", func(t *testing.T) {
+		require.NoError(t, scheduler.Run(ctx, now, startsAt))
+		
+		var stored models.Target
+		require.NoError(t, ts.DB.First(&stored, target.ID).Error)
+		assert.False(t, stored.IsActive)
+		assert.Equal(t, int64(0), ts.Redis.Exists(ctx, "link:"+link.LinkID).Val())
+	})
+	
+	t.Run("Targets switched off by hand stay off when their flight starts", func(t *testing.T) {
+		var stored models.Target
+		require.NoError(t, ts.DB.First(&stored, paused.ID).Error)
+		assert.False(t, stored.IsActive)
+	})
+	
+	t.Run("Link expires", func(t *testing.T) {
+		require.NoError(t, scheduler.Run(ctx, startsAt, expiresAt))
+		
+		var stored models.Link
+		require.NoError(t, ts.DB.First(&stored, link.ID).Error)
+		assert.False(t, stored.IsActive)
+		
+	})
+}
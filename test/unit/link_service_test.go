@@ -2,12 +2,16 @@ package unit
 
 import (
 	"testing"
+	"time"
 	
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	
+	"github.com/raoxb/smart_redirect/internal/config"
+	"github.com/raoxb/smart_redirect/internal/api"
 	"github.com/raoxb/smart_redirect/internal/models"
 	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/pkg/geoip"
 	"github.com/raoxb/smart_redirect/test/fixtures"
 	"github.com/raoxb/smart_redirect/test/testutil"
 )
@@ -131,6 +135,213 @@ func TestLinkService_SelectTarget(t *testing.T) {
 	})
 }
 
+func TestLinkService_SelectTargetSchedule(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	linkService := services.NewLinkService(ts.DB, ts.Redis)
+	
+	link := fixtures.CreateTestLink()
+	link.Targets = fixtures.CreateTestTargets()
+	link.Targets[0].Countries = `["ALL"]`
+	link.Targets[1].Countries = `["ALL"]`
+	// Target 1 only runs 09:00-17:00 Lagos time on weekdays
+	link.Targets[0].Schedule = `{"timezone":"Africa/Lagos","windows":[{"days":["mon","tue","wed","thu","fri"],"start_hour":9,"end_hour":17}]}`
+	// Target 2 only runs overnight in the visitor's timezone
+	link.Targets[1].Schedule = `{"timezone":"visitor","windows":[{"start_hour":22,"end_hour":6}]}`
+	
+	lagos, err := time.LoadLocation("Africa/Lagos")
+	require.NoError(t, err)
+	
+	visitor := func(at time.Time, tz string) *services.Visitor {
+		return &services.Visitor{
+			IP:       "192.168.1.10",
+			Location: &geoip.Location{CountryCode: "NG", TimeZone: tz},
+			Time:     at,
+		}
+	}
+	
+	t.Run("Inside business hours", func(t *testing.T) {
+		// Wednesday 10:00 in Lagos
+		target, err := linkService.SelectTargetFor(link, visitor(time.Date(2024, 7, 3, 10, 0, 0, 0, lagos), "Africa/Lagos"))
+		require.NoError(t, err)
+		assert.Equal(t, "https://target1.example.com", target.URL)
+	})
+	
+	t.Run("Overnight window in visitor timezone", func(t *testing.T) {
+		// Saturday 02:00 in Lagos, outside target 1's weekdays
+		target, err := linkService.SelectTargetFor(link, visitor(time.Date(2024, 7, 6, 2, 0, 0, 0, lagos), "Africa/Lagos"))
+		require.NoError(t, err)
+		assert.Equal(t, "https://target2.example.com", target.URL)
+	})
+	
+	t.Run("All targets out of schedule", func(t *testing.T) {
+		// Wednesday 19:00 in Lagos
+		target, err := linkService.SelectTargetFor(link, visitor(time.Date(2024, 7, 3, 19, 0, 0, 0, lagos), "Africa/Lagos"))
+		assert.Error(t, err)
+		assert.Nil(t, target)
+	})
+}
+
+func TestLinkService_SelectTargetLanguages(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	linkService := services.NewLinkService(ts.DB, ts.Redis)
+	
+	link := fixtures.CreateTestLink()
+	link.Targets = fixtures.CreateTestTargets()
+	link.Targets[0].Countries = `["ALL"]`
+	link.Targets[0].Languages = `["es"]`
+	link.Targets[1].Countries = `["ALL"]`
+	link.Targets[1].Languages = `["pt"]`
+	
+	visitor := func(acceptLanguage string) *services.Visitor {
+		return &services.Visitor{
+			IP:        "192.168.1.10",
+			Location:  &geoip.Location{CountryCode: "MX"},
+			Languages: services.ParseAcceptLanguage(acceptLanguage),
+		}
+	}
+	
+	t.Run("Most preferred language wins", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			target, err := linkService.SelectTargetFor(link, visitor("es-MX,pt;q=0.9"))
+			require.NoError(t, err)
+			assert.Equal(t, "https://target1.example.com", target.URL)
+		}
+	})
+	
+	t.Run("Less preferred language matches", func(t *testing.T) {
+		link.Targets[0].IsActive = false
+		defer func() { link.Targets[0].IsActive = true }()
+		
+		target, err := linkService.SelectTargetFor(link, visitor("es-MX,pt;q=0.9"))
+		require.NoError(t, err)
+		assert.Equal(t, "https://target2.example.com", target.URL)
+	})
+	
+	t.Run("No language matches", func(t *testing.T) {
+		target, err := linkService.SelectTargetFor(link, visitor("fr-FR,fr;q=0.9"))
+		assert.Error(t, err)
+		assert.Nil(t, target)
+	})
+}
+
+func TestLinkService_SelectTargetCountryGroups(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	linkService := services.NewLinkService(ts.DB, ts.Redis)
+	
+	group := &models.CountryGroup{Name: "EASTAFRICA"}
+	err := linkService.CountryGroups().SaveGroup(group, []string{"KE", "TZ", "UG"})
+	require.NoError(t, err)
+	
+	link := fixtures.CreateTestLink()
+	link.Targets = fixtures.CreateTestTargets()
+	link.Targets[0].Countries = `["EASTAFRICA"]`
+	link.Targets[0].ExcludedCountries = `["UG"]`
+	link.Targets[1].Countries = `["ALL"]`
+	link.Targets[1].ExcludedCountries = `["EASTAFRICA"]`
+	
+	t.Run("Country in group", func(t *testing.T) {
+		target, err := linkService.SelectTarget(link, "192.168.2.1", "KE")
+		require.NoError(t, err)
+		assert.Equal(t, "https://target1.example.com", target.URL)
+	})
+	
+	t.Run("Excluded country falls through", func(t *testing.T) {
+		target, err := linkService.SelectTarget(link, "192.168.2.2", "UG")
+		assert.Error(t, err)
+		assert.Nil(t, target)
+	})
+	
+	t.Run("Group exclusion", func(t *testing.T) {
+		target, err := linkService.SelectTarget(link, "192.168.2.3", "NG")
+		require.NoError(t, err)
+		assert.Equal(t, "https://target2.example.com", target.URL)
+	})
+	
+	t.Run("Unknown group names are rejected", func(t *testing.T) {
+		assert.NoError(t, linkService.CountryGroups().ValidateCountries([]string{"US", "ALL", "eastafrica"}))
+		assert.Error(t, linkService.CountryGroups().ValidateCountries([]string{"NOWHERE"}))
+	})
+	
+	t.Run("Unresolved groups fail closed", func(t *testing.T) {
+		codes, err := linkService.CountryGroups().Expand([]string{"KE", "NOWHERE"})
+		assert.Error(t, err)
+		assert.Equal(t, []string{"KE"}, codes)
+		
+		link := fixtures.CreateTestLink()
+		link.Targets = fixtures.CreateTestTargets()[:1]
+		link.Targets[0].Countries = `["ALL"]`
+		link.Targets[0].ExcludedCountries = `["NOWHERE"]`
+		target, err := linkService.SelectTarget(link, "192.168.2.4", "NG")
+		assert.Error(t, err)
+		assert.Nil(t, target)
+		
+		link.Targets[0].Countries = `["NOWHERE"]`
+		link.Targets[0].ExcludedCountries = ""
+		target, err = linkService.SelectTarget(link, "192.168.2.5", "NG")
+		assert.Error(t, err)
+		assert.Nil(t, target)
+	})
+}
+
+func TestCountryGroupService_References(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	groups := services.NewCountryGroupService(ts.DB, ts.Redis)
+	require.NoError(t, groups.SaveGroup(&models.CountryGroup{Name: "EASTAFRICA"}, []string{"KE", "TZ"}))
+	require.NoError(t, groups.SaveGroup(&models.CountryGroup{Name: "EASTAFRICA_PLUS"}, []string{"KE", "UG"}))
+	
+	refs, err := groups.References("EASTAFRICA")
+	require.NoError(t, err)
+	assert.Empty(t, refs)
+	
+	link := &models.Link{LinkID: "grp001", BusinessUnit: "bu01", Fallbacks: `[{"url":"https://a.example.com","countries":["eastafrica"]}]`}
+	require.NoError(t, ts.DB.Create(link).Error)
+	excluding := &models.Target{LinkID: link.ID, URL: "https://b.example.com", ExcludedCountries: `["EASTAFRICA"]`}
+	weighting := &models.Target{LinkID: link.ID, URL: "https://c.example.com", CountryWeights: `{"EASTAFRICA":10}`}
+	other := &models.Target{LinkID: link.ID, URL: "https://d.example.com", Countries: `["EASTAFRICA_PLUS"]`}
+	require.NoError(t, ts.DB.Create([]*models.Target{excluding, weighting, other}).Error)
+	template := &api.LinkTemplate{Name: "t", TargetConfig: `[{"url":"https://e.example.com","countries":["US","EASTAFRICA"]}]`}
+	require.NoError(t, ts.DB.Create(template).Error)
+	
+	refs, err = groups.References("eastafrica")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []services.CountryGroupReference{
+		{Kind: "target", ID: excluding.ID},
+		{Kind: "target", ID: weighting.ID},
+		{Kind: "link", ID: link.ID},
+		{Kind: "template", ID: template.ID},
+	}, refs)
+}
+
+func TestLinkService_EffectiveWeight(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	linkService := services.NewLinkService(ts.DB, ts.Redis)
+	
+	group := &models.CountryGroup{Name: "EASTAFRICA"}
+	err := linkService.CountryGroups().SaveGroup(group, []string{"KE", "TZ", "UG"})
+	require.NoError(t, err)
+	
+	target := &models.Target{
+		Weight:         50,
+		CountryWeights: `{"NG":70,"KE":20,"EASTAFRICA":10}`,
+	}
+	
+	assert.Equal(t, 70, linkService.EffectiveWeight(target, "NG"))
+	assert.Equal(t, 20, linkService.EffectiveWeight(target, "ke"))
+	assert.Equal(t, 10, linkService.EffectiveWeight(target, "TZ"))
+	assert.Equal(t, 50, linkService.EffectiveWeight(target, "US"))
+	assert.Equal(t, 50, linkService.EffectiveWeight(&models.Target{Weight: 50}, "NG"))
+}
+
 func TestLinkService_ProcessParameters(t *testing.T) {
 	ts := testutil.SetupTestSuite(t)
 	defer ts.TearDown()
@@ -199,4 +410,44 @@ func TestLinkService_IncrementHits(t *testing.T) {
 	err = ts.DB.First(&updatedTarget, target.ID).Error
 	require.NoError(t, err)
 	assert.Equal(t, initialTargetHits+1, updatedTarget.CurrentHits)
-}
\ No newline at end of file
+}
+func TestLinkService_CustomLinkIDs(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	linkService := services.NewLinkService(ts.DB, ts.Redis)
+	linkService.SetLinkIDConfig(config.LinkIDConfig{
+		LinkIDFormat: config.DefaultLinkIDs().LinkIDFormat,
+		BusinessUnits: map[string]config.LinkIDFormat{
+			"bu02": {Length: 4, Alphabet: "ab"},
+		},
+	})
+	
+	t.Run("Custom ID", func(t *testing.T) {
+		link := &models.Link{LinkID: "spring-sale", BusinessUnit: "bu01", Network: "mi"}
+		require.NoError(t, linkService.CreateLink(link))
+		assert.Equal(t, "spring-sale", link.LinkID)
+		
+		taken := &models.Link{LinkID: "spring-sale", BusinessUnit: "bu01", Network: "mi"}
+		assert.ErrorIs(t, linkService.CreateLink(taken), services.ErrLinkIDTaken)
+	})
+	
+	t.Run("Invalid and reserved IDs", func(t *testing.T) {
+		assert.Error(t, services.ValidateCustomLinkID("ab"))
+		assert.Error(t, services.ValidateCustomLinkID("-sale"))
+		assert.Error(t, services.ValidateCustomLinkID("sale/2024"))
+		assert.ErrorIs(t, services.ValidateCustomLinkID("Admin"), services.ErrReservedLinkID)
+		assert.NoError(t, services.ValidateCustomLinkID("Sale_2024"))
+	})
+	
+	t.Run("Generated IDs follow the business unit format", func(t *testing.T) {
+		seen := map[string]bool{}
+		for i := 0; i < 5; i++ {
+			link := &models.Link{BusinessUnit: "bu02", Network: "mi"}
+			require.NoError(t, linkService.CreateLink(link))
+			assert.Regexp(t, "^[ab]{4}$", link.LinkID)
+			assert.False(t, seen[link.LinkID])
+			seen[link.LinkID] = true
+		}
+	})
+}
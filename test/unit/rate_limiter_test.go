@@ -15,7 +15,7 @@ func TestRateLimiter_CheckIPLimit(t *testing.T) {
 	ts := testutil.SetupTestSuite(t)
 	defer ts.TearDown()
 	
-	rateLimiter := services.NewRateLimiter(ts.Redis)
+	rateLimiter := services.NewRateLimiter(ts.Redis, services.NewIPRangeService(ts.DB, ts.Redis))
 	
 	t.Run("IP limit not exceeded", func(t *testing.T) {
 		allowed, err := rateLimiter.CheckIPLimit("192.168.1.1", 5, time.Hour)
@@ -49,7 +49,7 @@ func TestRateLimiter_CheckIPLinkLimit(t *testing.T) {
 	ts := testutil.SetupTestSuite(t)
 	defer ts.TearDown()
 	
-	rateLimiter := services.NewRateLimiter(ts.Redis)
+	rateLimiter := services.NewRateLimiter(ts.Redis, services.NewIPRangeService(ts.DB, ts.Redis))
 	
 	t.Run("IP link limit not exceeded", func(t *testing.T) {
 		allowed, err := rateLimiter.CheckIPLinkLimit("192.168.1.1", 1, 3, 12*time.Hour)
@@ -100,7 +100,7 @@ func TestRateLimiter_CheckGlobalCap(t *testing.T) {
 	ts := testutil.SetupTestSuite(t)
 	defer ts.TearDown()
 	
-	rateLimiter := services.NewRateLimiter(ts.Redis)
+	rateLimiter := services.NewRateLimiter(ts.Redis, services.NewIPRangeService(ts.DB, ts.Redis))
 	
 	t.Run("Global cap not exceeded", func(t *testing.T) {
 		key := "test:cap:1"
@@ -140,11 +140,89 @@ func TestRateLimiter_CheckGlobalCap(t *testing.T) {
 	})
 }
 
+func TestRateLimiter_Algorithms(t *testing.T) {
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	
+	rateLimiter := services.NewRateLimiter(ts.Redis, services.NewIPRangeService(ts.DB, ts.Redis))
+	now := time.Unix(1700000000, 0)
+	ts.Miniredis.SetTime(now)
+	
+	allow := func(algorithm, key string) bool {
+		allowed, err := rateLimiter.Allow(algorithm, key, 3, time.Minute)
+		require.NoError(t, err)
+		return allowed
+	}
+	
+	t.Run("Fixed window is not extended by later hits", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.True(t, allow(services.AlgorithmFixedWindow, "fixed"))
+		}
+		assert.False(t, allow(services.AlgorithmFixedWindow, "fixed"))
+		
+		ts.Miniredis.FastForward(40 * time.Second)
+		assert.False(t, allow(services.AlgorithmFixedWindow, "fixed"))
+		
+		ts.Miniredis.FastForward(21 * time.Second)
+		assert.True(t, allow(services.AlgorithmFixedWindow, "fixed"))
+	})
+	
+	t.Run("Sliding window releases hits as they age", func(t *testing.T) {
+		clock := now
+		for i := 0; i < 3; i++ {
+			ts.Miniredis.SetTime(clock)
+			assert.True(t, allow(services.AlgorithmSlidingWindow, "sliding"))
+			clock = clock.Add(20 * time.Second)
+		}
+		
+		ts.Miniredis.SetTime(now.Add(59 * time.Second))
+		assert.False(t, allow(services.AlgorithmSlidingWindow, "sliding"))
+		
+		// Only the first hit has left the window
+		ts.Miniredis.SetTime(now.Add(61 * time.Second))
+		assert.True(t, allow(services.AlgorithmSlidingWindow, "sliding"))
+		assert.False(t, allow(services.AlgorithmSlidingWindow, "sliding"))
+	})
+	
+	t.Run("Token bucket refills at limit per window", func(t *testing.T) {
+		ts.Miniredis.SetTime(now)
+		for i := 0; i < 3; i++ {
+			assert.True(t, allow(services.AlgorithmTokenBucket, "bucket"))
+		}
+		assert.False(t, allow(services.AlgorithmTokenBucket, "bucket"))
+		
+		// One token every 20 seconds
+		ts.Miniredis.SetTime(now.Add(20 * time.Second))
+		assert.True(t, allow(services.AlgorithmTokenBucket, "bucket"))
+		assert.False(t, allow(services.AlgorithmTokenBucket, "bucket"))
+		
+		ts.Miniredis.SetTime(now.Add(10 * time.Minute))
+		for i := 0; i < 3; i++ {
+			assert.True(t, allow(services.AlgorithmTokenBucket, "bucket"))
+		}
+		assert.False(t, allow(services.AlgorithmTokenBucket, "bucket"))
+	})
+	
+	t.Run("Per-IP limits with an algorithm", func(t *testing.T) {
+		for _, algorithm := range services.RateLimitAlgorithms {
+			ip := "10.0.0." + algorithm
+			for i := 0; i < 2; i++ {
+				allowed, err := rateLimiter.CheckIPLinkLimitWith(algorithm, ip, 1, 2, time.Hour)
+				require.NoError(t, err)
+				assert.True(t, allowed, algorithm)
+			}
+			allowed, err := rateLimiter.CheckIPLinkLimitWith(algorithm, ip, 1, 2, time.Hour)
+			require.NoError(t, err)
+			assert.False(t, allowed, algorithm)
+		}
+	})
+}
+
 func TestRateLimiter_BlockIP(t *testing.T) {
 	ts := testutil.SetupTestSuite(t)
 	defer ts.TearDown()
 	
-	rateLimiter := services.NewRateLimiter(ts.Redis)
+	rateLimiter := services.NewRateLimiter(ts.Redis, services.NewIPRangeService(ts.DB, ts.Redis))
 	
 	t.Run("Block and check IP", func(t *testing.T) {
 		ip := "192.168.1.100"
@@ -187,7 +265,7 @@ func TestRateLimiter_RecordIPAccess(t *testing.T) {
 	ts := testutil.SetupTestSuite(t)
 	defer ts.TearDown()
 	
-	rateLimiter := services.NewRateLimiter(ts.Redis)
+	rateLimiter := services.NewRateLimiter(ts.Redis, services.NewIPRangeService(ts.DB, ts.Redis))
 	
 	t.Run("Record and retrieve IP access", func(t *testing.T) {
 		ip := "192.168.1.200"
@@ -0,0 +1,199 @@
+package unit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/raoxb/smart_redirect/internal/api"
+	"github.com/raoxb/smart_redirect/internal/config"
+	"github.com/raoxb/smart_redirect/internal/models"
+	"github.com/raoxb/smart_redirect/internal/services"
+	"github.com/raoxb/smart_redirect/pkg/clientip"
+	"github.com/raoxb/smart_redirect/pkg/geoip"
+	"github.com/raoxb/smart_redirect/test/testutil"
+)
+
+// setupRedirectRoute serves redirects on the suite's router, reading
+// forwarding headers from trustedProxies. The database is held to one
+// connection, so that the access logs written in the background share the
+// in-memory database.
+func setupRedirectRoute(t *testing.T, ts *testutil.TestSuite, bots config.BotFilterConfig, trustedProxies ...string) {
+	sqlDB, err := ts.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	
+	botFilter, err := services.NewBotFilter(bots)
+	require.NoError(t, err)
+	clientIPs, err := clientip.New(trustedProxies, config.DefaultClientIP().Headers)
+	require.NoError(t, err)
+	
+	handler := api.NewRedirectHandler(ts.DB, ts.Redis, config.DefaultRateLimits(), botFilter, services.NewIPRangeService(ts.DB, ts.Redis), clientIPs, geoip.NewIPAPIProvider(1000))
+	ts.Router.GET("/v1/:bu/:link_id", handler.HandleRedirect)
+}
+
+// redirect requests path from a private address, which is located without
+// calling out to a geolocation service.
+func redirect(ts *testutil.TestSuite, path string, header http.Header) *httptest.ResponseRecorder {
+	return redirectFrom(ts, "10.1.2.3:40000", path, header)
+}
+
+func redirectFrom(ts *testutil.TestSuite, remoteAddr string, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36")
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	
+	w := httptest.NewRecorder()
+	ts.Router.ServeHTTP(w, req)
+	return w
+}
+
+// waitForAccessLog returns the access log of the link, written after the
+// response.
+func waitForAccessLog(t *testing.T, ts *testutil.TestSuite, linkID uint) models.AccessLog {
+	var accessLog models.AccessLog
+	require.Eventually(t, func() bool {
+		return ts.DB.Where("link_id = ?", linkID).First(&accessLog).Error == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	return accessLog
+}
+
+func TestRedirectHandler_FallbackAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	setupRedirectRoute(t, ts, config.DefaultBotFilter())
+	
+	link := &models.Link{
+		LinkID:       "fb0001",
+		BusinessUnit: "bu01",
+		Network:      "mi",
+		IsActive:     true,
+		Fallbacks:    `[{"url":"https://fallback.example.com/"}]`,
+	}
+	require.NoError(t, ts.DB.Create(link).Error)
+	
+	w := redirect(ts, "/v1/bu01/fb0001", nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://fallback.example.com/", w.Header().Get("Location"))
+	
+	accessLog := waitForAccessLog(t, ts, link.ID)
+	assert.Nil(t, accessLog.TargetID)
+	assert.Equal(t, models.FallbackNoTarget, accessLog.FallbackReason)
+	
+	// Postgres refuses a zero target_id, a foreign key to targets
+	var nullTargets int64
+	ts.DB.Model(&models.AccessLog{}).Where("id = ? AND target_id IS NULL", accessLog.ID).Count(&nullTargets)
+	assert.Equal(t, int64(1), nullTargets)
+}
+
+func TestRedirectHandler_BlockedBotAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	setupRedirectRoute(t, ts, config.DefaultBotFilter())
+	
+	link := &models.Link{LinkID: "bot001", BusinessUnit: "bu01", Network: "mi", IsActive: true, BotAction: models.BotBlock}
+	require.NoError(t, ts.DB.Create(link).Error)
+	
+	w := redirect(ts, "/v1/bu01/bot001", http.Header{"User-Agent": {"curl/8.4.0"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	
+	accessLog := waitForAccessLog(t, ts, link.ID)
+	assert.Equal(t, models.BotVerdictBlocked, accessLog.BotVerdict)
+	assert.Equal(t, models.BotReasonKnownBot, accessLog.BotReason)
+	assert.Nil(t, accessLog.TargetID)
+	assert.Equal(t, "curl/8.4.0", accessLog.UserAgent)
+}
+
+// redisKeys returns the Redis keys starting with one of the prefixes.
+func redisKeys(ts *testutil.TestSuite, prefixes ...string) []string {
+	var keys []string
+	for _, key := range ts.Miniredis.Keys() {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+func TestRedirectHandler_PreviewSkipsVisitorTracking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	setupRedirectRoute(t, ts, config.DefaultBotFilter())
+	
+	link := &models.Link{LinkID: "prv001", BusinessUnit: "bu01", Network: "mi", IsActive: true, PreviewTitle: "Summer sale"}
+	require.NoError(t, ts.DB.Create(link).Error)
+	require.NoError(t, ts.DB.Create(&models.Target{LinkID: link.ID, URL: "https://offer.example.com/", Weight: 100, Cap: 10, IsActive: true}).Error)
+	tracking := []string{"global_cap:", "ip_memory:", "stats:", "rate_limit:", "ip_access:"}
+	
+	w := redirect(ts, "/v1/bu01/prv001", http.Header{"User-Agent": {"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)"}, "X-Forwarded-Proto": {"https"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<meta property="og:title" content="Summer sale">`)
+	// X-Forwarded-Proto is ignored from clients that are not trusted proxies
+	assert.Contains(t, w.Body.String(), `<meta property="og:url" content="http://example.com/v1/bu01/prv001?network=mi">`)
+	
+	// Give any background work the time a redirect's would take
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, redisKeys(ts, tracking...))
+	var logs int64
+	ts.DB.Model(&models.AccessLog{}).Count(&logs)
+	assert.Zero(t, logs)
+	var hits []int
+	ts.DB.Model(&models.Target{}).Pluck("current_hits", &hits)
+	assert.Equal(t, []int{0}, hits)
+	
+	// A visitor on the same link is tracked under the keys checked above
+	w = redirect(ts, "/v1/bu01/prv001", nil)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.NotEmpty(t, redisKeys(ts, "global_cap:"))
+	assert.NotEmpty(t, redisKeys(ts, "ip_memory:"))
+	assert.Eventually(t, func() bool {
+		return len(redisKeys(ts, "stats:")) > 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestRedirectHandler_ClientIPThroughTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ts := testutil.SetupTestSuite(t)
+	defer ts.TearDown()
+	setupRedirectRoute(t, ts, config.DefaultBotFilter(), "10.1.0.0/16")
+	
+	links := make([]*models.Link, 3)
+	for i := range links {
+		links[i] = &models.Link{LinkID: fmt.Sprintf("cip00%d", i), BusinessUnit: "bu01", Network: "mi", IsActive: true, Fallbacks: `[{"url":"https://fallback.example.com/"}]`}
+		require.NoError(t, ts.DB.Create(links[i]).Error)
+	}
+	forwarded := http.Header{"X-Forwarded-For": {"192.168.5.5, 10.1.9.9"}}
+	
+	// Trusted hops are skipped from the right
+	w := redirectFrom(ts, "10.1.2.3:40000", "/v1/bu01/cip000", forwarded)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "192.168.5.5", waitForAccessLog(t, ts, links[0].ID).IP)
+	
+	// Headers from other peers are ignored
+	w = redirectFrom(ts, "172.16.0.9:40000", "/v1/bu01/cip001", forwarded)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "172.16.0.9", waitForAccessLog(t, ts, links[1].ID).IP)
+	
+	// X-Real-IP is read after X-Forwarded-For
+	w = redirectFrom(ts, "10.1.2.3:40000", "/v1/bu01/cip002", http.Header{"X-Real-Ip": {"192.168.7.7"}})
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "192.168.7.7", waitForAccessLog(t, ts, links[2].ID).IP)
+}